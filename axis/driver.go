@@ -9,7 +9,9 @@ import (
 	"sync"
 
 	"net/http"
+	"net/url"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/osintami/camz/base"
@@ -42,40 +44,54 @@ const (
 // "user": "",
 // "pass": "",
 // "uri": "axis-cgi/mjpg/video.cgi",
+// "channel": 2,
+// "overlay": {"text": "Monument", "position": "top", "date": true, "clock": true},
+//
+// Video servers like the 241Q have a channel per analog camera, each is a camz
+// camera of its own with the same addr and a different channel.
+
+const (
+	DEFAULT_URI     = "axis-cgi/mjpg/video.cgi"
+	DEFAULT_CHANNEL = 1
+)
 
 type Axis struct {
-	client *http.Client
+	host   *host
 	req    *http.Request
 	resp   *http.Response
 	config *base.CameraConfig
-	frame  []byte
+	frames *base.Publisher
 	stop   bool
-	mutex  sync.Mutex
-}
-
-type Axis241Q struct {
-	Axis
+	// the error that ended the stream and when the latest frame came in
+	err       error
+	lastFrame time.Time
+	mutex     sync.Mutex
 }
 
 func NewDriver(config *base.CameraConfig) base.IDriver {
 	return &Axis{
 		config: config,
-		frame:  base.EmptyFrame(config.Width, config.Height)}
+		frames: base.NewPublisher("axis241q")}
 }
 
+// ListFormatsAndFrameSizes asks the camera over VAPIX, the stream keeps running.
 func (x *Axis) ListFormatsAndFrameSizes() base.Formats {
-	// TODO:  add formats and sizes
-	return base.Formats{}
+	host := acquireHost(x.config)
+	defer releaseHost(host)
+	formats, err := x.formats(host)
+	if err != nil {
+		log.Error().Err(err).Str("component", "driver").Str("name", x.config.Name).Msg("vapix formats")
+	}
+	return formats
 }
 
 func (x *Axis) Grab() base.IFrame {
-	x.mutex.Lock()
-	defer x.mutex.Unlock()
-	//data := make([]byte, len(x.frame))
-	//copy(data, x.frame)
-	frame := base.NewFrame(x.config)
-	frame.SetImage(x.frame, base.JPEG)
-	return frame
+	return x.frames.Frame(x.config)
+}
+
+// Subscribe returns a channel of the frames as they arrive.
+func (x *Axis) Subscribe() (<-chan *base.Capture, func()) {
+	return x.frames.Subscribe()
 }
 
 func (x *Axis) Stream() {
@@ -90,36 +106,65 @@ func (x *Axis) Open() error {
 		return err
 	}
 
-	if x.config.User != "" {
-		x.req.SetBasicAuth(x.config.User, x.config.Pass)
+	// digest, or basic over TLS or when the camera asks for it, the host is
+	// held until Stop
+	if x.host == nil {
+		x.host = acquireHost(x.config)
 	}
-	x.client = &http.Client{CheckRedirect: x.redirectPolicyFunc}
-	x.resp, err = x.client.Do(x.req)
+	x.resp, err = x.host.Do(x.req)
 	if err != nil {
 		log.Error().Err(err).Str("component", "driver").Str("name", x.config.Name).Msg("client.Do")
 		return err
 	}
+	if x.resp.StatusCode != http.StatusOK {
+		// e.g. 401 when the credentials are wrong
+		x.resp.Body.Close()
+		err = fmt.Errorf("stream returned %s", x.resp.Status)
+		log.Error().Err(err).Str("component", "driver").Str("name", x.config.Name).Msg("client.Do")
+		return err
+	}
+	x.mutex.Lock()
 	x.stop = false
+	x.err = nil
+	x.lastFrame = time.Now()
+	x.mutex.Unlock()
 	return nil
 }
 
 func (x *Axis) Stop() {
 	x.mutex.Lock()
 	x.stop = true
-	x.frame = base.EmptyFrame(x.config.Width, x.config.Height)
+	x.frames.Clear()
 	time.Sleep(1000 * time.Millisecond)
-	if x.resp.Body != nil {
+	// nothing to close when Open failed
+	if x.resp != nil && x.resp.Body != nil {
 		x.resp.Body.Close()
 	}
-	x.client.CloseIdleConnections()
+	if x.host != nil {
+		releaseHost(x.host)
+		x.host = nil
+	}
 	x.mutex.Unlock()
 }
 
+// Health is the error that ended the stream, e.g. when the camera rebooted.
+func (x *Axis) Health() error {
+	x.mutex.Lock()
+	defer x.mutex.Unlock()
+	return x.err
+}
+
+func (x *Axis) LastFrame() time.Time {
+	x.mutex.Lock()
+	defer x.mutex.Unlock()
+	return x.lastFrame
+}
+
 func (x *Axis) Reset() error {
 	x.Stop()
 	err := x.Open()
 	if err != nil {
-		json, err := json.Marshal(x.config)
+		json, _ := json.Marshal(x.config)
 		log.Error().Err(err).Str("component", "driver").Str("name", x.config.Name).RawJSON("config", json).Msg("Open")
 		return err
 	}
@@ -127,33 +172,48 @@ func (x *Axis) Reset() error {
 	return nil
 }
 
-func (x *Axis) redirectPolicyFunc(req *http.Request, via []*http.Request) error {
-	req.SetBasicAuth(x.config.User, x.config.Pass)
-	return nil
+// channel is the video input of a video server, 1 for a camera.
+func (x *Axis) channel() int {
+	if x.config.Channel > 0 {
+		return x.config.Channel
+	}
+	return DEFAULT_CHANNEL
 }
 
-// base Axis camera
+// getURL asks for the channel at the configured size, with the overlay burnt in.
 func (x *Axis) getURL() string {
 	config := x.config
-	url := fmt.Sprintf("http://%s:%d/%s?resolution=%dx%d",
-		config.Addr,
-		config.Port,
-		config.Uri,
-		config.Width,
-		config.Height)
-	return url
-}
-
-// Axis241Q
-func (x *Axis241Q) getURL() string {
-	config := x.config
-	return fmt.Sprintf("http://%s:%d/%s?resolution=%dx%d&camera=%s&showlength=true&textpos=top&textcolor=white&textbackgroundcolor=black&date=1&clock=1",
-		config.Addr,
-		config.Port,
-		config.Uri,
-		config.Width,
-		config.Height,
-		config.Name)
+	uri := config.Uri
+	if uri == "" {
+		uri = DEFAULT_URI
+	}
+	query := url.Values{}
+	query.Set("resolution", fmt.Sprintf("%dx%d", config.Width, config.Height))
+	query.Set("camera", strconv.Itoa(x.channel()))
+	// the stream is cut by Content-Length
+	query.Set("showlength", "1")
+	if overlay := config.Overlay; overlay != nil {
+		if overlay.Text != "" {
+			query.Set("text", "1")
+			query.Set("textstring", overlay.Text)
+		}
+		if overlay.Position != "" {
+			query.Set("textpos", overlay.Position)
+		}
+		if overlay.TextColor != "" {
+			query.Set("textcolor", overlay.TextColor)
+		}
+		if overlay.BackgroundColor != "" {
+			query.Set("textbackgroundcolor", overlay.BackgroundColor)
+		}
+		if overlay.Date {
+			query.Set("date", "1")
+		}
+		if overlay.Clock {
+			query.Set("clock", "1")
+		}
+	}
+	return fmt.Sprintf("http://%s:%d/%s?%s", config.Addr, config.Port, strings.TrimPrefix(uri, "/"), query.Encode())
 }
 
 // NOTE:  this can be modified and used to restream a clip with sleeps to control frame rate
@@ -161,7 +221,8 @@ func (x *Axis) stream(writer io.Writer) {
 	defer func() {
 		if r := recover(); r != nil {
 			log.Error().Str("component", "axis").Str("name", x.config.Name).Msg("fatal")
-			x.Reset()
+			// the supervisor reconnects
+			x.fail(fmt.Errorf("stream panic: %v", r))
 		}
 	}()
 
@@ -178,7 +239,7 @@ func (x *Axis) stream(writer io.Writer) {
 		startTime := time.Now().UnixMilli()
 		for {
 			readBuffer, _, err = reader.ReadLine()
-			if err != nil {
+			if x.checkErr("boundary", err) {
 				return
 			}
 			if string(readBuffer) == base.BOUNDARY {
@@ -220,7 +281,8 @@ func (x *Axis) stream(writer io.Writer) {
 				x.mutex.Unlock()
 				return
 			}
-			x.frame = jpegBuffer
+			x.lastFrame = time.Now()
+			x.frames.Publish(&base.Capture{Image: jpegBuffer, Type: base.JPEG, Time: x.lastFrame})
 			x.mutex.Unlock()
 			base.Sleep(int64(x.config.Rate), time.Now().UnixMilli()-startTime)
 		}
@@ -230,7 +292,17 @@ func (x *Axis) stream(writer io.Writer) {
 func (x *Axis) checkErr(key string, err error) bool {
 	if err != nil {
 		log.Error().Err(err).Str("component", "axis").Str("name", x.config.Name).Msg(key)
+		x.fail(err)
 		return true
 	}
 	return false
 }
+
+// fail records the error that ended the stream, unless it was stopped on purpose.
+func (x *Axis) fail(err error) {
+	x.mutex.Lock()
+	defer x.mutex.Unlock()
+	if !x.stop {
+		x.err = err
+	}
+}
@@ -0,0 +1,130 @@
+// Copyright © 2023 Sloan Childers
+package axis
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/osintami/camz/base"
+	"github.com/stretchr/testify/assert"
+)
+
+// videoServer streams a different frame per channel, like a 241Q with digest turned on.
+func videoServer(t *testing.T, frames map[string][]byte) (*httptest.Server, *int32) {
+	challenges := int32(0)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasPrefix(r.Header.Get("Authorization"), "Digest ") {
+			atomic.AddInt32(&challenges, 1)
+			w.Header().Set("WWW-Authenticate", `Digest realm="AXIS_241Q", nonce="abc", qop="auth"`)
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		frame, ok := frames[r.URL.Query().Get("camera")]
+		if !ok || r.URL.Query().Get("showlength") != "1" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		w.Header().Set("Content-Type", "multipart/x-mixed-replace;boundary=myboundary")
+		for {
+			base.WriteMjpeg(w, frame)
+			w.(http.Flusher).Flush()
+			select {
+			case <-r.Context().Done():
+				return
+			case <-time.After(5 * time.Millisecond):
+			}
+		}
+	}))
+	return server, &challenges
+}
+
+func TestChannels(t *testing.T) {
+	frames := map[string][]byte{"1": base.EmptyFrame(16, 8), "2": base.EmptyFrame(24, 8)}
+	server, challenges := videoServer(t, frames)
+	defer server.Close()
+	host, port, _ := net.SplitHostPort(server.Listener.Addr().String())
+	number, _ := strconv.Atoi(port)
+
+	drivers := []*Axis{}
+	for channel := 1; channel <= 2; channel++ {
+		config := &base.CameraConfig{Name: "channel", Plugin: "axis241q", Addr: host, Port: number, User: "root", Pass: "pass",
+			Width: 16, Height: 8, Rate: 50, Channel: channel}
+		x := NewDriver(config).(*Axis)
+		assert.NoError(t, x.Open())
+		x.Stream()
+		defer x.Stop()
+		drivers = append(drivers, x)
+	}
+	assert.Equal(t, drivers[0].host, drivers[1].host)
+	// the second channel reused the digest of the first
+	assert.Equal(t, int32(1), atomic.LoadInt32(challenges))
+
+	for i, x := range drivers {
+		captures, release := x.Subscribe()
+		defer release()
+		select {
+		case capture := <-captures:
+			assert.Equal(t, frames[strconv.Itoa(i+1)], capture.Image)
+			assert.Equal(t, "axis241q", capture.Source)
+			assert.True(t, capture.Seq > 0)
+		case <-time.After(time.Second):
+			t.Fatal("no frame")
+		}
+	}
+}
+
+func TestURL(t *testing.T) {
+	config := &base.CameraConfig{Addr: "10.0.0.9", Port: 80, Width: 704, Height: 576, Channel: 3,
+		Overlay: &base.OverlayConfig{Text: "Loading dock", Position: "top", TextColor: "white", BackgroundColor: "black", Clock: true}}
+	x := NewDriver(config).(*Axis)
+	assert.Equal(t, "http://10.0.0.9:80/axis-cgi/mjpg/video.cgi?camera=3&clock=1&resolution=704x576&showlength=1"+
+		"&text=1&textbackgroundcolor=black&textcolor=white&textpos=top&textstring=Loading+dock", x.getURL())
+
+	config.Channel = 0
+	config.Overlay = nil
+	config.Uri = "/mjpg/video.mjpg"
+	assert.Equal(t, "http://10.0.0.9:80/mjpg/video.mjpg?camera=1&resolution=704x576&showlength=1", x.getURL())
+}
+
+func TestHosts(t *testing.T) {
+	frames := map[string][]byte{"1": base.EmptyFrame(16, 8), "2": base.EmptyFrame(16, 8)}
+	server, _ := videoServer(t, frames)
+	defer server.Close()
+	addr, port, _ := net.SplitHostPort(server.Listener.Addr().String())
+	number, _ := strconv.Atoi(port)
+	config := func(channel int, pass string) *base.CameraConfig {
+		return &base.CameraConfig{Name: "channel", Plugin: "axis241q", Addr: addr, Port: number, User: "root", Pass: pass,
+			Width: 16, Height: 8, Rate: 50, Channel: channel}
+	}
+
+	// the channels share a host, its key has no password in it
+	first := NewDriver(config(1, "secret")).(*Axis)
+	second := NewDriver(config(2, "secret")).(*Axis)
+	assert.NoError(t, first.Open())
+	assert.NoError(t, second.Open())
+	assert.Equal(t, first.host, second.host)
+	assert.Equal(t, 2, first.host.refs)
+	assert.NotContains(t, first.host.key, "secret")
+
+	// new credentials after a config update, the old host goes with its last driver
+	first.Stop()
+	updated := NewDriver(config(1, "changed")).(*Axis)
+	assert.NoError(t, updated.Open())
+	assert.NotEqual(t, second.host, updated.host)
+	key := second.host.key
+	second.Stop()
+	hostsMutex.Lock()
+	_, ok := hosts[key]
+	hostsMutex.Unlock()
+	assert.False(t, ok)
+	updated.Stop()
+	hostsMutex.Lock()
+	assert.Empty(t, hosts)
+	hostsMutex.Unlock()
+}
@@ -0,0 +1,68 @@
+// Copyright © 2023 Sloan Childers
+package axis
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"sync"
+
+	"github.com/osintami/camz/base"
+	"github.com/osintami/camz/netcam"
+)
+
+// host is an Axis camera or video server, shared by the camz cameras of its channels
+// so they use one connection pool and answer its digest challenge once.
+type host struct {
+	key    string
+	client *http.Client
+	auth   *netcam.Auth
+	// the drivers and requests using the host, it is dropped at zero
+	refs int
+}
+
+var hosts = map[string]*host{}
+var hostsMutex sync.Mutex
+
+// hostKey is the address of the config with a hash of its credentials, the
+// password isn't kept around in the key.
+func hostKey(config *base.CameraConfig) string {
+	sum := sha256.Sum256([]byte(config.User + "\x00" + config.Pass))
+	return fmt.Sprintf("%s:%d %s", config.Addr, config.Port, hex.EncodeToString(sum[:]))
+}
+
+// acquireHost returns the host of the config's address and credentials, to be
+// handed back to releaseHost.
+func acquireHost(config *base.CameraConfig) *host {
+	key := hostKey(config)
+	hostsMutex.Lock()
+	defer hostsMutex.Unlock()
+	x, ok := hosts[key]
+	if !ok {
+		auth := netcam.NewAuth(config.User, config.Pass)
+		client := netcam.NewClient()
+		client.CheckRedirect = auth.CheckRedirect
+		x = &host{key: key, client: client, auth: auth}
+		hosts[key] = x
+	}
+	x.refs++
+	return x
+}
+
+// releaseHost drops the host with its last user, e.g. after a config update
+// changed the credentials.
+func releaseHost(x *host) {
+	hostsMutex.Lock()
+	defer hostsMutex.Unlock()
+	x.refs--
+	if x.refs == 0 {
+		delete(hosts, x.key)
+		x.client.CloseIdleConnections()
+	}
+}
+
+// Do sends a request signed for the host.
+func (x *host) Do(req *http.Request) (*http.Response, error) {
+	return x.auth.Do(x.client, req)
+}
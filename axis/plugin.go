@@ -0,0 +1,20 @@
+// Copyright © 2023 Sloan Childers
+package axis
+
+import "github.com/osintami/camz/base"
+
+func init() {
+	base.Register(base.Plugin{
+		Name:        "axis241q",
+		Description: "Axis camera or video server over VAPIX, with PTZ",
+		Config: []base.PluginField{
+			{Name: "Addr", Type: "string", Required: true, Description: "host name or IP address"},
+			{Name: "Port", Type: "int", Required: true, Description: "HTTP port"},
+			{Name: "Uri", Type: "string", Description: "stream path, " + DEFAULT_URI + " when missing"},
+			{Name: "User", Type: "string", Description: "user for digest or basic authentication"},
+			{Name: "Pass", Type: "string", Description: "password of User"},
+			{Name: "Channel", Type: "int", Description: "video server input from 1"},
+			{Name: "Overlay", Type: "object", Description: "Text, Position, TextColor, BackgroundColor, Date and Clock burnt in by the camera"},
+		},
+		New: NewDriver})
+}
@@ -0,0 +1,96 @@
+// Copyright © 2023 Sloan Childers
+package axis
+
+import (
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/osintami/camz/base"
+)
+
+// PTZ goes through VAPIX com/ptz.cgi, cameras without PTZ answer with an error.
+
+func (x *Axis) ptz(path string, query url.Values) (string, error) {
+	query.Set("camera", strconv.Itoa(x.channel()))
+	host := acquireHost(x.config)
+	defer releaseHost(host)
+	return x.vapix(host, path+"?"+query.Encode())
+}
+
+func formatFloat(value float64) string {
+	return strconv.FormatFloat(value, 'f', -1, 64)
+}
+
+func (x *Axis) Move(move base.PTZMove) error {
+	err := move.Validate()
+	if err != nil {
+		return err
+	}
+	prefix := ""
+	if move.Relative {
+		prefix = "r"
+	}
+	query := url.Values{}
+	if move.Pan != nil {
+		query.Set(prefix+"pan", formatFloat(*move.Pan))
+	}
+	if move.Tilt != nil {
+		query.Set(prefix+"tilt", formatFloat(*move.Tilt))
+	}
+	if move.Zoom != nil {
+		query.Set(prefix+"zoom", strconv.Itoa(*move.Zoom))
+	}
+	_, err = x.ptz("axis-cgi/com/ptz.cgi", query)
+	return err
+}
+
+func (x *Axis) Continuous(pan, tilt, zoom int) error {
+	err := base.ValidateSpeeds(pan, tilt, zoom)
+	if err != nil {
+		return err
+	}
+	query := url.Values{}
+	query.Set("continuouspantiltmove", strconv.Itoa(pan)+","+strconv.Itoa(tilt))
+	query.Set("continuouszoommove", strconv.Itoa(zoom))
+	_, err = x.ptz("axis-cgi/com/ptz.cgi", query)
+	return err
+}
+
+func (x *Axis) GotoPreset(name string) error {
+	query := url.Values{}
+	query.Set("gotoserverpresetname", name)
+	_, err := x.ptz("axis-cgi/com/ptz.cgi", query)
+	return err
+}
+
+// SavePreset stores the current position under name, replacing a preset of that name.
+func (x *Axis) SavePreset(name string) error {
+	query := url.Values{}
+	query.Set("setserverpresetname", name)
+	_, err := x.ptz("axis-cgi/com/ptzconfig.cgi", query)
+	return err
+}
+
+// Presets reads the presetposnoN=name lines of query=presetposall.
+func (x *Axis) Presets() ([]string, error) {
+	query := url.Values{}
+	query.Set("query", "presetposall")
+	body, err := x.ptz("axis-cgi/com/ptz.cgi", query)
+	if err != nil {
+		return nil, err
+	}
+	numbers := map[string]int{}
+	presets := []string{}
+	for name, value := range parseParams(body) {
+		number, err := strconv.Atoi(strings.TrimPrefix(name, "presetposno"))
+		if err != nil || !strings.HasPrefix(name, "presetposno") {
+			continue
+		}
+		numbers[value] = number
+		presets = append(presets, value)
+	}
+	sort.Slice(presets, func(i, j int) bool { return numbers[presets[i]] < numbers[presets[j]] })
+	return presets, nil
+}
@@ -0,0 +1,76 @@
+// Copyright © 2023 Sloan Childers
+package axis
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+
+	"github.com/osintami/camz/base"
+	"github.com/stretchr/testify/assert"
+)
+
+// ptzServer records the VAPIX calls it gets, like a PTZ camera answering 204.
+func ptzServer(t *testing.T) (*httptest.Server, *base.CameraConfig, func() []string) {
+	calls := []string{}
+	mutex := sync.Mutex{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mutex.Lock()
+		calls = append(calls, r.URL.Path+"?"+r.URL.RawQuery)
+		mutex.Unlock()
+		if r.URL.Query().Get("query") == "presetposall" {
+			w.Write([]byte("Preset Positions for camera 1\npresetposno10=Gate\npresetposno1=Home\npresetposno2=Door\n"))
+			return
+		}
+		if r.URL.Query().Get("gotoserverpresetname") == "missing" {
+			w.Write([]byte("Error: preset missing not found\n"))
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	host, port, _ := net.SplitHostPort(server.Listener.Addr().String())
+	number, _ := strconv.Atoi(port)
+	config := &base.CameraConfig{Name: "axis", Addr: host, Port: number}
+	return server, config, func() []string {
+		mutex.Lock()
+		defer mutex.Unlock()
+		return append([]string{}, calls...)
+	}
+}
+
+func TestPTZ(t *testing.T) {
+	server, config, calls := ptzServer(t)
+	defer server.Close()
+	var x base.IPTZ = NewDriver(config).(*Axis)
+
+	pan, tilt, zoom := 12.5, -30.0, 2000
+	assert.NoError(t, x.Move(base.PTZMove{Pan: &pan, Tilt: &tilt, Zoom: &zoom}))
+	assert.NoError(t, x.Move(base.PTZMove{Pan: &tilt, Relative: true}))
+	assert.NoError(t, x.Continuous(50, -50, 0))
+	assert.NoError(t, x.GotoPreset("Front door"))
+	assert.NoError(t, x.SavePreset("Gate"))
+	presets, err := x.Presets()
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"Home", "Door", "Gate"}, presets)
+	assert.Equal(t, []string{
+		"/axis-cgi/com/ptz.cgi?camera=1&pan=12.5&tilt=-30&zoom=2000",
+		"/axis-cgi/com/ptz.cgi?camera=1&rpan=-30",
+		"/axis-cgi/com/ptz.cgi?camera=1&continuouspantiltmove=50%2C-50&continuouszoommove=0",
+		"/axis-cgi/com/ptz.cgi?camera=1&gotoserverpresetname=Front+door",
+		"/axis-cgi/com/ptzconfig.cgi?camera=1&setserverpresetname=Gate",
+		"/axis-cgi/com/ptz.cgi?camera=1&query=presetposall",
+	}, calls())
+
+	// rejected before reaching the camera
+	zoom = 0
+	assert.ErrorIs(t, x.Move(base.PTZMove{Zoom: &zoom}), base.ErrPTZInvalid)
+	assert.ErrorIs(t, x.Move(base.PTZMove{}), base.ErrPTZInvalid)
+	assert.ErrorIs(t, x.Continuous(101, 0, 0), base.ErrPTZInvalid)
+	assert.Equal(t, 6, len(calls()))
+
+	// errors come back in a 200
+	assert.Error(t, x.GotoPreset("missing"))
+}
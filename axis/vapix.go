@@ -0,0 +1,143 @@
+// Copyright © 2023 Sloan Childers
+package axis
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/osintami/camz/base"
+)
+
+const (
+	VAPIX_TIMEOUT = 10 * time.Second
+	// largest VAPIX answer read
+	VAPIX_MAX_SIZE = 1 << 20
+	// JPEG compression range of VAPIX, 0 is the best quality
+	COMPRESSION_MIN = 0
+	COMPRESSION_MAX = 100
+)
+
+// vapix sends a VAPIX request to the camera next to the stream, which keeps running.
+func (x *Axis) vapix(host *host, path string) (string, error) {
+	config := x.config
+	ctx, cancel := context.WithTimeout(context.Background(), VAPIX_TIMEOUT)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, "GET", fmt.Sprintf("http://%s:%d/%s", config.Addr, config.Port, path), nil)
+	if err != nil {
+		return "", err
+	}
+	resp, err := host.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	// ptz.cgi answers 204
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return "", fmt.Errorf("%s returned %s", path, resp.Status)
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, VAPIX_MAX_SIZE))
+	if err != nil {
+		return "", err
+	}
+	// VAPIX reports errors with a 200 and a message
+	text := strings.TrimPrefix(strings.TrimSpace(string(body)), "# ")
+	if strings.HasPrefix(text, "Error") {
+		return "", fmt.Errorf("%s: %s", path, strings.TrimSpace(string(body)))
+	}
+	return string(body), nil
+}
+
+// parseParams reads the root.Group.Name=value lines of param.cgi?action=list.
+func parseParams(body string) map[string]string {
+	params := map[string]string{}
+	scanner := bufio.NewScanner(strings.NewReader(body))
+	for scanner.Scan() {
+		name, value, ok := strings.Cut(strings.TrimSpace(scanner.Text()), "=")
+		if ok {
+			params[strings.TrimPrefix(name, "root.")] = value
+		}
+	}
+	return params
+}
+
+func splitList(value string) []string {
+	items := []string{}
+	for _, item := range strings.Split(value, ",") {
+		item = strings.TrimSpace(item)
+		if item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// formats asks the camera for its resolutions, rotations and compression.  Old
+// firmware without the Properties.Image group only tells the current size.
+func (x *Axis) formats(host *host) (base.Formats, error) {
+	format := base.Format{Name: "Motion-JPEG", Sizes: []base.Size{}}
+	// Image.I0 is channel 1
+	appearance := fmt.Sprintf("Image.I%d.Appearance", x.channel()-1)
+	body, err := x.vapix(host, "axis-cgi/param.cgi?action=list&group=Properties.Image,"+appearance)
+	params := parseParams(body)
+	if err == nil {
+		for _, size := range splitList(params["Properties.Image.Resolution"]) {
+			format.Sizes = append(format.Sizes, base.Size{Size: size})
+		}
+		for _, rotation := range splitList(params["Properties.Image.Rotation"]) {
+			degrees, err := strconv.Atoi(rotation)
+			if err == nil {
+				format.Rotations = append(format.Rotations, degrees)
+			}
+		}
+		if value, ok := params[appearance+".Compression"]; ok {
+			compression, err := strconv.Atoi(value)
+			if err == nil {
+				format.Compression = &base.Range{Min: COMPRESSION_MIN, Max: COMPRESSION_MAX, Default: compression}
+			}
+		}
+	}
+	if len(format.Sizes) == 0 {
+		size, sizeErr := x.imageSize(host)
+		if sizeErr != nil {
+			if err == nil {
+				err = sizeErr
+			}
+			return base.Formats{}, err
+		}
+		format.Sizes = append(format.Sizes, base.Size{Size: size})
+	}
+	return base.Formats{Formats: []base.Format{format}}, nil
+}
+
+// imageSize reads the "image width = 640" and "image height = 480" lines of imagesize.cgi.
+func (x *Axis) imageSize(host *host) (string, error) {
+	body, err := x.vapix(host, "axis-cgi/imagesize.cgi?camera="+strconv.Itoa(x.channel()))
+	if err != nil {
+		return "", err
+	}
+	var width, height int
+	scanner := bufio.NewScanner(strings.NewReader(body))
+	for scanner.Scan() {
+		name, value, ok := strings.Cut(scanner.Text(), "=")
+		if !ok {
+			continue
+		}
+		number, _ := strconv.Atoi(strings.TrimSpace(value))
+		switch strings.TrimSpace(name) {
+		case "image width":
+			width = number
+		case "image height":
+			height = number
+		}
+	}
+	if width == 0 || height == 0 {
+		return "", fmt.Errorf("imagesize.cgi: no size in %q", body)
+	}
+	return fmt.Sprintf("%dx%d", width, height), nil
+}
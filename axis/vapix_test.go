@@ -0,0 +1,62 @@
+// Copyright © 2023 Sloan Childers
+package axis
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"github.com/osintami/camz/base"
+	"github.com/stretchr/testify/assert"
+)
+
+func vapixServer(t *testing.T, params string) (*httptest.Server, *base.CameraConfig) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, pass, ok := r.BasicAuth()
+		if !ok || user != "root" || pass != "pass" {
+			w.Header().Set("WWW-Authenticate", `Basic realm="AXIS"`)
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		switch r.URL.Path {
+		case "/axis-cgi/param.cgi":
+			w.Write([]byte(params))
+		case "/axis-cgi/imagesize.cgi":
+			w.Write([]byte("image width = 704\r\nimage height = 576\r\n"))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	host, port, _ := net.SplitHostPort(server.Listener.Addr().String())
+	number, _ := strconv.Atoi(port)
+	return server, &base.CameraConfig{Name: "axis", Addr: host, Port: number, User: "root", Pass: "pass"}
+}
+
+func TestFormats(t *testing.T) {
+	server, config := vapixServer(t, "root.Properties.Image.Format=jpeg,mjpeg,h264\n"+
+		"root.Properties.Image.Resolution=1280x720,640x480,320x240\n"+
+		"root.Properties.Image.Rotation=0,180\n"+
+		"root.Image.I0.Appearance.Compression=30\n")
+	defer server.Close()
+
+	formats := NewDriver(config).ListFormatsAndFrameSizes()
+	assert.Equal(t, 1, len(formats.Formats))
+	format := formats.Formats[0]
+	assert.Equal(t, []base.Size{{Size: "1280x720"}, {Size: "640x480"}, {Size: "320x240"}}, format.Sizes)
+	assert.Equal(t, []int{0, 180}, format.Rotations)
+	assert.Equal(t, &base.Range{Min: 0, Max: 100, Default: 30}, format.Compression)
+}
+
+func TestFormatsOldFirmware(t *testing.T) {
+	server, config := vapixServer(t, "# Error: Error -1 getting param in group 'Properties.Image'\n")
+	defer server.Close()
+
+	formats := NewDriver(config).ListFormatsAndFrameSizes()
+	assert.Equal(t, []base.Size{{Size: "704x576"}}, formats.Formats[0].Sizes)
+	assert.Nil(t, formats.Formats[0].Compression)
+
+	config.Pass = "wrong"
+	assert.Equal(t, 0, len(NewDriver(config).ListFormatsAndFrameSizes().Formats))
+}
@@ -0,0 +1,122 @@
+// Copyright © 2023 Sloan Childers
+package base
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+)
+
+type Role string
+
+// each role can do everything the roles before it can
+const (
+	ROLE_VIEWER   Role = "viewer"   // stream, snapshots, recordings
+	ROLE_OPERATOR Role = "operator" // camera commands
+	ROLE_ADMIN    Role = "admin"    // configuration
+)
+
+const API_KEY_BYTES = 32
+
+var roleLevels = map[Role]int{
+	ROLE_VIEWER:   1,
+	ROLE_OPERATOR: 2,
+	ROLE_ADMIN:    3,
+}
+
+func (x Role) Valid() bool {
+	return roleLevels[x] > 0
+}
+
+// Allows reports whether the role grants what required needs.
+func (x Role) Allows(required Role) bool {
+	return x.Valid() && roleLevels[x] >= roleLevels[required]
+}
+
+// ApiKey is a named API key, only the SHA-256 of the key itself is stored.
+type ApiKey struct {
+	Name string
+	Role Role
+	Hash string
+	// camera uuids the key is limited to, every camera when empty
+	Cameras []string `json:"Cameras,omitempty"`
+}
+
+func HashApiKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// NewApiKey creates a random key, the key is only ever returned here.
+func NewApiKey(name string, role Role) (*ApiKey, string, error) {
+	data := make([]byte, API_KEY_BYTES)
+	_, err := rand.Read(data)
+	if err != nil {
+		return nil, "", err
+	}
+	key := hex.EncodeToString(data)
+	return &ApiKey{Name: name, Role: role, Hash: HashApiKey(key)}, key, nil
+}
+
+// Allows reports whether the key may do what role needs on camera.
+func (x *ApiKey) Allows(camera string, role Role) bool {
+	if !x.Role.Allows(role) {
+		return false
+	}
+	if len(x.Cameras) == 0 {
+		return true
+	}
+	for _, uuid := range x.Cameras {
+		if uuid == camera {
+			return true
+		}
+	}
+	return false
+}
+
+// FindApiKey returns the configured key matching key, or nil.
+func (x *Cameras) FindApiKey(key string) *ApiKey {
+	if key == "" {
+		return nil
+	}
+	hash := []byte(HashApiKey(key))
+	var found *ApiKey
+	for _, apiKey := range x.ApiKeys {
+		// compare every key so the time taken doesn't tell which one matched
+		if subtle.ConstantTimeCompare(hash, []byte(apiKey.Hash)) == 1 && found == nil {
+			found = apiKey
+		}
+	}
+	return found
+}
+
+// MigrateApiKeys replaces the old plaintext per camera ApiKey with an admin key
+// limited to that camera.  It reports whether anything changed.
+func (x *Cameras) MigrateApiKeys() bool {
+	changed := false
+	for _, config := range x.Cameras {
+		if config.ApiKey == "" {
+			continue
+		}
+		hash := HashApiKey(config.ApiKey)
+		merged := false
+		for _, apiKey := range x.ApiKeys {
+			if apiKey.Hash == hash && apiKey.Role == ROLE_ADMIN && len(apiKey.Cameras) > 0 {
+				apiKey.Cameras = append(apiKey.Cameras, config.Uuid)
+				merged = true
+				break
+			}
+		}
+		if !merged {
+			x.ApiKeys = append(x.ApiKeys, &ApiKey{
+				Name:    config.Name,
+				Role:    ROLE_ADMIN,
+				Hash:    hash,
+				Cameras: []string{config.Uuid}})
+		}
+		config.ApiKey = ""
+		changed = true
+	}
+	return changed
+}
@@ -0,0 +1,57 @@
+// Copyright © 2023 Sloan Childers
+package base
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRoles(t *testing.T) {
+	assert.True(t, ROLE_ADMIN.Allows(ROLE_OPERATOR))
+	assert.True(t, ROLE_OPERATOR.Allows(ROLE_VIEWER))
+	assert.True(t, ROLE_VIEWER.Allows(ROLE_VIEWER))
+	assert.False(t, ROLE_VIEWER.Allows(ROLE_OPERATOR))
+	assert.False(t, ROLE_OPERATOR.Allows(ROLE_ADMIN))
+	assert.False(t, Role("root").Allows(ROLE_VIEWER))
+}
+
+func TestFindApiKey(t *testing.T) {
+	viewer, viewerKey, err := NewApiKey("kitchen tablet", ROLE_VIEWER)
+	assert.NoError(t, err)
+	admin, adminKey, err := NewApiKey("admin", ROLE_ADMIN)
+	assert.NoError(t, err)
+	assert.NotEqual(t, viewerKey, adminKey)
+	assert.NotContains(t, viewer.Hash, viewerKey)
+
+	cameras := &Cameras{ApiKeys: []*ApiKey{viewer, admin}}
+	assert.Equal(t, viewer, cameras.FindApiKey(viewerKey))
+	assert.Equal(t, admin, cameras.FindApiKey(adminKey))
+	assert.Nil(t, cameras.FindApiKey(""))
+	assert.Nil(t, cameras.FindApiKey("changeme"))
+
+	assert.True(t, viewer.Allows("front", ROLE_VIEWER))
+	assert.False(t, viewer.Allows("front", ROLE_ADMIN))
+	viewer.Cameras = []string{"front"}
+	assert.True(t, viewer.Allows("front", ROLE_VIEWER))
+	assert.False(t, viewer.Allows("back", ROLE_VIEWER))
+}
+
+func TestMigrateApiKeys(t *testing.T) {
+	cameras := &Cameras{Cameras: []*CameraConfig{
+		{Uuid: "front", Name: "front door", ApiKey: "changeme"},
+		{Uuid: "back", Name: "back door", ApiKey: "changeme"},
+		{Uuid: "garage", Name: "garage"}}}
+	assert.True(t, cameras.MigrateApiKeys())
+	assert.False(t, cameras.MigrateApiKeys())
+
+	assert.Len(t, cameras.ApiKeys, 1)
+	key := cameras.FindApiKey("changeme")
+	assert.NotNil(t, key)
+	assert.Equal(t, ROLE_ADMIN, key.Role)
+	assert.Equal(t, []string{"front", "back"}, key.Cameras)
+	assert.False(t, key.Allows("garage", ROLE_VIEWER))
+	for _, config := range cameras.Cameras {
+		assert.Empty(t, config.ApiKey)
+	}
+}
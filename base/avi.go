@@ -0,0 +1,591 @@
+// Copyright © 2023 Sloan Childers
+package base
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"math"
+	"time"
+)
+
+// MJPEG in AVI, readable by any media player.  Files larger than AVI_RIFF_LIMIT
+// continue in OpenDML AVIX extensions with standard and super indexes, the first
+// RIFF also carries a legacy idx1 index.  Capture times are kept in a trailing
+// "tims" chunk that players ignore and camz uses for playback.
+
+const (
+	AVI_RIFF_LIMIT       = 1 << 30
+	AVI_SUPER_INDEX_SIZE = 256
+	AVI_VIDEO_CHUNK      = "00dc"
+	AVI_INDEX_CHUNK      = "ix00"
+	AVI_TIMES_CHUNK      = "tims"
+
+	aviHasIndex          = 0x10
+	aviTrustChunkType    = 0x800
+	aviKeyframe          = 0x10
+	aviIndexOfIndexes    = 0x00
+	aviIndexOfChunks     = 0x01
+	aviMainHeaderSize    = 56
+	aviStreamHeaderSize  = 56
+	aviBitmapInfoSize    = 40
+	aviExtendedHeaderLen = 248
+)
+
+var ErrAviFormat = errors.New("not an MJPEG AVI file")
+var ErrAviClosed = errors.New("avi writer closed")
+
+type aviChunk struct {
+	offset int64 // absolute offset of the chunk data
+	size   uint32
+}
+
+type aviRiff struct {
+	start  int64 // offset of the RIFF header
+	movi   int64 // offset of the movi LIST header
+	frames []aviChunk
+}
+
+type AviWriter struct {
+	w          io.WriteSeeker
+	width      int
+	height     int
+	rate       float32
+	limit      int64
+	riffs      []*aviRiff
+	times      []int64
+	maxSize    uint32
+	totalBytes int64
+	// header fields patched on close
+	avihOffset int64
+	strhOffset int64
+	indxOffset int64
+	dmlhOffset int64
+	closed     bool
+}
+
+func NewAviWriter(w io.WriteSeeker, width, height int, rate float32) (*AviWriter, error) {
+	x := &AviWriter{
+		w:      w,
+		width:  width,
+		height: height,
+		rate:   rate,
+		limit:  AVI_RIFF_LIMIT}
+	err := x.writeHeaders()
+	if err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+func (x *AviWriter) Frames() int {
+	return len(x.times)
+}
+
+// WriteFrame appends one JPEG captured at the given time.
+func (x *AviWriter) WriteFrame(jpeg []byte, at time.Time) error {
+	if x.closed {
+		return ErrAviClosed
+	}
+	riff := x.riffs[len(x.riffs)-1]
+	pos, err := x.tell()
+	if err != nil {
+		return err
+	}
+	// leave room for this RIFF's own indexes
+	reserve := int64(8+len(jpeg)+1) + int64(32+8*(len(riff.frames)+1))
+	if len(x.riffs) == 1 {
+		reserve += int64(8 + 16*(len(riff.frames)+1))
+	}
+	if len(riff.frames) > 0 && pos-riff.start+reserve > x.limit {
+		if len(x.riffs) == AVI_SUPER_INDEX_SIZE {
+			return errors.New("avi file too large")
+		}
+		err = x.closeRiff(riff)
+		if err != nil {
+			return err
+		}
+		riff, err = x.startRiff("AVIX")
+		if err != nil {
+			return err
+		}
+		pos, err = x.tell()
+		if err != nil {
+			return err
+		}
+	}
+
+	err = x.writeChunk(AVI_VIDEO_CHUNK, jpeg)
+	if err != nil {
+		return err
+	}
+	riff.frames = append(riff.frames, aviChunk{offset: pos + 8, size: uint32(len(jpeg))})
+	x.times = append(x.times, at.UnixNano())
+	x.totalBytes += int64(len(jpeg))
+	if uint32(len(jpeg)) > x.maxSize {
+		x.maxSize = uint32(len(jpeg))
+	}
+	return nil
+}
+
+// Close writes the indexes and final sizes, it does not close the underlying writer.
+func (x *AviWriter) Close() error {
+	if x.closed {
+		return nil
+	}
+	x.closed = true
+	riff := x.riffs[len(x.riffs)-1]
+
+	times := &bytes.Buffer{}
+	binary.Write(times, binary.LittleEndian, x.times)
+	err := x.closeMovi(riff)
+	if err == nil {
+		err = x.writeChunk(AVI_TIMES_CHUNK, times.Bytes())
+	}
+	if err == nil {
+		err = x.closeRiffSize(riff)
+	}
+	if err == nil {
+		err = x.patchHeaders()
+	}
+	if err != nil {
+		return err
+	}
+	_, err = x.w.Seek(0, io.SeekEnd)
+	return err
+}
+
+func (x *AviWriter) tell() (int64, error) {
+	return x.w.Seek(0, io.SeekCurrent)
+}
+
+func (x *AviWriter) put(data ...interface{}) error {
+	for _, value := range data {
+		var err error
+		if s, ok := value.(string); ok {
+			_, err = x.w.Write([]byte(s))
+		} else {
+			err = binary.Write(x.w, binary.LittleEndian, value)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (x *AviWriter) writeChunk(id string, data []byte) error {
+	err := x.put(id, uint32(len(data)), data)
+	if err == nil && len(data)%2 == 1 {
+		err = x.put(uint8(0))
+	}
+	return err
+}
+
+func (x *AviWriter) microSecPerFrame() uint32 {
+	if x.rate <= 0 {
+		return 0
+	}
+	return uint32(math.Round(1000000 / float64(x.rate)))
+}
+
+func (x *AviWriter) writeHeaders() error {
+	strlSize := 4 + (8 + aviStreamHeaderSize) + (8 + aviBitmapInfoSize) + (8 + 24 + 16*AVI_SUPER_INDEX_SIZE)
+	odmlSize := 4 + 8 + aviExtendedHeaderLen
+	hdrlSize := 4 + (8 + aviMainHeaderSize) + (8 + strlSize) + (8 + odmlSize)
+
+	err := x.put("RIFF", uint32(0), "AVI ", "LIST", uint32(hdrlSize), "hdrl", "avih", uint32(aviMainHeaderSize))
+	if err != nil {
+		return err
+	}
+	x.avihOffset, _ = x.tell()
+	err = x.put(
+		x.microSecPerFrame(),
+		uint32(0), // max bytes per second
+		uint32(0), // padding granularity
+		uint32(aviHasIndex|aviTrustChunkType),
+		uint32(0), // total frames in the first RIFF
+		uint32(0), // initial frames
+		uint32(1), // streams
+		uint32(0), // suggested buffer size
+		uint32(x.width),
+		uint32(x.height),
+		[4]uint32{})
+	if err != nil {
+		return err
+	}
+
+	err = x.put("LIST", uint32(strlSize), "strl", "strh", uint32(aviStreamHeaderSize))
+	if err != nil {
+		return err
+	}
+	x.strhOffset, _ = x.tell()
+	err = x.put(
+		"vids", "MJPG",
+		uint32(0), // flags
+		uint16(0), // priority
+		uint16(0), // language
+		uint32(0), // initial frames
+		uint32(1000),
+		uint32(math.Round(float64(x.rate)*1000)),
+		uint32(0), // start
+		uint32(0), // length in frames
+		uint32(0), // suggested buffer size
+		int32(-1), // quality
+		uint32(0), // sample size
+		[4]int16{0, 0, int16(x.width), int16(x.height)})
+	if err != nil {
+		return err
+	}
+
+	err = x.put("strf", uint32(aviBitmapInfoSize),
+		uint32(aviBitmapInfoSize),
+		int32(x.width),
+		int32(x.height),
+		uint16(1),  // planes
+		uint16(24), // bits per pixel
+		"MJPG",
+		uint32(x.width*x.height*3),
+		[4]uint32{})
+	if err != nil {
+		return err
+	}
+
+	// OpenDML super index, one entry per RIFF filled in as they are closed
+	err = x.put("indx", uint32(24+16*AVI_SUPER_INDEX_SIZE))
+	if err != nil {
+		return err
+	}
+	x.indxOffset, _ = x.tell()
+	err = x.put(uint16(4), uint8(0), uint8(aviIndexOfIndexes), uint32(0), AVI_VIDEO_CHUNK, [3]uint32{}, make([]byte, 16*AVI_SUPER_INDEX_SIZE))
+	if err != nil {
+		return err
+	}
+
+	err = x.put("LIST", uint32(odmlSize), "odml", "dmlh", uint32(aviExtendedHeaderLen))
+	if err != nil {
+		return err
+	}
+	x.dmlhOffset, _ = x.tell()
+	err = x.put(make([]byte, aviExtendedHeaderLen))
+	if err != nil {
+		return err
+	}
+
+	x.riffs = append(x.riffs, &aviRiff{start: 0})
+	return x.startMovi(x.riffs[0])
+}
+
+func (x *AviWriter) startRiff(form string) (*aviRiff, error) {
+	start, err := x.tell()
+	if err != nil {
+		return nil, err
+	}
+	err = x.put("RIFF", uint32(0), form)
+	if err != nil {
+		return nil, err
+	}
+	riff := &aviRiff{start: start}
+	x.riffs = append(x.riffs, riff)
+	return riff, x.startMovi(riff)
+}
+
+func (x *AviWriter) startMovi(riff *aviRiff) error {
+	var err error
+	riff.movi, err = x.tell()
+	if err != nil {
+		return err
+	}
+	return x.put("LIST", uint32(0), "movi")
+}
+
+func (x *AviWriter) closeRiff(riff *aviRiff) error {
+	err := x.closeMovi(riff)
+	if err != nil {
+		return err
+	}
+	return x.closeRiffSize(riff)
+}
+
+// closeMovi ends the movi list with its standard index, plus idx1 in the first RIFF.
+func (x *AviWriter) closeMovi(riff *aviRiff) error {
+	ixOffset, err := x.tell()
+	if err != nil {
+		return err
+	}
+	index := &bytes.Buffer{}
+	binary.Write(index, binary.LittleEndian, uint16(2))
+	binary.Write(index, binary.LittleEndian, uint8(0))
+	binary.Write(index, binary.LittleEndian, uint8(aviIndexOfChunks))
+	binary.Write(index, binary.LittleEndian, uint32(len(riff.frames)))
+	index.WriteString(AVI_VIDEO_CHUNK)
+	binary.Write(index, binary.LittleEndian, uint64(riff.movi))
+	binary.Write(index, binary.LittleEndian, uint32(0))
+	for _, frame := range riff.frames {
+		binary.Write(index, binary.LittleEndian, uint32(frame.offset-riff.movi))
+		binary.Write(index, binary.LittleEndian, frame.size)
+	}
+	err = x.writeChunk(AVI_INDEX_CHUNK, index.Bytes())
+	if err != nil {
+		return err
+	}
+	end, err := x.tell()
+	if err != nil {
+		return err
+	}
+	err = x.patch(riff.movi+4, uint32(end-riff.movi-8))
+	if err != nil {
+		return err
+	}
+
+	entry := len(x.riffs) - 1
+	err = x.patch(x.indxOffset+4, uint32(len(x.riffs)))
+	if err == nil {
+		err = x.patch(x.indxOffset+24+int64(16*entry), uint64(ixOffset), uint32(end-ixOffset), uint32(len(riff.frames)))
+	}
+	if err != nil {
+		return err
+	}
+
+	if len(x.riffs) == 1 {
+		// legacy index, offsets are relative to the "movi" fourcc
+		idx1 := &bytes.Buffer{}
+		for _, frame := range riff.frames {
+			idx1.WriteString(AVI_VIDEO_CHUNK)
+			binary.Write(idx1, binary.LittleEndian, uint32(aviKeyframe))
+			binary.Write(idx1, binary.LittleEndian, uint32(frame.offset-8-(riff.movi+8)))
+			binary.Write(idx1, binary.LittleEndian, frame.size)
+		}
+		return x.writeChunk("idx1", idx1.Bytes())
+	}
+	return nil
+}
+
+func (x *AviWriter) closeRiffSize(riff *aviRiff) error {
+	end, err := x.tell()
+	if err != nil {
+		return err
+	}
+	return x.patch(riff.start+4, uint32(end-riff.start-8))
+}
+
+func (x *AviWriter) patchHeaders() error {
+	total := uint32(len(x.times))
+	first := uint32(len(x.riffs[0].frames))
+	buffer := x.maxSize + 8
+	var bytesPerSec uint32
+	if total > 0 {
+		bytesPerSec = uint32(float64(x.totalBytes) / float64(total) * float64(x.rate))
+	}
+
+	err := x.patch(x.avihOffset+4, bytesPerSec)
+	if err == nil {
+		err = x.patch(x.avihOffset+16, first)
+	}
+	if err == nil {
+		err = x.patch(x.avihOffset+28, buffer)
+	}
+	if err == nil {
+		err = x.patch(x.strhOffset+32, total, buffer)
+	}
+	if err == nil {
+		err = x.patch(x.dmlhOffset, total)
+	}
+	return err
+}
+
+// patch overwrites data at offset and returns to the current write position.
+func (x *AviWriter) patch(offset int64, data ...interface{}) error {
+	pos, err := x.tell()
+	if err != nil {
+		return err
+	}
+	_, err = x.w.Seek(offset, io.SeekStart)
+	if err != nil {
+		return err
+	}
+	err = x.put(data...)
+	if err != nil {
+		return err
+	}
+	_, err = x.w.Seek(pos, io.SeekStart)
+	return err
+}
+
+// AviReader reads the frames of an MJPEG AVI.  Frames are found by walking the
+// movi lists, so a file that was never closed can still be read.
+type AviReader struct {
+	r      io.ReadSeeker
+	Width  int
+	Height int
+	Rate   float64
+	frames []aviChunk
+	times  []int64
+}
+
+func NewAviReader(r io.ReadSeeker) (*AviReader, error) {
+	x := &AviReader{r: r}
+	end, err := r.Seek(0, io.SeekEnd)
+	if err != nil {
+		return nil, err
+	}
+	var pos int64
+	for pos+12 <= end {
+		id, size, err := x.chunkHeader(pos)
+		if err != nil {
+			return nil, err
+		}
+		form := make([]byte, 4)
+		_, err = io.ReadFull(r, form)
+		if err != nil {
+			return nil, err
+		}
+		if id != "RIFF" || (pos == 0 && string(form) != "AVI ") || (pos > 0 && string(form) != "AVIX") {
+			if pos == 0 {
+				return nil, ErrAviFormat
+			}
+			break
+		}
+		riffEnd := pos + 8 + int64(size)
+		if size == 0 || riffEnd > end {
+			// never closed, read whatever made it to disk
+			riffEnd = end
+		}
+		err = x.walk(pos+12, riffEnd)
+		if err != nil {
+			return nil, err
+		}
+		pos = riffEnd + riffEnd%2
+	}
+	if x.Rate == 0 {
+		return nil, ErrAviFormat
+	}
+	if len(x.times) != len(x.frames) {
+		x.times = nil
+	}
+	return x, nil
+}
+
+func (x *AviReader) chunkHeader(pos int64) (string, uint32, error) {
+	_, err := x.r.Seek(pos, io.SeekStart)
+	if err != nil {
+		return "", 0, err
+	}
+	header := make([]byte, 8)
+	_, err = io.ReadFull(x.r, header)
+	if err != nil {
+		return "", 0, err
+	}
+	return string(header[:4]), binary.LittleEndian.Uint32(header[4:]), nil
+}
+
+func (x *AviReader) walk(pos, end int64) error {
+	for pos+8 <= end {
+		id, size, err := x.chunkHeader(pos)
+		if err != nil {
+			return err
+		}
+		next := pos + 8 + int64(size) + int64(size%2)
+		if id == "LIST" {
+			listEnd := pos + 8 + int64(size)
+			if size == 0 || listEnd > end {
+				listEnd = end
+				next = end
+			}
+			err = x.walk(pos+12, listEnd)
+			if err != nil {
+				return err
+			}
+			pos = next
+			continue
+		}
+		if next > end {
+			// partially written chunk
+			return nil
+		}
+		switch {
+		case id == "strh" && size >= 32:
+			header := make([]byte, 32)
+			_, err = io.ReadFull(x.r, header)
+			if err != nil {
+				return err
+			}
+			scale := binary.LittleEndian.Uint32(header[20:])
+			rate := binary.LittleEndian.Uint32(header[24:])
+			if string(header[:4]) == "vids" && scale > 0 {
+				x.Rate = float64(rate) / float64(scale)
+			}
+		case id == "strf" && size >= 20:
+			header := make([]byte, 20)
+			_, err = io.ReadFull(x.r, header)
+			if err != nil {
+				return err
+			}
+			x.Width = int(int32(binary.LittleEndian.Uint32(header[4:])))
+			x.Height = int(int32(binary.LittleEndian.Uint32(header[8:])))
+			if string(header[16:20]) != "MJPG" {
+				return ErrAviFormat
+			}
+		case id == AVI_VIDEO_CHUNK || id == "00db":
+			x.frames = append(x.frames, aviChunk{offset: pos + 8, size: size})
+		case id == AVI_TIMES_CHUNK:
+			x.times = make([]int64, size/8)
+			err = binary.Read(x.r, binary.LittleEndian, x.times)
+			if err != nil {
+				return err
+			}
+		}
+		pos = next
+	}
+	return nil
+}
+
+func (x *AviReader) Len() int {
+	return len(x.frames)
+}
+
+// Frame returns the JPEG of frame i.
+func (x *AviReader) Frame(i int) ([]byte, error) {
+	frame := x.frames[i]
+	_, err := x.r.Seek(frame.offset, io.SeekStart)
+	if err != nil {
+		return nil, err
+	}
+	data := make([]byte, frame.size)
+	_, err = io.ReadFull(x.r, data)
+	return data, err
+}
+
+// Time returns when frame i was captured, or the zero time for files without capture times.
+func (x *AviReader) Time(i int) time.Time {
+	if x.times == nil {
+		return time.Time{}
+	}
+	return time.Unix(0, x.times[i])
+}
+
+// Offset returns the play position of frame i from the start of the file.
+func (x *AviReader) Offset(i int) time.Duration {
+	if x.times != nil {
+		return time.Duration(x.times[i] - x.times[0])
+	}
+	return time.Duration(float64(i) / x.Rate * float64(time.Second))
+}
+
+func (x *AviReader) Duration() time.Duration {
+	if len(x.frames) == 0 {
+		return 0
+	}
+	return x.Offset(len(x.frames)-1) + time.Duration(float64(time.Second)/x.Rate)
+}
+
+// Seek returns the first frame at or after offset, every MJPEG frame is a keyframe.
+func (x *AviReader) Seek(offset time.Duration) int {
+	for i := range x.frames {
+		if x.Offset(i) >= offset {
+			return i
+		}
+	}
+	return len(x.frames)
+}
@@ -0,0 +1,143 @@
+// Copyright © 2023 Sloan Childers
+package base
+
+import (
+	"bytes"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func writeTestAvi(t *testing.T, limit int64, frames int) (string, [][]byte, []time.Time) {
+	file, err := os.Create(filepath.Join(t.TempDir(), "test.avi"))
+	assert.NoError(t, err)
+	defer file.Close()
+
+	writer, err := NewAviWriter(file, 100, 100, 10)
+	assert.NoError(t, err)
+	if limit > 0 {
+		writer.limit = limit
+	}
+	jpegs := [][]byte{}
+	times := []time.Time{}
+	now := time.Now()
+	for i := 0; i < frames; i++ {
+		// odd sized frames exercise the chunk padding
+		jpeg := append(EmptyFrame(100, 100), bytes.Repeat([]byte{byte(i)}, i%2)...)
+		at := now.Add(time.Duration(i) * 110 * time.Millisecond)
+		assert.NoError(t, writer.WriteFrame(jpeg, at))
+		jpegs = append(jpegs, jpeg)
+		times = append(times, at)
+	}
+	assert.NoError(t, writer.Close())
+	assert.Equal(t, frames, writer.Frames())
+	return file.Name(), jpegs, times
+}
+
+func TestAviRoundTrip(t *testing.T) {
+	name, jpegs, times := writeTestAvi(t, 0, 25)
+	file, err := os.Open(name)
+	assert.NoError(t, err)
+	defer file.Close()
+
+	reader, err := NewAviReader(file)
+	assert.NoError(t, err)
+	assert.Equal(t, 100, reader.Width)
+	assert.Equal(t, 100, reader.Height)
+	assert.Equal(t, 10.0, reader.Rate)
+	assert.Equal(t, 25, reader.Len())
+	for i := range jpegs {
+		jpeg, err := reader.Frame(i)
+		assert.NoError(t, err)
+		assert.Equal(t, jpegs[i], jpeg)
+		assert.Equal(t, times[i].UnixNano(), reader.Time(i).UnixNano())
+	}
+	assert.Equal(t, 2640*time.Millisecond+100*time.Millisecond, reader.Duration())
+	assert.Equal(t, 10, reader.Seek(1050*time.Millisecond))
+
+	data, err := os.ReadFile(name)
+	assert.NoError(t, err)
+	assert.Equal(t, "RIFF", string(data[:4]))
+	assert.Equal(t, uint32(len(data)-8), binary.LittleEndian.Uint32(data[4:]))
+	// total frames in avih and the stream length
+	assert.Equal(t, uint32(25), binary.LittleEndian.Uint32(data[48:]))
+	assert.Equal(t, uint32(100000), binary.LittleEndian.Uint32(data[32:]))
+	idx1 := bytes.Index(data, []byte("idx1"))
+	assert.Greater(t, idx1, 0)
+	assert.Equal(t, uint32(25*16), binary.LittleEndian.Uint32(data[idx1+4:]))
+}
+
+func TestAviOpenDML(t *testing.T) {
+	name, jpegs, _ := writeTestAvi(t, 8*1024, 40)
+	data, err := os.ReadFile(name)
+	assert.NoError(t, err)
+	riffs := bytes.Count(data, []byte("AVIX"))
+	assert.Greater(t, riffs, 1)
+	assert.Equal(t, riffs+1, bytes.Count(data, []byte(AVI_INDEX_CHUNK)))
+
+	// super index lists every RIFF and the frames add up
+	indx := bytes.Index(data, []byte("indx")) + 8
+	entries := int(binary.LittleEndian.Uint32(data[indx+4:]))
+	assert.Equal(t, riffs+1, entries)
+	total := 0
+	for i := 0; i < entries; i++ {
+		entry := indx + 24 + 16*i
+		offset := binary.LittleEndian.Uint64(data[entry:])
+		assert.Equal(t, AVI_INDEX_CHUNK, string(data[offset:offset+4]))
+		total += int(binary.LittleEndian.Uint32(data[entry+12:]))
+	}
+	assert.Equal(t, 40, total)
+
+	reader, err := NewAviReader(bytes.NewReader(data))
+	assert.NoError(t, err)
+	assert.Equal(t, 40, reader.Len())
+	last, err := reader.Frame(39)
+	assert.NoError(t, err)
+	assert.Equal(t, jpegs[39], last)
+}
+
+func TestAviUnfinished(t *testing.T) {
+	buf := &writeSeeker{}
+	writer, err := NewAviWriter(buf, 100, 100, 5)
+	assert.NoError(t, err)
+	jpeg := EmptyFrame(100, 100)
+	for i := 0; i < 3; i++ {
+		assert.NoError(t, writer.WriteFrame(jpeg, time.Now()))
+	}
+
+	// no indexes or sizes yet, and a frame cut off halfway
+	reader, err := NewAviReader(bytes.NewReader(buf.data[:len(buf.data)-100]))
+	assert.NoError(t, err)
+	assert.Equal(t, 2, reader.Len())
+	assert.Equal(t, 400*time.Millisecond, reader.Duration())
+}
+
+type writeSeeker struct {
+	data []byte
+	pos  int64
+}
+
+func (x *writeSeeker) Write(p []byte) (int, error) {
+	end := x.pos + int64(len(p))
+	if end > int64(len(x.data)) {
+		x.data = append(x.data, make([]byte, end-int64(len(x.data)))...)
+	}
+	copy(x.data[x.pos:], p)
+	x.pos = end
+	return len(p), nil
+}
+
+func (x *writeSeeker) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case 1:
+		offset += x.pos
+	case 2:
+		offset += int64(len(x.data))
+	}
+	x.pos = offset
+	return offset, nil
+}
@@ -0,0 +1,80 @@
+// Copyright © 2023 Sloan Childers
+package base
+
+import (
+	"sync"
+	"time"
+)
+
+// EncodedFrame is a finished JPEG shared read-only by every consumer of a camera.
+type EncodedFrame struct {
+	Jpeg []byte
+	Time time.Time
+	// capture number and driver, see Capture
+	Seq    uint64
+	Source string
+}
+
+// Broadcast hands each published value to every subscriber.  A subscriber that
+// falls behind only ever holds the newest value, so it can never stall the publisher.
+type Broadcast[T any] struct {
+	subscribers map[chan T]struct{}
+	last        T
+	mutex       sync.Mutex
+}
+
+func NewBroadcast[T any]() *Broadcast[T] {
+	return &Broadcast[T]{subscribers: make(map[chan T]struct{})}
+}
+
+// Subscribe returns a channel of published values and a function to release it.
+func (x *Broadcast[T]) Subscribe() (<-chan T, func()) {
+	ch := make(chan T, 1)
+	x.mutex.Lock()
+	x.subscribers[ch] = struct{}{}
+	x.mutex.Unlock()
+	return ch, func() {
+		x.mutex.Lock()
+		delete(x.subscribers, ch)
+		x.mutex.Unlock()
+	}
+}
+
+// Publish sends value to every subscriber and returns how many stale values were dropped.
+func (x *Broadcast[T]) Publish(value T) int {
+	x.mutex.Lock()
+	defer x.mutex.Unlock()
+	x.last = value
+	dropped := 0
+	for ch := range x.subscribers {
+		select {
+		case ch <- value:
+			continue
+		default:
+		}
+		// replace the value the subscriber hasn't picked up yet
+		select {
+		case <-ch:
+			dropped++
+		default:
+		}
+		select {
+		case ch <- value:
+		default:
+		}
+	}
+	return dropped
+}
+
+// Last returns the most recently published value.
+func (x *Broadcast[T]) Last() T {
+	x.mutex.Lock()
+	defer x.mutex.Unlock()
+	return x.last
+}
+
+func (x *Broadcast[T]) Subscribers() int {
+	x.mutex.Lock()
+	defer x.mutex.Unlock()
+	return len(x.subscribers)
+}
@@ -0,0 +1,29 @@
+// Copyright © 2023 Sloan Childers
+package base
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBroadcast(t *testing.T) {
+	broadcast := NewBroadcast[int]()
+	first, cancelFirst := broadcast.Subscribe()
+	second, cancelSecond := broadcast.Subscribe()
+	assert.Equal(t, 2, broadcast.Subscribers())
+
+	assert.Equal(t, 0, broadcast.Publish(1))
+	assert.Equal(t, 1, <-first)
+
+	// the second subscriber never read, so it only sees the newest value
+	assert.Equal(t, 1, broadcast.Publish(2))
+	assert.Equal(t, 2, <-second)
+	assert.Equal(t, 2, <-first)
+	assert.Equal(t, 2, broadcast.Last())
+
+	cancelFirst()
+	cancelSecond()
+	assert.Equal(t, 0, broadcast.Subscribers())
+	assert.Equal(t, 0, broadcast.Publish(3))
+}
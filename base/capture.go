@@ -0,0 +1,83 @@
+// Copyright © 2023 Sloan Childers
+package base
+
+import (
+	"sync"
+	"time"
+)
+
+// Capture is a frame as the driver captured it, before it is decoded.
+type Capture struct {
+	Image []byte
+	// image type of Frame.SetImage
+	Type int
+	// size of a raw image, the configured size when 0
+	Width  int
+	Height int
+	// when the frame was captured, not when it was grabbed
+	Time time.Time
+	// counts the captures of a driver from 1, 0 is a frame no driver captured
+	Seq uint64
+	// plugin of the driver
+	Source string
+}
+
+// IPublisher is a driver that pushes its frames as they are captured.
+type IPublisher interface {
+	Subscribe() (<-chan *Capture, func())
+}
+
+// Publisher numbers the captures of a driver and hands them to its subscribers.
+// Numbers go on across a Reset.
+type Publisher struct {
+	source string
+	seq    uint64
+	last   *Capture
+	frames *Broadcast[*Capture]
+	mutex  sync.Mutex
+}
+
+func NewPublisher(source string) *Publisher {
+	return &Publisher{
+		source: source,
+		frames: NewBroadcast[*Capture]()}
+}
+
+// Publish stamps capture with the next number and the source, and the time
+// unless the driver knows it better.
+func (x *Publisher) Publish(capture *Capture) *Capture {
+	x.mutex.Lock()
+	x.seq++
+	capture.Seq = x.seq
+	capture.Source = x.source
+	if capture.Time.IsZero() {
+		capture.Time = time.Now()
+	}
+	x.last = capture
+	x.mutex.Unlock()
+	x.frames.Publish(capture)
+	return capture
+}
+
+// Last is the latest capture, nil when there is none or the driver stopped.
+func (x *Publisher) Last() *Capture {
+	x.mutex.Lock()
+	defer x.mutex.Unlock()
+	return x.last
+}
+
+// Clear forgets the latest capture when the driver stops.
+func (x *Publisher) Clear() {
+	x.mutex.Lock()
+	defer x.mutex.Unlock()
+	x.last = nil
+}
+
+func (x *Publisher) Subscribe() (<-chan *Capture, func()) {
+	return x.frames.Subscribe()
+}
+
+// Frame decodes the latest capture, an empty frame without one.
+func (x *Publisher) Frame(config *CameraConfig) IFrame {
+	return NewCaptureFrame(config, x.Last())
+}
@@ -0,0 +1,46 @@
+// Copyright © 2023 Sloan Childers
+package base
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPublisher(t *testing.T) {
+	config := &CameraConfig{Name: "test", Width: 16, Height: 8}
+	x := NewPublisher("testsrc")
+	frames, release := x.Subscribe()
+	defer release()
+
+	// nothing captured yet
+	empty := x.Frame(config)
+	assert.Equal(t, uint64(0), empty.Seq())
+	empty.Close()
+
+	captured := time.Now().Add(-time.Second)
+	first := x.Publish(&Capture{Image: EmptyFrame(16, 8), Type: JPEG, Time: captured})
+	assert.Equal(t, uint64(1), first.Seq)
+	assert.Equal(t, "testsrc", first.Source)
+	assert.Equal(t, first, <-frames)
+
+	// grabbing twice is the same frame, not a new one
+	a, b := x.Frame(config), x.Frame(config)
+	assert.Equal(t, a.Seq(), b.Seq())
+	assert.Equal(t, captured, a.Time())
+	assert.Equal(t, captured, b.Time())
+	clone := a.Clone()
+	assert.Equal(t, uint64(1), clone.Seq())
+	assert.Equal(t, "testsrc", clone.Source())
+	a.Close()
+	b.Close()
+	clone.Close()
+
+	second := x.Publish(&Capture{Image: EmptyFrame(16, 8), Type: JPEG})
+	assert.Equal(t, uint64(2), second.Seq)
+	assert.False(t, second.Time.IsZero())
+	x.Clear()
+	assert.Nil(t, x.Last())
+	assert.Equal(t, uint64(3), x.Publish(&Capture{Image: EmptyFrame(16, 8), Type: JPEG}).Seq)
+}
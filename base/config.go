@@ -0,0 +1,143 @@
+// Copyright © 2023 Sloan Childers
+package base
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+var ErrInvalidConfig = errors.New("invalid configuration")
+
+// MergePatch applies an RFC 7396 JSON merge patch to the JSON document target.
+// Objects are merged member by member, null removes a member and anything else
+// replaces the target value, arrays included.
+func MergePatch(target, patch []byte) ([]byte, error) {
+	var doc, changes interface{}
+	err := decodeJSON(target, &doc)
+	if err != nil {
+		return nil, err
+	}
+	err = decodeJSON(patch, &changes)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(mergePatch(doc, changes))
+}
+
+func decodeJSON(data []byte, v interface{}) error {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	// keep numbers as written, a float64 round trip can change large integers
+	decoder.UseNumber()
+	return decoder.Decode(v)
+}
+
+func mergePatch(target, patch interface{}) interface{} {
+	changes, ok := patch.(map[string]interface{})
+	if !ok {
+		return patch
+	}
+	doc, ok := target.(map[string]interface{})
+	if !ok {
+		doc = map[string]interface{}{}
+	}
+	for key, value := range changes {
+		if value == nil {
+			delete(doc, key)
+			continue
+		}
+		doc[key] = mergePatch(doc[key], value)
+	}
+	return doc
+}
+
+func invalid(format string, args ...interface{}) error {
+	return fmt.Errorf("%w: %s", ErrInvalidConfig, fmt.Sprintf(format, args...))
+}
+
+// Validate checks the settings a driver can't start without and the ranges of the rest.
+func (x *CameraConfig) Validate() error {
+	if x.Uuid == "" {
+		return invalid("Uuid is required")
+	}
+	if x.Plugin == "" {
+		return invalid("Plugin is required")
+	}
+	if x.Width <= 0 || x.Height <= 0 {
+		return invalid("Width and Height must be positive")
+	}
+	if x.Rate <= 0 {
+		return invalid("Rate must be positive")
+	}
+	if x.Device < 0 {
+		return invalid("Device can't be negative")
+	}
+	if x.Port < 0 || x.Port > 65535 {
+		return invalid("Port %d out of range", x.Port)
+	}
+	if x.Channel < 0 {
+		return invalid("Channel can't be negative")
+	}
+	if x.Overlay != nil {
+		err := x.Overlay.Validate()
+		if err != nil {
+			return err
+		}
+	}
+	if !oneOf(strings.ToUpper(x.Format), "MJPG", "YUYV", "RGB3", "GREY") {
+		return invalid("Format must be MJPG, YUYV, RGB3 or GREY")
+	}
+	if !oneOf(x.Transport, "tcp", "udp") {
+		return invalid("Transport must be tcp or udp")
+	}
+	if x.Recording != nil && x.Recording.SegmentMinutes < 0 {
+		return invalid("Recording.SegmentMinutes can't be negative")
+	}
+	if x.Motion == nil {
+		return invalid("Motion is required")
+	}
+	return x.Motion.Validate()
+}
+
+func oneOf(value string, allowed ...string) bool {
+	if value == "" {
+		return true
+	}
+	for _, item := range allowed {
+		if value == item {
+			return true
+		}
+	}
+	return false
+}
+
+func (x *OverlayConfig) Validate() error {
+	if !oneOf(x.Position, "top", "bottom") {
+		return invalid("Overlay.Position must be top or bottom")
+	}
+	if !oneOf(x.TextColor, "white", "black") {
+		return invalid("Overlay.TextColor must be white or black")
+	}
+	if !oneOf(x.BackgroundColor, "white", "black", "transparent", "semitransparent") {
+		return invalid("Overlay.BackgroundColor must be white, black, transparent or semitransparent")
+	}
+	return nil
+}
+
+func (x *MotionConfig) Validate() error {
+	if x.Area < 0 || x.Detections < 0 || x.Overlap < 0 {
+		return invalid("Motion.Area, Detections and Overlap can't be negative")
+	}
+	if x.WindowSeconds < 0 || x.QuietSeconds < 0 || x.BeforeSeconds < 0 || x.AfterSeconds < 0 {
+		return invalid("Motion times can't be negative")
+	}
+	for i, mask := range x.Mask {
+		// parts outside the frame are clipped when the mask is drawn
+		if mask.Px1 < 0 || mask.Py1 < 0 || mask.Px1 >= mask.Px2 || mask.Py1 >= mask.Py2 {
+			return invalid("Motion.Mask[%d] needs a top left corner above and left of the bottom right", i)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,87 @@
+// Copyright © 2023 Sloan Childers
+package base
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMergePatch(t *testing.T) {
+	// examples from RFC 7396 appendix A
+	tests := []struct{ target, patch, result string }{
+		{`{"a":"b"}`, `{"a":"c"}`, `{"a":"c"}`},
+		{`{"a":"b"}`, `{"b":"c"}`, `{"a":"b","b":"c"}`},
+		{`{"a":"b"}`, `{"a":null}`, `{}`},
+		{`{"a":"b","b":"c"}`, `{"a":null}`, `{"b":"c"}`},
+		{`{"a":["b"]}`, `{"a":"c"}`, `{"a":"c"}`},
+		{`{"a":"c"}`, `{"a":["b"]}`, `{"a":["b"]}`},
+		{`{"a":{"b":"c"}}`, `{"a":{"b":"d","c":null}}`, `{"a":{"b":"d"}}`},
+		{`{"a":[{"b":"c"}]}`, `{"a":[1]}`, `{"a":[1]}`},
+		{`["a","b"]`, `["c","d"]`, `["c","d"]`},
+		{`{"a":"b"}`, `["c"]`, `["c"]`},
+		{`{"a":"foo"}`, `null`, `null`},
+		{`{"a":"foo"}`, `"bar"`, `"bar"`},
+		{`{"e":null}`, `{"a":1}`, `{"a":1,"e":null}`},
+		{`[1,2]`, `{"a":"b","c":null}`, `{"a":"b"}`},
+		{`{}`, `{"a":{"bb":{"ccc":null}}}`, `{"a":{"bb":{}}}`},
+	}
+	for _, test := range tests {
+		result, err := MergePatch([]byte(test.target), []byte(test.patch))
+		assert.NoError(t, err)
+		assert.JSONEq(t, test.result, string(result), test.patch)
+	}
+
+	_, err := MergePatch([]byte(`{}`), []byte(`{"a":`))
+	assert.Error(t, err)
+}
+
+func TestMergePatchConfig(t *testing.T) {
+	config := &CameraConfig{
+		Uuid:   "front",
+		Plugin: "opencv",
+		Width:  640,
+		Height: 480,
+		Rate:   10,
+		Motion: &MotionConfig{Enabled: true, Area: 200, Mask: []MotionRectangle{{0, 0, 10, 10}}}}
+	data, _ := json.Marshal(config)
+	data, err := MergePatch(data, []byte(`{"Width":1280,"Motion":{"Mask":[],"AfterSeconds":5},"Recording":{"Enabled":true}}`))
+	assert.NoError(t, err)
+
+	updated := &CameraConfig{}
+	assert.NoError(t, json.Unmarshal(data, updated))
+	assert.Equal(t, 1280, updated.Width)
+	assert.Equal(t, 480, updated.Height)
+	assert.True(t, updated.Motion.Enabled)
+	assert.Equal(t, 200.0, updated.Motion.Area)
+	assert.Empty(t, updated.Motion.Mask)
+	assert.Equal(t, 5, updated.Motion.AfterSeconds)
+	assert.True(t, updated.Recording.Enabled)
+	assert.NoError(t, updated.Validate())
+}
+
+func TestValidateConfig(t *testing.T) {
+	valid := func() *CameraConfig {
+		return &CameraConfig{Uuid: "front", Plugin: "opencv", Width: 640, Height: 480, Rate: 10, Motion: &MotionConfig{}}
+	}
+	assert.NoError(t, valid().Validate())
+
+	broken := []func(*CameraConfig){
+		func(x *CameraConfig) { x.Plugin = "" },
+		func(x *CameraConfig) { x.Width = 0 },
+		func(x *CameraConfig) { x.Rate = -1 },
+		func(x *CameraConfig) { x.Port = 70000 },
+		func(x *CameraConfig) { x.Motion = nil },
+		func(x *CameraConfig) { x.Motion.BeforeSeconds = -1 },
+		func(x *CameraConfig) { x.Motion.Mask = []MotionRectangle{{10, 10, 5, 20}} },
+		func(x *CameraConfig) { x.Recording = &RecordingConfig{SegmentMinutes: -5} },
+	}
+	for i, breakIt := range broken {
+		config := valid()
+		breakIt(config)
+		err := config.Validate()
+		assert.True(t, errors.Is(err, ErrInvalidConfig), i)
+	}
+}
@@ -0,0 +1,60 @@
+// Copyright © 2023 Sloan Childers
+package base
+
+import (
+	"errors"
+	"strings"
+)
+
+const (
+	CONTROL_INTEGER = "integer"
+	CONTROL_BOOLEAN = "boolean"
+	CONTROL_MENU    = "menu"
+	CONTROL_BUTTON  = "button"
+)
+
+var ErrControl = errors.New("invalid control")
+
+// Control is an image control of a camera, e.g. V4L2 brightness or exposure.
+type Control struct {
+	// Key names the control in the API and in camera.json, e.g. exposure_absolute
+	Key     string
+	Name    string
+	Type    string
+	Min     int32
+	Max     int32
+	Step    int32
+	Default int32
+	Value   int32
+	// names of the values of a menu
+	Menu     map[int32]string `json:"Menu,omitempty"`
+	ReadOnly bool             `json:"ReadOnly,omitempty"`
+	// e.g. manual exposure while exposure is automatic
+	Inactive bool `json:"Inactive,omitempty"`
+}
+
+// IControls is a driver of a camera with image controls.
+type IControls interface {
+	Controls() ([]Control, error)
+	// SetControls sets values by control key, automatic modes before the values they lock
+	SetControls(values map[string]int32) error
+}
+
+// ControlKey turns a control name into a key the way v4l2-ctl does,
+// "White Balance Temperature, Auto" is white_balance_temperature_auto.
+func ControlKey(name string) string {
+	key := strings.Builder{}
+	underscore := false
+	for _, char := range strings.ToLower(name) {
+		if (char >= 'a' && char <= 'z') || (char >= '0' && char <= '9') {
+			if underscore && key.Len() > 0 {
+				key.WriteByte('_')
+			}
+			key.WriteRune(char)
+			underscore = false
+		} else {
+			underscore = true
+		}
+	}
+	return key.String()
+}
@@ -0,0 +1,14 @@
+// Copyright © 2023 Sloan Childers
+package base
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestControlKey(t *testing.T) {
+	assert.Equal(t, "white_balance_temperature_auto", ControlKey("White Balance Temperature, Auto"))
+	assert.Equal(t, "exposure_absolute", ControlKey("Exposure (Absolute)"))
+	assert.Equal(t, "power_line_frequency", ControlKey(" Power Line  Frequency"))
+}
@@ -0,0 +1,150 @@
+// Copyright © 2023 Sloan Childers
+package base
+
+import (
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	DEFAULT_WINDOW_SECONDS = 2
+	DEFAULT_QUIET_SECONDS  = 5
+	EVENT_HISTORY_SIZE     = 50
+)
+
+type MotionEvent struct {
+	Id         string
+	Start      time.Time
+	End        *time.Time `json:",omitempty"`
+	LastMotion time.Time
+	Detections int
+}
+
+func (x MotionEvent) Active() bool {
+	return x.End == nil
+}
+
+// EventTracker turns single frame detections into motion events.  An event starts
+// after Detections detections within WindowSeconds, stays active while motion
+// continues and ends once QuietSeconds pass without any detection.
+type EventTracker struct {
+	config  *CameraConfig
+	hits    []time.Time
+	current *MotionEvent
+	history []MotionEvent
+	mutex   sync.Mutex
+}
+
+func NewEventTracker(config *CameraConfig) *EventTracker {
+	return &EventTracker{config: config}
+}
+
+// SetConfig replaces the configuration, the current event and history carry on.
+func (x *EventTracker) SetConfig(config *CameraConfig) {
+	x.mutex.Lock()
+	defer x.mutex.Unlock()
+	x.config = config
+}
+
+func (x *EventTracker) window() time.Duration {
+	if x.config.Motion.WindowSeconds <= 0 {
+		return DEFAULT_WINDOW_SECONDS * time.Second
+	}
+	return time.Duration(x.config.Motion.WindowSeconds) * time.Second
+}
+
+func (x *EventTracker) quiet() time.Duration {
+	if x.config.Motion.QuietSeconds <= 0 {
+		return DEFAULT_QUIET_SECONDS * time.Second
+	}
+	return time.Duration(x.config.Motion.QuietSeconds) * time.Second
+}
+
+// Update records the result of one analysed frame and returns the event that
+// started or ended because of it, if any.
+func (x *EventTracker) Update(detected bool, at time.Time) (started *MotionEvent, ended *MotionEvent) {
+	x.mutex.Lock()
+	defer x.mutex.Unlock()
+
+	if x.current != nil {
+		if detected {
+			x.current.LastMotion = at
+			x.current.Detections++
+			return nil, nil
+		}
+		if at.Sub(x.current.LastMotion) >= x.quiet() {
+			return nil, x.end(x.current.LastMotion.Add(x.quiet()))
+		}
+		return nil, nil
+	}
+
+	// forget detections that fell out of the window
+	cutoff := at.Add(-x.window())
+	hits := x.hits[:0]
+	for _, hit := range x.hits {
+		if hit.After(cutoff) {
+			hits = append(hits, hit)
+		}
+	}
+	x.hits = hits
+	if !detected {
+		return nil, nil
+	}
+
+	x.hits = append(x.hits, at)
+	if len(x.hits) < x.config.Motion.Detections {
+		return nil, nil
+	}
+	x.current = &MotionEvent{
+		Id:         uuid.NewString(),
+		Start:      x.hits[0],
+		LastMotion: at,
+		Detections: len(x.hits)}
+	x.hits = nil
+	event := *x.current
+	return &event, nil
+}
+
+// Close ends the active event, if any, for instance when the camera stops.
+func (x *EventTracker) Close(at time.Time) *MotionEvent {
+	x.mutex.Lock()
+	defer x.mutex.Unlock()
+	x.hits = nil
+	if x.current == nil {
+		return nil
+	}
+	return x.end(at)
+}
+
+func (x *EventTracker) end(at time.Time) *MotionEvent {
+	event := *x.current
+	event.End = &at
+	x.current = nil
+	x.history = append(x.history, event)
+	if len(x.history) > EVENT_HISTORY_SIZE {
+		x.history = x.history[len(x.history)-EVENT_HISTORY_SIZE:]
+	}
+	return &event
+}
+
+// Current returns a copy of the active event, or nil when there is none.
+func (x *EventTracker) Current() *MotionEvent {
+	x.mutex.Lock()
+	defer x.mutex.Unlock()
+	if x.current == nil {
+		return nil
+	}
+	event := *x.current
+	return &event
+}
+
+// History returns the most recent finished events, oldest first.
+func (x *EventTracker) History() []MotionEvent {
+	x.mutex.Lock()
+	defer x.mutex.Unlock()
+	out := make([]MotionEvent, len(x.history))
+	copy(out, x.history)
+	return out
+}
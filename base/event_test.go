@@ -0,0 +1,70 @@
+// Copyright © 2023 Sloan Childers
+package base
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestTracker(detections int) *EventTracker {
+	return NewEventTracker(&CameraConfig{Motion: &MotionConfig{
+		Detections:    detections,
+		WindowSeconds: 2,
+		QuietSeconds:  5}})
+}
+
+func TestEventTrackerNeedsDetections(t *testing.T) {
+	tracker := newTestTracker(3)
+	now := time.Now()
+
+	// a single noisy frame is not an event
+	started, _ := tracker.Update(true, now)
+	assert.Nil(t, started)
+	started, _ = tracker.Update(false, now.Add(100*time.Millisecond))
+	assert.Nil(t, started)
+
+	// detections spread over more than the window don't add up
+	started, _ = tracker.Update(true, now.Add(3*time.Second))
+	assert.Nil(t, started)
+	started, _ = tracker.Update(true, now.Add(3500*time.Millisecond))
+	assert.Nil(t, started)
+	assert.Nil(t, tracker.Current())
+
+	started, _ = tracker.Update(true, now.Add(4*time.Second))
+	assert.NotNil(t, started)
+	assert.NotEmpty(t, started.Id)
+	assert.True(t, started.Active())
+	assert.Equal(t, now.Add(3*time.Second), started.Start)
+	assert.Equal(t, 3, started.Detections)
+}
+
+func TestEventTrackerCooldown(t *testing.T) {
+	tracker := newTestTracker(1)
+	now := time.Now()
+
+	started, _ := tracker.Update(true, now)
+	assert.NotNil(t, started)
+
+	// motion keeps the same event alive
+	started, ended := tracker.Update(true, now.Add(4*time.Second))
+	assert.Nil(t, started)
+	assert.Nil(t, ended)
+	_, ended = tracker.Update(false, now.Add(8*time.Second))
+	assert.Nil(t, ended)
+	assert.Equal(t, 2, tracker.Current().Detections)
+
+	_, ended = tracker.Update(false, now.Add(9*time.Second))
+	assert.NotNil(t, ended)
+	assert.False(t, ended.Active())
+	assert.Equal(t, now.Add(9*time.Second), *ended.End)
+	assert.Nil(t, tracker.Current())
+	assert.Len(t, tracker.History(), 1)
+
+	started, _ = tracker.Update(true, now.Add(10*time.Second))
+	assert.NotNil(t, started)
+	assert.NotEqual(t, ended.Id, started.Id)
+	assert.NotNil(t, tracker.Close(now.Add(11*time.Second)))
+	assert.Len(t, tracker.History(), 2)
+}
@@ -12,6 +12,16 @@ type Size struct {
 type Format struct {
 	Name  string
 	Sizes []Size
+	// network cameras, degrees the image can be rotated by
+	Rotations []int `json:"Rotations,omitempty"`
+	// network cameras, JPEG compression from Min to Max, Default is the current setting
+	Compression *Range `json:"Compression,omitempty"`
+}
+
+type Range struct {
+	Min     int
+	Max     int
+	Default int
 }
 type Formats struct {
 	Formats []Format
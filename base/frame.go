@@ -21,7 +21,10 @@ type Frame struct {
 	img       gocv.Mat
 	jpeg      []byte
 	frameTime time.Time
-	mutex     sync.Mutex
+	// capture number and driver, 0 and empty for frames no driver captured
+	seq    uint64
+	source string
+	mutex  sync.Mutex
 }
 
 func NewFrame(config *CameraConfig) IFrame {
@@ -39,13 +42,47 @@ func (x *Frame) Clone() IFrame {
 		width:     x.width,
 		height:    x.height,
 		img:       x.img.Clone(),
-		frameTime: x.frameTime}
+		frameTime: x.frameTime,
+		seq:       x.seq,
+		source:    x.source}
 }
 
+// NewCaptureFrame decodes capture into a frame with its time, number and
+// source, an empty frame without a capture.
+func NewCaptureFrame(config *CameraConfig, capture *Capture) IFrame {
+	if capture == nil {
+		frame := NewFrame(config)
+		frame.SetImage(EmptyFrame(config.Width, config.Height), JPEG)
+		return frame
+	}
+	frame := &Frame{
+		name:      config.Name,
+		width:     config.Width,
+		height:    config.Height,
+		img:       gocv.NewMat(),
+		frameTime: capture.Time,
+		seq:       capture.Seq,
+		source:    capture.Source}
+	if capture.Width > 0 && capture.Height > 0 {
+		frame.width, frame.height = capture.Width, capture.Height
+	}
+	frame.SetImage(capture.Image, capture.Type)
+	return frame
+}
+
+// Time is when the frame was captured, or made for frames no driver captured.
 func (x *Frame) Time() time.Time {
 	return x.frameTime
 }
 
+func (x *Frame) Seq() uint64 {
+	return x.seq
+}
+
+func (x *Frame) Source() string {
+	return x.source
+}
+
 func (x *Frame) Close() {
 	x.img.Close()
 }
@@ -86,8 +123,28 @@ func (x *Frame) SetImage(img interface{}, typeCode int) {
 			gocv.IMWrite("jpeg.jpg", data)
 			os.Exit(0)
 		}
+	case BMP:
+		data = gocv.NewMat()
+		err := gocv.IMDecodeIntoMat(img.([]byte), gocv.IMReadColor, &data)
+		if err != nil {
+			log.Error().Err(err).Str("component", "frame").Str("name", x.name).Msg("BMP decode with OpenCV")
+		}
+	case RGB24, YUV422, GREY, BGR24:
+		bgr, err := ToBGR(img.([]byte), typeCode, x.width, x.height)
+		if err == nil {
+			var view gocv.Mat
+			// the Mat points into bgr, keep a copy OpenCV owns
+			view, err = gocv.NewMatFromBytes(x.height, x.width, gocv.MatTypeCV8UC3, bgr)
+			if err == nil {
+				data = view.Clone()
+				view.Close()
+			}
+		}
+		if err != nil {
+			log.Error().Err(err).Str("component", "frame").Str("name", x.name).Int("type", typeCode).Msg("raw frame")
+			data = gocv.NewMat()
+		}
 	}
-	x.frameTime = time.Now()
 	x.img.Close()
 	x.img = data
 }
@@ -45,3 +45,19 @@ func TestFrame_SetImage(t *testing.T) {
 		t.Errorf("Image data was not set correctly")
 	}
 }
+
+func TestFrame_SetImageRaw(t *testing.T) {
+	frame := NewFrame(&CameraConfig{Width: 2, Height: 1})
+	defer frame.Close()
+
+	frame.SetImage([]byte{10, 20, 30, 40, 50, 60}, RGB24)
+	if !bytes.Equal(frame.ToBytes(), []byte{30, 20, 10, 60, 50, 40}) {
+		t.Errorf("RGB24 frame was not converted to BGR")
+	}
+
+	// too short for 2x1, left empty
+	frame.SetImage([]byte{16, 128}, YUV422)
+	if !frame.Empty() {
+		t.Errorf("short YUV422 frame was not rejected")
+	}
+}
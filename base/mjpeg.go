@@ -2,8 +2,15 @@
 package base
 
 import (
+	"bufio"
+	"bytes"
+	"errors"
 	"fmt"
 	"io"
+	"mime"
+	"net/textproto"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/rs/zerolog/log"
@@ -71,17 +78,141 @@ const (
 
 func ValidateJPEG(data []byte) bool {
 	size := len(data)
+	if size < 4 {
+		return false
+	}
 	if (data[0] == JPEG_MARKER) && (data[1] == JPEG_SOI) && (data[size-2] == JPEG_MARKER) && (data[size-1] == JPEG_EOI) {
 		return true
 	}
 	return false
 }
 
+// image types of Frame.SetImage, the raw ones are Width x Height frames of a camera
 const (
-	GRAYSCALE8 = 0
+	GRAYSCALE8 = 0 // JPEG decoded to grey
 	JPEG       = 1
-	RGB24      = 2
+	RGB24      = 2 // raw, R G B
 	BMP        = 3
-	YUV422     = 4
+	YUV422     = 4 // raw, Y0 U Y1 V as V4L2 YUYV
 	GOCV       = 5
+	GREY       = 6 // raw, 8 bit luma
+	BGR24      = 7 // raw, B G R as OpenCV keeps it
 )
+
+// largest part an MjpegReader accepts
+const MJPEG_MAX_FRAME = 16 << 20
+
+var ErrMjpegFrame = errors.New("bad MJPEG part")
+
+// MjpegReader reads the JPEGs of a multipart MJPEG stream or capture.  Cameras are
+// loose about boundaries, so any line of "--" followed by the boundary starts a
+// part, and any "--" line at all when the boundary isn't known.  A part is read by
+// its Content-Length, or from its SOI to its EOI marker when that is missing.
+type MjpegReader struct {
+	reader   *bufio.Reader
+	text     *textproto.Reader
+	boundary string
+	// headers of the last part read
+	Header textproto.MIMEHeader
+}
+
+func NewMjpegReader(r io.Reader, boundary string) *MjpegReader {
+	reader := bufio.NewReader(r)
+	return &MjpegReader{
+		reader:   reader,
+		text:     textproto.NewReader(reader),
+		boundary: strings.TrimLeft(boundary, "-")}
+}
+
+// MjpegBoundary returns the boundary of a multipart Content-Type, or "" if it has none.
+func MjpegBoundary(contentType string) string {
+	_, params, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return ""
+	}
+	return strings.TrimLeft(params["boundary"], "-")
+}
+
+// Next returns the JPEG of the next part, io.EOF at the end of the stream.
+func (x *MjpegReader) Next() ([]byte, error) {
+	err := x.skipToBoundary()
+	if err != nil {
+		return nil, err
+	}
+	x.Header, err = x.text.ReadMIMEHeader()
+	if err != nil {
+		return nil, err
+	}
+	if value := x.Header.Get("Content-Length"); value != "" {
+		length, err := strconv.Atoi(strings.TrimSpace(value))
+		if err == nil && length > 0 && length <= MJPEG_MAX_FRAME {
+			jpeg := make([]byte, length)
+			_, err = io.ReadFull(x.reader, jpeg)
+			if err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			return jpeg, err
+		}
+	}
+	return x.readMarkers()
+}
+
+func (x *MjpegReader) skipToBoundary() error {
+	for {
+		line, err := x.reader.ReadSlice('\n')
+		if err == bufio.ErrBufferFull {
+			// not a boundary, skip the rest of the line
+			for err == bufio.ErrBufferFull {
+				_, err = x.reader.ReadSlice('\n')
+			}
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		line = bytes.TrimSpace(line)
+		if !bytes.HasPrefix(line, []byte("--")) {
+			continue
+		}
+		name := strings.TrimRight(strings.TrimLeft(string(line), "-"), "-")
+		if x.boundary == "" || name == x.boundary {
+			return nil
+		}
+	}
+}
+
+// readMarkers reads a JPEG from its SOI to the matching EOI, thumbnails included.
+func (x *MjpegReader) readMarkers() ([]byte, error) {
+	jpeg := bytes.Buffer{}
+	depth := 0
+	var last byte
+	for jpeg.Len() <= MJPEG_MAX_FRAME {
+		b, err := x.reader.ReadByte()
+		if err != nil {
+			if err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			return nil, err
+		}
+		if depth == 0 {
+			if last == JPEG_MARKER && b == JPEG_SOI {
+				jpeg.Write([]byte{JPEG_MARKER, JPEG_SOI})
+				depth = 1
+			}
+			last = b
+			continue
+		}
+		jpeg.WriteByte(b)
+		if last == JPEG_MARKER && b == JPEG_SOI {
+			depth++
+		}
+		if last == JPEG_MARKER && b == JPEG_EOI {
+			depth--
+			if depth == 0 {
+				return jpeg.Bytes(), nil
+			}
+		}
+		last = b
+	}
+	return nil, ErrMjpegFrame
+}
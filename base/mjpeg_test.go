@@ -0,0 +1,53 @@
+// Copyright © 2023 Sloan Childers
+package base
+
+import (
+	"bytes"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMjpegReader(t *testing.T) {
+	first := EmptyFrame(16, 16)
+	second := EmptyFrame(32, 16)
+	stream := &bytes.Buffer{}
+	WriteMjpeg(stream, first)
+	WriteMjpeg(stream, second)
+
+	reader := NewMjpegReader(bytes.NewReader(stream.Bytes()), "")
+	jpeg, err := reader.Next()
+	assert.NoError(t, err)
+	assert.Equal(t, first, jpeg)
+	assert.Equal(t, "image/jpeg", reader.Header.Get("Content-Type"))
+	jpeg, err = reader.Next()
+	assert.NoError(t, err)
+	assert.Equal(t, second, jpeg)
+	_, err = reader.Next()
+	assert.Equal(t, io.EOF, err)
+}
+
+func TestMjpegReaderWithoutLength(t *testing.T) {
+	// a thumbnail inside the first JPEG must not end it early
+	thumbnail := EmptyFrame(4, 4)
+	first := append(append([]byte{JPEG_MARKER, JPEG_SOI, JPEG_MARKER, 0xE1}, thumbnail...), EmptyFrame(16, 16)[2:]...)
+	second := EmptyFrame(32, 16)
+
+	stream := &bytes.Buffer{}
+	stream.WriteString("preamble\r\n--frame\r\nContent-Type: image/jpeg\r\n\r\n")
+	stream.Write(first)
+	stream.WriteString("\r\n--other\r\nContent-Type: text/plain\r\n\r\nnot a frame\r\n")
+	stream.WriteString("--frame\r\nContent-Type: image/jpeg\r\n\r\n")
+	stream.Write(second)
+	stream.WriteString("\r\n--frame--\r\n")
+
+	assert.Equal(t, "frame", MjpegBoundary("multipart/x-mixed-replace; boundary=--frame"))
+	reader := NewMjpegReader(bytes.NewReader(stream.Bytes()), "frame")
+	jpeg, err := reader.Next()
+	assert.NoError(t, err)
+	assert.Equal(t, first, jpeg)
+	jpeg, err = reader.Next()
+	assert.NoError(t, err)
+	assert.Equal(t, second, jpeg)
+}
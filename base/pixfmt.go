@@ -0,0 +1,123 @@
+// Copyright © 2023 Sloan Childers
+package base
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Converters of raw camera frames to the BGR OpenCV works in.  Rows may be padded,
+// the stride is whatever the buffer holds per row beyond the pixels.
+
+var ErrPixelFormat = errors.New("raw frame too short")
+var ErrOddWidth = errors.New("YUYV frame of odd width")
+
+// stride checks data holds height rows of at least width*bytes bytes.
+func stride(data []byte, width, height, bytes int) (int, error) {
+	if width <= 0 || height <= 0 || len(data) < width*height*bytes {
+		return 0, fmt.Errorf("%w: %d bytes for %dx%d", ErrPixelFormat, len(data), width, height)
+	}
+	return len(data) / height, nil
+}
+
+func clamp(value int) byte {
+	if value < 0 {
+		return 0
+	}
+	if value > 255 {
+		return 255
+	}
+	return byte(value)
+}
+
+// YUYVToBGR converts 4:2:2 YUYV with BT.601 studio swing, as webcams send it.
+// Pixels come in pairs, V4L2 has no YUYV of odd width.
+func YUYVToBGR(data []byte, width, height int) ([]byte, error) {
+	if width%2 != 0 {
+		return nil, fmt.Errorf("%w: %d", ErrOddWidth, width)
+	}
+	rowSize, err := stride(data, width, height, 2)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]byte, width*height*3)
+	for y := 0; y < height; y++ {
+		row := data[y*rowSize:]
+		pixels := out[y*width*3:]
+		for x := 0; x < width; x++ {
+			// each pair of pixels shares U and V
+			pair := row[(x/2)*4:]
+			c := 298 * (int(row[x*2]) - 16)
+			d := int(pair[1]) - 128
+			e := int(pair[3]) - 128
+			pixels[x*3] = clamp((c + 516*d + 128) >> 8)
+			pixels[x*3+1] = clamp((c - 100*d - 208*e + 128) >> 8)
+			pixels[x*3+2] = clamp((c + 409*e + 128) >> 8)
+		}
+	}
+	return out, nil
+}
+
+func RGBToBGR(data []byte, width, height int) ([]byte, error) {
+	rowSize, err := stride(data, width, height, 3)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]byte, width*height*3)
+	for y := 0; y < height; y++ {
+		row := data[y*rowSize:]
+		pixels := out[y*width*3:]
+		for x := 0; x < width*3; x += 3 {
+			pixels[x], pixels[x+1], pixels[x+2] = row[x+2], row[x+1], row[x]
+		}
+	}
+	return out, nil
+}
+
+// packBGR drops the padding of the rows, OpenCV wants them back to back.
+func packBGR(data []byte, width, height int) ([]byte, error) {
+	rowSize, err := stride(data, width, height, 3)
+	if err != nil {
+		return nil, err
+	}
+	if rowSize == width*3 {
+		return data[:width*height*3], nil
+	}
+	out := make([]byte, width*height*3)
+	for y := 0; y < height; y++ {
+		copy(out[y*width*3:(y+1)*width*3], data[y*rowSize:])
+	}
+	return out, nil
+}
+
+func GreyToBGR(data []byte, width, height int) ([]byte, error) {
+	rowSize, err := stride(data, width, height, 1)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]byte, width*height*3)
+	for y := 0; y < height; y++ {
+		row := data[y*rowSize:]
+		pixels := out[y*width*3:]
+		for x := 0; x < width; x++ {
+			pixels[x*3], pixels[x*3+1], pixels[x*3+2] = row[x], row[x], row[x]
+		}
+	}
+	return out, nil
+}
+
+// ToBGR converts a raw frame of image type RGB24, YUV422 or GREY, BGR24 is
+// passed through unless its rows are padded.
+func ToBGR(data []byte, typeCode, width, height int) ([]byte, error) {
+	switch typeCode {
+	case BGR24:
+		return packBGR(data, width, height)
+	case RGB24:
+		return RGBToBGR(data, width, height)
+	case YUV422:
+		return YUYVToBGR(data, width, height)
+	case GREY:
+		return GreyToBGR(data, width, height)
+	}
+	return nil, fmt.Errorf("image type %d is not raw", typeCode)
+}
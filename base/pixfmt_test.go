@@ -0,0 +1,72 @@
+// Copyright © 2023 Sloan Childers
+package base
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func near(t *testing.T, want, got []byte) {
+	assert.Equal(t, len(want), len(got))
+	for i := range want {
+		diff := int(want[i]) - int(got[i])
+		assert.True(t, diff >= -2 && diff <= 2, "byte %d: want %d got %d", i, want[i], got[i])
+	}
+}
+
+func TestYUYVToBGR(t *testing.T) {
+	// black, white, red and blue in BT.601 studio swing, one pair of pixels each
+	data := []byte{
+		16, 128, 16, 128,
+		235, 128, 235, 128,
+		81, 90, 81, 240,
+		41, 240, 41, 110,
+	}
+	out, err := YUYVToBGR(data, 4, 2)
+	assert.NoError(t, err)
+	near(t, []byte{
+		0, 0, 0, 0, 0, 0,
+		255, 255, 255, 255, 255, 255,
+		0, 0, 255, 0, 0, 255,
+		255, 0, 0, 255, 0, 0,
+	}, out)
+
+	_, err = YUYVToBGR(data[:15], 4, 2)
+	assert.ErrorIs(t, err, ErrPixelFormat)
+	// the last pixel would have no pair
+	_, err = YUYVToBGR(data, 3, 2)
+	assert.ErrorIs(t, err, ErrOddWidth)
+}
+
+func TestRGBToBGR(t *testing.T) {
+	// two rows of two pixels, each row padded to 8 bytes
+	data := []byte{
+		1, 2, 3, 4, 5, 6, 0, 0,
+		7, 8, 9, 10, 11, 12, 0, 0,
+	}
+	out, err := RGBToBGR(data, 2, 2)
+	assert.NoError(t, err)
+	assert.Equal(t, []byte{3, 2, 1, 6, 5, 4, 9, 8, 7, 12, 11, 10}, out)
+
+	out, err = ToBGR(data, RGB24, 2, 2)
+	assert.NoError(t, err)
+	assert.Equal(t, []byte{3, 2, 1, 6, 5, 4, 9, 8, 7, 12, 11, 10}, out)
+
+	// BGR is passed through without the padding
+	out, err = ToBGR(data, BGR24, 2, 2)
+	assert.NoError(t, err)
+	assert.Equal(t, []byte{1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12}, out)
+	out, err = ToBGR(data[:12], BGR24, 2, 2)
+	assert.NoError(t, err)
+	assert.Equal(t, data[:12], out)
+}
+
+func TestGreyToBGR(t *testing.T) {
+	out, err := GreyToBGR([]byte{0, 128, 255}, 3, 1)
+	assert.NoError(t, err)
+	assert.Equal(t, []byte{0, 0, 0, 128, 128, 128, 255, 255, 255}, out)
+
+	_, err = ToBGR([]byte{0}, JPEG, 1, 1)
+	assert.Error(t, err)
+}
@@ -0,0 +1,74 @@
+// Copyright © 2023 Sloan Childers
+package base
+
+import (
+	"errors"
+	"fmt"
+)
+
+const (
+	PTZ_ZOOM_MIN  = 1
+	PTZ_ZOOM_MAX  = 9999
+	PTZ_SPEED_MAX = 100
+)
+
+var ErrPTZUnsupported = errors.New("camera has no pan/tilt/zoom")
+var ErrPTZInvalid = errors.New("invalid pan/tilt/zoom request")
+
+// PTZMove is a move to a position, or by an amount when Relative.  Pan and Tilt
+// are degrees, Zoom runs from PTZ_ZOOM_MIN to PTZ_ZOOM_MAX.  Missing axes stay put.
+type PTZMove struct {
+	Pan      *float64
+	Tilt     *float64
+	Zoom     *int
+	Relative bool
+}
+
+// IPTZ is a driver of a camera with pan, tilt and zoom.
+type IPTZ interface {
+	Move(PTZMove) error
+	// Continuous moves at speeds of -PTZ_SPEED_MAX to PTZ_SPEED_MAX, all zero stops
+	Continuous(pan, tilt, zoom int) error
+	GotoPreset(name string) error
+	SavePreset(name string) error
+	Presets() ([]string, error)
+}
+
+func ptzInvalid(format string, args ...interface{}) error {
+	return fmt.Errorf("%w: %s", ErrPTZInvalid, fmt.Sprintf(format, args...))
+}
+
+func (x *PTZMove) Validate() error {
+	if x.Pan == nil && x.Tilt == nil && x.Zoom == nil {
+		return ptzInvalid("pan, tilt or zoom is required")
+	}
+	limit := 180.0
+	if x.Relative {
+		limit = 360
+	}
+	if x.Pan != nil && (*x.Pan < -limit || *x.Pan > limit) {
+		return ptzInvalid("pan %g out of range", *x.Pan)
+	}
+	if x.Tilt != nil && (*x.Tilt < -limit || *x.Tilt > limit) {
+		return ptzInvalid("tilt %g out of range", *x.Tilt)
+	}
+	if x.Zoom != nil {
+		min, max := PTZ_ZOOM_MIN, PTZ_ZOOM_MAX
+		if x.Relative {
+			min, max = -PTZ_ZOOM_MAX, PTZ_ZOOM_MAX
+		}
+		if *x.Zoom < min || *x.Zoom > max {
+			return ptzInvalid("zoom %d out of range", *x.Zoom)
+		}
+	}
+	return nil
+}
+
+func ValidateSpeeds(speeds ...int) error {
+	for _, speed := range speeds {
+		if speed < -PTZ_SPEED_MAX || speed > PTZ_SPEED_MAX {
+			return ptzInvalid("speed %d out of range", speed)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,89 @@
+// Copyright © 2023 Sloan Childers
+package base
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+)
+
+var ErrUnknownPlugin = errors.New("unknown plugin")
+
+// Factory creates the driver of a camera.
+type Factory func(config *CameraConfig) IDriver
+
+// PluginField is a CameraConfig field a plugin reads on top of the common ones,
+// a driver isn't created while a Required one has its zero value.
+type PluginField struct {
+	Name        string
+	Type        string
+	Required    bool `json:"Required,omitempty"`
+	Description string
+}
+
+// Plugin is a driver as registered by its package.
+type Plugin struct {
+	Name        string
+	Description string
+	Config      []PluginField
+	New         Factory `json:"-"`
+}
+
+var registry = struct {
+	plugins map[string]Plugin
+	mutex   sync.RWMutex
+}{plugins: map[string]Plugin{}}
+
+// Register makes a plugin available by name, from the init of its package.
+func Register(plugin Plugin) {
+	registry.mutex.Lock()
+	defer registry.mutex.Unlock()
+	if plugin.New == nil {
+		panic("plugin " + plugin.Name + " registered without a factory")
+	}
+	for _, field := range plugin.Config {
+		if _, ok := reflect.TypeOf(CameraConfig{}).FieldByName(field.Name); !ok {
+			panic("plugin " + plugin.Name + " registered with unknown field " + field.Name)
+		}
+	}
+	if _, ok := registry.plugins[plugin.Name]; ok {
+		panic("plugin " + plugin.Name + " registered twice")
+	}
+	registry.plugins[plugin.Name] = plugin
+}
+
+// Plugins lists the registered plugins by name.
+func Plugins() []Plugin {
+	registry.mutex.RLock()
+	defer registry.mutex.RUnlock()
+	plugins := []Plugin{}
+	for _, plugin := range registry.plugins {
+		plugins = append(plugins, plugin)
+	}
+	sort.Slice(plugins, func(i, j int) bool { return plugins[i].Name < plugins[j].Name })
+	return plugins
+}
+
+// NewPluginDriver creates the driver of config.Plugin, the error names the
+// plugins there are.
+func NewPluginDriver(config *CameraConfig) (IDriver, error) {
+	registry.mutex.RLock()
+	plugin, ok := registry.plugins[config.Plugin]
+	registry.mutex.RUnlock()
+	if !ok {
+		names := []string{}
+		for _, plugin := range Plugins() {
+			names = append(names, plugin.Name)
+		}
+		return nil, fmt.Errorf("%w %q, valid plugins are %s", ErrUnknownPlugin, config.Plugin, strings.Join(names, ", "))
+	}
+	for _, field := range plugin.Config {
+		if field.Required && reflect.ValueOf(config).Elem().FieldByName(field.Name).IsZero() {
+			return nil, invalid("%s is required by plugin %s", field.Name, plugin.Name)
+		}
+	}
+	return plugin.New(config), nil
+}
@@ -0,0 +1,65 @@
+// Copyright © 2023 Sloan Childers
+package base
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRegistry(t *testing.T) {
+	factory := func(config *CameraConfig) IDriver { return &fakeDriver{config: config} }
+	Register(Plugin{Name: "fake-b", Description: "second", New: factory})
+	Register(Plugin{Name: "fake-a", Description: "first", New: factory})
+	defer func() {
+		registry.mutex.Lock()
+		delete(registry.plugins, "fake-a")
+		delete(registry.plugins, "fake-b")
+		registry.mutex.Unlock()
+	}()
+
+	names := []string{}
+	for _, plugin := range Plugins() {
+		names = append(names, plugin.Name)
+	}
+	assert.Equal(t, []string{"fake-a", "fake-b"}, names)
+
+	config := &CameraConfig{Plugin: "fake-a"}
+	driver, err := NewPluginDriver(config)
+	assert.NoError(t, err)
+	assert.Equal(t, config, driver.(*fakeDriver).config)
+
+	_, err = NewPluginDriver(&CameraConfig{Plugin: "fake-c"})
+	assert.True(t, errors.Is(err, ErrUnknownPlugin))
+	assert.True(t, strings.HasSuffix(err.Error(), `"fake-c", valid plugins are fake-a, fake-b`), err.Error())
+
+	assert.Panics(t, func() { Register(Plugin{Name: "fake-a", New: factory}) })
+	assert.Panics(t, func() { Register(Plugin{Name: "fake-d"}) })
+	assert.Panics(t, func() {
+		Register(Plugin{Name: "fake-e", Config: []PluginField{{Name: "Address"}}, New: factory})
+	})
+}
+
+func TestRegistryRequired(t *testing.T) {
+	factory := func(config *CameraConfig) IDriver { return &fakeDriver{config: config} }
+	Register(Plugin{Name: "fake-net", New: factory, Config: []PluginField{
+		{Name: "Addr", Type: "string", Required: true},
+		{Name: "Port", Type: "int", Required: true},
+		{Name: "Uri", Type: "string"},
+	}})
+	defer func() {
+		registry.mutex.Lock()
+		delete(registry.plugins, "fake-net")
+		registry.mutex.Unlock()
+	}()
+
+	_, err := NewPluginDriver(&CameraConfig{Plugin: "fake-net", Port: 80})
+	assert.True(t, errors.Is(err, ErrInvalidConfig))
+	assert.Contains(t, err.Error(), "Addr is required by plugin fake-net")
+	_, err = NewPluginDriver(&CameraConfig{Plugin: "fake-net", Addr: "camera"})
+	assert.Contains(t, err.Error(), "Port is required")
+	_, err = NewPluginDriver(&CameraConfig{Plugin: "fake-net", Addr: "camera", Port: 80})
+	assert.NoError(t, err)
+}
@@ -0,0 +1,129 @@
+// Copyright © 2023 Sloan Childers
+package base
+
+import (
+	"sync"
+	"time"
+)
+
+const (
+	// seconds a Meter rate is averaged over
+	STATS_WINDOW = 10
+	// weight of the latest duration in the mean of a Timing
+	STATS_WEIGHT = 0.1
+)
+
+// Meter counts events, and their rate per second over the last STATS_WINDOW
+// whole seconds.  The zero Meter is ready to use.
+type Meter struct {
+	total   uint64
+	counts  [STATS_WINDOW]uint64
+	seconds [STATS_WINDOW]int64
+	start   time.Time
+	mutex   sync.Mutex
+}
+
+func (x *Meter) Mark(n uint64) {
+	x.mark(n, time.Now())
+}
+
+func (x *Meter) mark(n uint64, now time.Time) {
+	x.mutex.Lock()
+	defer x.mutex.Unlock()
+	if x.start.IsZero() {
+		x.start = now
+	}
+	second := now.Unix()
+	slot := second % STATS_WINDOW
+	if x.seconds[slot] != second {
+		x.seconds[slot] = second
+		x.counts[slot] = 0
+	}
+	x.counts[slot] += n
+	x.total += n
+}
+
+func (x *Meter) Total() uint64 {
+	x.mutex.Lock()
+	defer x.mutex.Unlock()
+	return x.total
+}
+
+func (x *Meter) Rate() float64 {
+	return x.rate(time.Now())
+}
+
+// rate leaves out the second still under way, a meter younger than the window
+// is averaged over the seconds it has seen.
+func (x *Meter) rate(now time.Time) float64 {
+	x.mutex.Lock()
+	defer x.mutex.Unlock()
+	if x.start.IsZero() {
+		return 0
+	}
+	second := now.Unix()
+	seconds := second - x.start.Unix()
+	if seconds > STATS_WINDOW {
+		seconds = STATS_WINDOW
+	}
+	if seconds < 1 {
+		return 0
+	}
+	count := uint64(0)
+	for slot, at := range x.seconds {
+		if at < second && at >= second-seconds {
+			count += x.counts[slot]
+		}
+	}
+	return float64(count) / float64(seconds)
+}
+
+// IDropped is a driver that loses frames on its own, e.g. polls that time out.
+type IDropped interface {
+	Dropped() uint64
+}
+
+type TimingStats struct {
+	Count uint64
+	// recent mean, weighted towards the latest
+	MeanMs float64
+	MaxMs  float64
+}
+
+// Timing keeps the count, recent mean and maximum of a duration.  The zero
+// Timing is ready to use.
+type Timing struct {
+	count uint64
+	mean  float64
+	max   time.Duration
+	mutex sync.Mutex
+}
+
+func (x *Timing) Add(duration time.Duration) {
+	x.mutex.Lock()
+	defer x.mutex.Unlock()
+	ms := float64(duration) / float64(time.Millisecond)
+	if x.count == 0 {
+		x.mean = ms
+	} else {
+		x.mean += STATS_WEIGHT * (ms - x.mean)
+	}
+	x.count++
+	if duration > x.max {
+		x.max = duration
+	}
+}
+
+// Since adds the time since start.
+func (x *Timing) Since(start time.Time) {
+	x.Add(time.Since(start))
+}
+
+func (x *Timing) Stats() TimingStats {
+	x.mutex.Lock()
+	defer x.mutex.Unlock()
+	return TimingStats{
+		Count:  x.count,
+		MeanMs: x.mean,
+		MaxMs:  float64(x.max) / float64(time.Millisecond)}
+}
@@ -0,0 +1,39 @@
+// Copyright © 2023 Sloan Childers
+package base
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMeter(t *testing.T) {
+	x := &Meter{}
+	start := time.Unix(1000, 0)
+	assert.Equal(t, 0.0, x.rate(start))
+
+	// 20 a second for 3 seconds, then a partial second
+	for second := 0; second < 3; second++ {
+		for i := 0; i < 20; i++ {
+			x.mark(1, start.Add(time.Duration(second)*time.Second+time.Duration(i)*50*time.Millisecond))
+		}
+	}
+	x.mark(5, start.Add(3*time.Second))
+	assert.Equal(t, uint64(65), x.Total())
+	assert.Equal(t, 20.0, x.rate(start.Add(3*time.Second+500*time.Millisecond)))
+
+	// seconds without events count once the window is full
+	assert.Equal(t, 6.5, x.rate(start.Add(10*time.Second)))
+	assert.Equal(t, 0.0, x.rate(start.Add(30*time.Second)))
+}
+
+func TestTiming(t *testing.T) {
+	x := &Timing{}
+	x.Add(10 * time.Millisecond)
+	x.Add(20 * time.Millisecond)
+	stats := x.Stats()
+	assert.Equal(t, uint64(2), stats.Count)
+	assert.InDelta(t, 11.0, stats.MeanMs, 0.001)
+	assert.Equal(t, 20.0, stats.MaxMs)
+}
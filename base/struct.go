@@ -22,6 +22,7 @@ type ServerConfig struct {
 }
 
 type Cameras struct {
+	ApiKeys []*ApiKey `json:"ApiKeys,omitempty"`
 	Cameras []*CameraConfig
 }
 
@@ -34,13 +35,31 @@ type CameraConfig struct {
 	Height  int
 	Rate    float32
 	Motion  *MotionConfig
-	Plugin  string
+	// continuous recording, off when missing
+	Recording *RecordingConfig `json:"Recording,omitempty"`
+	Plugin    string
+	// for the blackjack plugin, the V4L2 fourcc MJPG, YUYV, RGB3 or GREY, the best
+	// the camera has when missing
+	Format string `json:"Format,omitempty"`
+	// for the blackjack plugin, V4L2 control values by key, e.g. exposure_absolute
+	Controls map[string]int32 `json:"Controls,omitempty"`
 	// for network cameras
-	Addr   string `json:"Addr,omitempty"`
-	Port   int    `json:"Port,omitempty"`
-	Uri    string `json:"Uri,omitempty"`
-	User   string `json:"User,omitempty"`
-	Pass   string `json:"Pass,omitempty"`
+	Addr string `json:"Addr,omitempty"`
+	Port int    `json:"Port,omitempty"`
+	Uri  string `json:"Uri,omitempty"`
+	User string `json:"User,omitempty"`
+	Pass string `json:"Pass,omitempty"`
+	// input of a video server with several, from 1
+	Channel int `json:"Channel,omitempty"`
+	// text burnt into the frames by the camera
+	Overlay *OverlayConfig `json:"Overlay,omitempty"`
+	// for the file replay plugin, start over at the end of the recording
+	Loop bool `json:"Loop,omitempty"`
+	// for the testsrc plugin, any of bars,box,clock,noise
+	Pattern string `json:"Pattern,omitempty"`
+	// for the rtsp plugin, tcp (interleaved, the default) or udp
+	Transport string `json:"Transport,omitempty"`
+	// plaintext key of old camera.json files, moved to Cameras.ApiKeys on load
 	ApiKey string `json:"ApiKey,omitempty"`
 }
 
@@ -55,6 +74,8 @@ type MotionConfig struct {
 	Enabled       bool
 	Area          float64
 	Detections    int
+	WindowSeconds int
+	QuietSeconds  int
 	Overlap       int
 	Mask          []MotionRectangle
 	BeforeSeconds int
@@ -62,6 +83,23 @@ type MotionConfig struct {
 	Decorate      bool
 }
 
+type OverlayConfig struct {
+	Text string `json:"Text,omitempty"`
+	// top or bottom
+	Position string `json:"Position,omitempty"`
+	// white or black
+	TextColor string `json:"TextColor,omitempty"`
+	// white, black, transparent or semitransparent
+	BackgroundColor string `json:"BackgroundColor,omitempty"`
+	Date            bool   `json:"Date,omitempty"`
+	Clock           bool   `json:"Clock,omitempty"`
+}
+
+type RecordingConfig struct {
+	Enabled        bool
+	SegmentMinutes int
+}
+
 type ICamera interface {
 	Name() string
 	Open() error
@@ -81,6 +119,18 @@ type IDriver interface {
 	ListFormatsAndFrameSizes() Formats
 }
 
+// Unwrap returns the driver under any supervisor, the one the optional driver
+// interfaces are asked of.
+func Unwrap(driver IDriver) IDriver {
+	for {
+		wrapper, ok := driver.(interface{ Unwrap() IDriver })
+		if !ok {
+			return driver
+		}
+		driver = wrapper.Unwrap()
+	}
+}
+
 type IFrame interface {
 	Width() int
 	Height() int
@@ -94,8 +144,13 @@ type IFrame interface {
 	SetImage(interface{}, int) // []byte or gocv.Mat
 	Clone() IFrame
 	Time() time.Time
+	// capture number of the driver, 0 when no driver captured the frame
+	Seq() uint64
+	Source() string
 }
 
 type IMotion interface {
 	Detect(img IFrame) bool
+	// SetConfig replaces the configuration between two Detect calls
+	SetConfig(config *CameraConfig)
 }
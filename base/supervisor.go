@@ -0,0 +1,305 @@
+// Copyright © 2023 Sloan Childers
+package base
+
+import (
+	"errors"
+	"math/rand"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+type DriverState string
+
+const (
+	STATE_CONNECTED    DriverState = "connected"
+	STATE_RECONNECTING DriverState = "reconnecting"
+	STATE_FAILED       DriverState = "failed" // still retried, at the longest backoff
+	STATE_STOPPED      DriverState = "stopped"
+)
+
+const (
+	// a stream without a new frame for this long is dead
+	FRAME_TIMEOUT = 10 * time.Second
+	// how often the supervisor checks the health of a connected driver
+	HEALTH_INTERVAL = time.Second
+	BACKOFF_MIN     = time.Second
+	BACKOFF_MAX     = time.Minute
+	// failed attempts before a driver counts as failed
+	RECONNECT_ATTEMPTS = 10
+)
+
+var ErrStalled = errors.New("no new frame")
+
+// IHealth is a driver that watches its own stream.
+type IHealth interface {
+	// Health is the error that ended the stream, nil while it runs
+	Health() error
+	// LastFrame is when the latest frame arrived, or when the stream was opened
+	LastFrame() time.Time
+}
+
+type DriverStatus struct {
+	State    DriverState
+	Attempts int
+	// successful reconnects since the start
+	Reconnects int
+	// when the driver entered State
+	Since     time.Time
+	LastFrame *time.Time `json:"LastFrame,omitempty"`
+	Error     string     `json:"Error,omitempty"`
+}
+
+// Supervisor wraps a driver and reconnects it with jittered exponential backoff
+// when Open fails, or when a driver with IHealth reports an error or stalls.
+// While it is away Grab returns a frame saying so.
+type Supervisor struct {
+	driver     IDriver
+	config     *CameraConfig
+	timeout    time.Duration
+	interval   time.Duration
+	min        time.Duration
+	max        time.Duration
+	state      DriverState
+	attempts   int
+	reconnects int
+	since      time.Time
+	err        error
+	stop       chan struct{}
+	// the status frame and the text it was drawn with
+	status     []byte
+	statusText string
+	mutex      sync.Mutex
+	// serializes the calls into the driver
+	calls sync.Mutex
+}
+
+func NewSupervisor(driver IDriver, config *CameraConfig) *Supervisor {
+	return &Supervisor{
+		driver:   driver,
+		config:   config,
+		timeout:  FRAME_TIMEOUT,
+		interval: HEALTH_INTERVAL,
+		min:      BACKOFF_MIN,
+		max:      BACKOFF_MAX,
+		state:    STATE_STOPPED,
+		since:    time.Now()}
+}
+
+// Unwrap returns the supervised driver.
+func (x *Supervisor) Unwrap() IDriver {
+	return x.driver
+}
+
+func (x *Supervisor) Status() DriverStatus {
+	x.mutex.Lock()
+	defer x.mutex.Unlock()
+	status := DriverStatus{State: x.state, Attempts: x.attempts, Reconnects: x.reconnects, Since: x.since}
+	if x.err != nil {
+		status.Error = x.err.Error()
+	}
+	if health, ok := x.driver.(IHealth); ok && x.state == STATE_CONNECTED {
+		last := health.LastFrame()
+		status.LastFrame = &last
+	}
+	return status
+}
+
+func (x *Supervisor) ListFormatsAndFrameSizes() Formats {
+	x.calls.Lock()
+	defer x.calls.Unlock()
+	return x.driver.ListFormatsAndFrameSizes()
+}
+
+func (x *Supervisor) Grab() IFrame {
+	x.mutex.Lock()
+	state := x.state
+	x.mutex.Unlock()
+	if state == STATE_CONNECTED || state == STATE_STOPPED {
+		return x.driver.Grab()
+	}
+	frame := NewFrame(x.config)
+	frame.SetImage(x.statusFrame(), JPEG)
+	return frame
+}
+
+// statusFrame draws the state and attempt count, again only when they change.
+func (x *Supervisor) statusFrame() []byte {
+	x.mutex.Lock()
+	defer x.mutex.Unlock()
+	text := string(x.state) + " " + strconv.Itoa(x.attempts)
+	if x.status == nil || text != x.statusText {
+		x.status = StatusFrame(x.config.Width, x.config.Height, string(x.state), "attempt "+strconv.Itoa(x.attempts))
+		x.statusText = text
+	}
+	return x.status
+}
+
+func (x *Supervisor) Open() error {
+	x.calls.Lock()
+	defer x.calls.Unlock()
+	err := x.driver.Open()
+	x.result(err)
+	return err
+}
+
+// Stream starts the driver and the supervision, which reconnects a driver that
+// failed to open.
+func (x *Supervisor) Stream() {
+	x.mutex.Lock()
+	connected := x.state == STATE_CONNECTED
+	x.mutex.Unlock()
+	if connected {
+		x.calls.Lock()
+		x.driver.Stream()
+		x.calls.Unlock()
+	}
+	x.watch()
+}
+
+func (x *Supervisor) Stop() {
+	x.halt()
+	x.calls.Lock()
+	defer x.calls.Unlock()
+	x.driver.Stop()
+	x.mutex.Lock()
+	defer x.mutex.Unlock()
+	x.setState(STATE_STOPPED)
+	x.attempts = 0
+	x.err = nil
+}
+
+// Reset restarts the driver, the error is the driver's own so a rejected
+// configuration can be rolled back.  Supervision goes on either way.
+func (x *Supervisor) Reset() error {
+	x.halt()
+	x.calls.Lock()
+	err := x.driver.Reset()
+	x.result(err)
+	x.calls.Unlock()
+	x.watch()
+	return err
+}
+
+// result records the outcome of opening the driver.
+func (x *Supervisor) result(err error) {
+	x.mutex.Lock()
+	defer x.mutex.Unlock()
+	x.err = err
+	if err == nil {
+		x.attempts = 0
+		x.setState(STATE_CONNECTED)
+		return
+	}
+	x.attempts++
+	if x.attempts >= RECONNECT_ATTEMPTS {
+		x.setState(STATE_FAILED)
+	} else {
+		x.setState(STATE_RECONNECTING)
+	}
+}
+
+func (x *Supervisor) setState(state DriverState) {
+	if x.state != state {
+		x.state = state
+		x.since = time.Now()
+	}
+}
+
+func (x *Supervisor) watch() {
+	x.mutex.Lock()
+	defer x.mutex.Unlock()
+	if x.stop == nil {
+		x.stop = make(chan struct{})
+		go x.run(x.stop)
+	}
+}
+
+func (x *Supervisor) halt() {
+	x.mutex.Lock()
+	defer x.mutex.Unlock()
+	if x.stop != nil {
+		close(x.stop)
+		x.stop = nil
+	}
+}
+
+func (x *Supervisor) run(stop chan struct{}) {
+	for {
+		x.mutex.Lock()
+		state, attempts := x.state, x.attempts
+		interval, timeout := x.interval, x.timeout
+		x.mutex.Unlock()
+
+		if state == STATE_CONNECTED {
+			select {
+			case <-stop:
+				return
+			case <-time.After(interval):
+			}
+			err := x.check(timeout)
+			if err == nil {
+				continue
+			}
+			log.Warn().Err(err).Str("component", "supervisor").Str("name", x.config.Name).Msg("stream lost, reconnecting")
+			x.mutex.Lock()
+			x.err = err
+			x.setState(STATE_RECONNECTING)
+			x.mutex.Unlock()
+		}
+
+		select {
+		case <-stop:
+			return
+		case <-time.After(x.backoff(attempts)):
+		}
+		x.calls.Lock()
+		select {
+		case <-stop:
+			// stopped or reset while waiting for the driver
+			x.calls.Unlock()
+			return
+		default:
+		}
+		err := x.driver.Reset()
+		x.result(err)
+		x.calls.Unlock()
+		if err == nil {
+			x.mutex.Lock()
+			x.reconnects++
+			x.mutex.Unlock()
+			log.Info().Str("component", "supervisor").Str("name", x.config.Name).Int("attempts", attempts+1).Msg("reconnected")
+		} else {
+			log.Warn().Err(err).Str("component", "supervisor").Str("name", x.config.Name).Int("attempts", attempts+1).Msg("reconnect")
+		}
+	}
+}
+
+// check finds dead streams of the drivers that report on them, or that had no
+// frame within timeout.
+func (x *Supervisor) check(timeout time.Duration) error {
+	health, ok := x.driver.(IHealth)
+	if !ok {
+		return nil
+	}
+	err := health.Health()
+	if err == nil && time.Since(health.LastFrame()) > timeout {
+		err = ErrStalled
+	}
+	return err
+}
+
+// backoff doubles from min up to max per attempt, each wait picked at random
+// between half and all of it so cameras behind one switch don't retry in step.
+func (x *Supervisor) backoff(attempts int) time.Duration {
+	delay := x.min
+	for i := 0; i < attempts && delay < x.max; i++ {
+		delay *= 2
+	}
+	if delay > x.max {
+		delay = x.max
+	}
+	return delay/2 + time.Duration(rand.Int63n(int64(delay/2)+1))
+}
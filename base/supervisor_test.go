@@ -0,0 +1,140 @@
+// Copyright © 2023 Sloan Childers
+package base
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/jpeg"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeDriver fails to open while down and reports a dead stream when broken.
+type fakeDriver struct {
+	config    *CameraConfig
+	down      bool
+	broken    error
+	lastFrame time.Time
+	opens     int
+	mutex     sync.Mutex
+}
+
+func (x *fakeDriver) Open() error {
+	x.mutex.Lock()
+	defer x.mutex.Unlock()
+	x.opens++
+	if x.down {
+		return errors.New("connection refused")
+	}
+	x.broken = nil
+	x.lastFrame = time.Now()
+	return nil
+}
+
+func (x *fakeDriver) Stop()   {}
+func (x *fakeDriver) Stream() {}
+
+func (x *fakeDriver) Reset() error {
+	return x.Open()
+}
+
+func (x *fakeDriver) Grab() IFrame {
+	frame := NewFrame(x.config)
+	frame.SetImage(EmptyFrame(x.config.Width, x.config.Height), JPEG)
+	return frame
+}
+
+func (x *fakeDriver) ListFormatsAndFrameSizes() Formats {
+	return Formats{}
+}
+
+func (x *fakeDriver) Health() error {
+	x.mutex.Lock()
+	defer x.mutex.Unlock()
+	return x.broken
+}
+
+func (x *fakeDriver) LastFrame() time.Time {
+	x.mutex.Lock()
+	defer x.mutex.Unlock()
+	return x.lastFrame
+}
+
+func (x *fakeDriver) set(down bool, broken error) {
+	x.mutex.Lock()
+	defer x.mutex.Unlock()
+	x.down = down
+	x.broken = broken
+}
+
+func newTestSupervisor(driver IDriver, config *CameraConfig) *Supervisor {
+	x := NewSupervisor(driver, config)
+	x.interval = 5 * time.Millisecond
+	x.min = 5 * time.Millisecond
+	x.max = 20 * time.Millisecond
+	return x
+}
+
+func TestSupervisor(t *testing.T) {
+	config := &CameraConfig{Name: "test", Width: 64, Height: 48}
+	driver := &fakeDriver{config: config, down: true}
+	x := newTestSupervisor(driver, config)
+	assert.Equal(t, driver, x.Unwrap())
+	assert.Equal(t, driver, Unwrap(x))
+
+	// down at start, reconnected with backoff once it is up
+	assert.Error(t, x.Open())
+	assert.Equal(t, STATE_RECONNECTING, x.Status().State)
+	assert.Equal(t, 1, x.Status().Attempts)
+	assert.Equal(t, "connection refused", x.Status().Error)
+	status := x.statusFrame()
+	assert.True(t, ValidateJPEG(status))
+	img, err := jpeg.Decode(bytes.NewReader(status))
+	assert.NoError(t, err)
+	assert.Equal(t, image.Rect(0, 0, 64, 48), img.Bounds())
+	x.Stream()
+	assert.Eventually(t, func() bool { return x.Status().Attempts >= RECONNECT_ATTEMPTS }, time.Second, time.Millisecond)
+	assert.Equal(t, STATE_FAILED, x.Status().State)
+	driver.set(false, nil)
+	assert.Eventually(t, func() bool { return x.Status().State == STATE_CONNECTED }, time.Second, time.Millisecond)
+	assert.Equal(t, 0, x.Status().Attempts)
+	assert.Equal(t, 1, x.Status().Reconnects)
+	assert.NotNil(t, x.Status().LastFrame)
+	assert.NotEqual(t, status, x.statusFrame())
+
+	// a read error
+	driver.set(false, errors.New("EOF"))
+	assert.Eventually(t, func() bool { return driver.Health() == nil && x.Status().State == STATE_CONNECTED }, time.Second, time.Millisecond)
+
+	// a stall, no new frame in time
+	x.mutex.Lock()
+	x.timeout = 50 * time.Millisecond
+	x.mutex.Unlock()
+	opens := func() int {
+		driver.mutex.Lock()
+		defer driver.mutex.Unlock()
+		return driver.opens
+	}
+	before := opens()
+	assert.Eventually(t, func() bool { return opens() > before }, time.Second, time.Millisecond)
+
+	x.Stop()
+	assert.Equal(t, STATE_STOPPED, x.Status().State)
+	stopped := opens()
+	time.Sleep(100 * time.Millisecond)
+	assert.Equal(t, stopped, opens())
+}
+
+func TestSupervisorBackoff(t *testing.T) {
+	x := NewSupervisor(&fakeDriver{}, &CameraConfig{})
+	for attempts, max := range []time.Duration{time.Second, 2 * time.Second, 4 * time.Second} {
+		delay := x.backoff(attempts)
+		assert.True(t, delay >= max/2 && delay <= max, delay)
+	}
+	assert.True(t, x.backoff(100) <= BACKOFF_MAX)
+	assert.True(t, x.backoff(100) >= BACKOFF_MAX/2)
+}
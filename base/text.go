@@ -0,0 +1,127 @@
+// Copyright © 2023 Sloan Childers
+package base
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/jpeg"
+	"strings"
+)
+
+const (
+	GLYPH_WIDTH  = 5
+	GLYPH_HEIGHT = 7
+)
+
+var (
+	textColor  = color.RGBA{255, 255, 255, 255}
+	textStrip  = color.RGBA{0, 0, 0, 255}
+	statusGrey = color.RGBA{48, 48, 48, 255}
+)
+
+// 5x7 glyphs for timestamps, counters and status messages, one row per string
+var glyphs = map[rune][GLYPH_HEIGHT]string{
+	'0': {" ### ", "#   #", "#  ##", "# # #", "##  #", "#   #", " ### "},
+	'1': {"  #  ", " ##  ", "  #  ", "  #  ", "  #  ", "  #  ", " ### "},
+	'2': {" ### ", "#   #", "    #", "   # ", "  #  ", " #   ", "#####"},
+	'3': {"#####", "   # ", "  #  ", "   # ", "    #", "#   #", " ### "},
+	'4': {"   # ", "  ## ", " # # ", "#  # ", "#####", "   # ", "   # "},
+	'5': {"#####", "#    ", "#### ", "    #", "    #", "#   #", " ### "},
+	'6': {"  ## ", " #   ", "#    ", "#### ", "#   #", "#   #", " ### "},
+	'7': {"#####", "    #", "   # ", "  #  ", " #   ", " #   ", " #   "},
+	'8': {" ### ", "#   #", "#   #", " ### ", "#   #", "#   #", " ### "},
+	'9': {" ### ", "#   #", "#   #", " ####", "    #", "   # ", " ##  "},
+	'-': {"     ", "     ", "     ", "#####", "     ", "     ", "     "},
+	':': {"     ", "  #  ", "  #  ", "     ", "  #  ", "  #  ", "     "},
+	'.': {"     ", "     ", "     ", "     ", "     ", " ##  ", " ##  "},
+	'#': {" # # ", " # # ", "#####", " # # ", "#####", " # # ", " # # "},
+	'/': {"     ", "    #", "   # ", "  #  ", " #   ", "#    ", "     "},
+	' ': {"     ", "     ", "     ", "     ", "     ", "     ", "     "},
+	'A': {" ### ", "#   #", "#   #", "#####", "#   #", "#   #", "#   #"},
+	'B': {"#### ", "#   #", "#   #", "#### ", "#   #", "#   #", "#### "},
+	'C': {" ### ", "#   #", "#    ", "#    ", "#    ", "#   #", " ### "},
+	'D': {"#### ", "#   #", "#   #", "#   #", "#   #", "#   #", "#### "},
+	'E': {"#####", "#    ", "#    ", "#### ", "#    ", "#    ", "#####"},
+	'F': {"#####", "#    ", "#    ", "#### ", "#    ", "#    ", "#    "},
+	'G': {" ### ", "#   #", "#    ", "# ###", "#   #", "#   #", " ####"},
+	'H': {"#   #", "#   #", "#   #", "#####", "#   #", "#   #", "#   #"},
+	'I': {" ### ", "  #  ", "  #  ", "  #  ", "  #  ", "  #  ", " ### "},
+	'J': {"  ###", "   # ", "   # ", "   # ", "   # ", "#  # ", " ##  "},
+	'K': {"#   #", "#  # ", "# #  ", "##   ", "# #  ", "#  # ", "#   #"},
+	'L': {"#    ", "#    ", "#    ", "#    ", "#    ", "#    ", "#####"},
+	'M': {"#   #", "## ##", "# # #", "# # #", "#   #", "#   #", "#   #"},
+	'N': {"#   #", "#   #", "##  #", "# # #", "#  ##", "#   #", "#   #"},
+	'O': {" ### ", "#   #", "#   #", "#   #", "#   #", "#   #", " ### "},
+	'P': {"#### ", "#   #", "#   #", "#### ", "#    ", "#    ", "#    "},
+	'Q': {" ### ", "#   #", "#   #", "#   #", "# # #", "#  # ", " ## #"},
+	'R': {"#### ", "#   #", "#   #", "#### ", "# #  ", "#  # ", "#   #"},
+	'S': {" ####", "#    ", "#    ", " ### ", "    #", "    #", "#### "},
+	'T': {"#####", "  #  ", "  #  ", "  #  ", "  #  ", "  #  ", "  #  "},
+	'U': {"#   #", "#   #", "#   #", "#   #", "#   #", "#   #", " ### "},
+	'V': {"#   #", "#   #", "#   #", "#   #", "#   #", " # # ", "  #  "},
+	'W': {"#   #", "#   #", "#   #", "# # #", "# # #", "# # #", " # # "},
+	'X': {"#   #", "#   #", " # # ", "  #  ", " # # ", "#   #", "#   #"},
+	'Y': {"#   #", "#   #", " # # ", "  #  ", "  #  ", "  #  ", "  #  "},
+	'Z': {"#####", "    #", "   # ", "  #  ", " #   ", "#    ", "#####"},
+}
+
+// DrawText burns text in white on a black strip, each glyph pixel scale pixels wide.
+// Letters are drawn in upper case.
+func DrawText(img *image.RGBA, text string, scale, left, top int) {
+	advance := (GLYPH_WIDTH + 1) * scale
+	strip := image.Rect(left-scale, top-scale, left+len(text)*advance, top+(GLYPH_HEIGHT+1)*scale)
+	draw.Draw(img, strip.Intersect(img.Bounds()), image.NewUniform(textStrip), image.Point{}, draw.Src)
+	for i, char := range strings.ToUpper(text) {
+		glyph, ok := glyphs[char]
+		if !ok {
+			continue
+		}
+		for row, line := range glyph {
+			for col, pixel := range line {
+				if pixel != '#' {
+					continue
+				}
+				x := left + i*advance + col*scale
+				y := top + row*scale
+				dot := image.Rect(x, y, x+scale, y+scale).Intersect(img.Bounds())
+				draw.Draw(img, dot, image.NewUniform(textColor), image.Point{}, draw.Src)
+			}
+		}
+	}
+}
+
+// TextWidth is the width DrawText needs for text.
+func TextWidth(text string, scale int) int {
+	return len(text) * (GLYPH_WIDTH + 1) * scale
+}
+
+// StatusFrame is a grey JPEG with lines of text in the middle, shown in place of
+// the camera while it is away.
+func StatusFrame(width, height int, lines ...string) []byte {
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	draw.Draw(img, img.Bounds(), image.NewUniform(statusGrey), image.Point{}, draw.Src)
+	longest := 1
+	for _, line := range lines {
+		if len(line) > longest {
+			longest = len(line)
+		}
+	}
+	// as large as fits, up to a tenth of the height
+	scale := width * 9 / 10 / TextWidth(strings.Repeat(" ", longest), 1)
+	if scale > height/10/GLYPH_HEIGHT {
+		scale = height / 10 / GLYPH_HEIGHT
+	}
+	if scale < 1 {
+		scale = 1
+	}
+	lineHeight := (GLYPH_HEIGHT + 3) * scale
+	top := (height - lineHeight*len(lines)) / 2
+	for i, line := range lines {
+		DrawText(img, line, scale, (width-TextWidth(line, scale))/2, top+i*lineHeight)
+	}
+	out := bytes.Buffer{}
+	jpeg.Encode(&out, img, &jpeg.Options{Quality: 75})
+	return out.Bytes()
+}
@@ -0,0 +1,221 @@
+// Copyright © 2023 Sloan Childers
+package blackjack
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"sort"
+	"syscall"
+	"unsafe"
+
+	"github.com/osintami/camz/base"
+)
+
+// V4L2 controls through ioctls of their own, the webcam package leaves out the
+// step, default and menus.  Controls can be used from a second open of a device
+// that is streaming.
+
+const (
+	VIDIOC_G_CTRL    = 0xC008561B
+	VIDIOC_S_CTRL    = 0xC008561C
+	VIDIOC_QUERYCTRL = 0xC0445624
+	VIDIOC_QUERYMENU = 0xC02C5625
+
+	V4L2_CTRL_FLAG_DISABLED  = 0x0001
+	V4L2_CTRL_FLAG_READ_ONLY = 0x0004
+	V4L2_CTRL_FLAG_INACTIVE  = 0x0010
+	V4L2_CTRL_FLAG_NEXT_CTRL = 0x80000000
+
+	V4L2_CTRL_TYPE_INTEGER = 1
+	V4L2_CTRL_TYPE_BOOLEAN = 2
+	V4L2_CTRL_TYPE_MENU    = 3
+	V4L2_CTRL_TYPE_BUTTON  = 4
+)
+
+type v4l2QueryCtrl struct {
+	id           uint32
+	ctrlType     uint32
+	name         [32]byte
+	minimum      int32
+	maximum      int32
+	step         int32
+	defaultValue int32
+	flags        uint32
+	reserved     [2]uint32
+}
+
+type v4l2QueryMenu struct {
+	id       uint32
+	index    uint32
+	name     [32]byte
+	reserved uint32
+}
+
+type v4l2Control struct {
+	id    uint32
+	value int32
+}
+
+var controlTypes = map[uint32]string{
+	V4L2_CTRL_TYPE_INTEGER: base.CONTROL_INTEGER,
+	V4L2_CTRL_TYPE_BOOLEAN: base.CONTROL_BOOLEAN,
+	V4L2_CTRL_TYPE_MENU:    base.CONTROL_MENU,
+	V4L2_CTRL_TYPE_BUTTON:  base.CONTROL_BUTTON,
+}
+
+func ioctl(fd uintptr, request uintptr, arg unsafe.Pointer) error {
+	_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, fd, request, uintptr(arg))
+	if errno != 0 {
+		return errno
+	}
+	return nil
+}
+
+func cString(data []byte) string {
+	return string(bytes.TrimRight(data, "\x00"))
+}
+
+// controller is where controls are read and set, a V4L2 device outside of tests.
+type controller interface {
+	query() ([]base.Control, map[string]uint32, error)
+	set(id uint32, value int32) error
+}
+
+type v4l2Device struct {
+	path string
+}
+
+func (x *v4l2Device) query() ([]base.Control, map[string]uint32, error) {
+	file, err := os.OpenFile(x.path, os.O_RDWR, 0)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer file.Close()
+	fd := file.Fd()
+
+	controls := []base.Control{}
+	ids := map[string]uint32{}
+	query := v4l2QueryCtrl{id: V4L2_CTRL_FLAG_NEXT_CTRL}
+	for ioctl(fd, VIDIOC_QUERYCTRL, unsafe.Pointer(&query)) == nil {
+		id := query.id
+		controlType, known := controlTypes[query.ctrlType]
+		if known && query.flags&V4L2_CTRL_FLAG_DISABLED == 0 {
+			control := base.Control{
+				Name:     cString(query.name[:]),
+				Type:     controlType,
+				Min:      query.minimum,
+				Max:      query.maximum,
+				Step:     query.step,
+				Default:  query.defaultValue,
+				ReadOnly: query.flags&V4L2_CTRL_FLAG_READ_ONLY != 0,
+				Inactive: query.flags&V4L2_CTRL_FLAG_INACTIVE != 0}
+			control.Key = base.ControlKey(control.Name)
+			value := v4l2Control{id: id}
+			if ioctl(fd, VIDIOC_G_CTRL, unsafe.Pointer(&value)) == nil {
+				control.Value = value.value
+			}
+			if query.ctrlType == V4L2_CTRL_TYPE_MENU {
+				control.Menu = map[int32]string{}
+				for index := query.minimum; index <= query.maximum; index++ {
+					menu := v4l2QueryMenu{id: id, index: uint32(index)}
+					// menus may have holes
+					if ioctl(fd, VIDIOC_QUERYMENU, unsafe.Pointer(&menu)) == nil {
+						control.Menu[index] = cString(menu.name[:])
+					}
+				}
+			}
+			controls = append(controls, control)
+			ids[control.Key] = id
+		}
+		query = v4l2QueryCtrl{id: id | V4L2_CTRL_FLAG_NEXT_CTRL}
+	}
+	return controls, ids, nil
+}
+
+func (x *v4l2Device) set(id uint32, value int32) error {
+	file, err := os.OpenFile(x.path, os.O_RDWR, 0)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	control := v4l2Control{id: id, value: value}
+	return ioctl(file.Fd(), VIDIOC_S_CTRL, unsafe.Pointer(&control))
+}
+
+// setControls checks every value against its control before setting any.
+func setControls(device controller, values map[string]int32) error {
+	if len(values) == 0 {
+		return nil
+	}
+	controls, ids, err := device.query()
+	if err != nil {
+		return err
+	}
+	byKey := map[string]base.Control{}
+	for _, control := range controls {
+		byKey[control.Key] = control
+	}
+	keys := []string{}
+	for key, value := range values {
+		control, ok := byKey[key]
+		if !ok {
+			return fmt.Errorf("%w: no control %s", base.ErrControl, key)
+		}
+		if control.ReadOnly {
+			return fmt.Errorf("%w: %s is read only", base.ErrControl, key)
+		}
+		if control.Type != base.CONTROL_BUTTON && (value < control.Min || value > control.Max) {
+			return fmt.Errorf("%w: %s must be %d to %d", base.ErrControl, key, control.Min, control.Max)
+		}
+		keys = append(keys, key)
+	}
+	// automatic modes are switches and menus, they go first so the values they
+	// lock can be set after them
+	sort.Slice(keys, func(i, j int) bool {
+		first := byKey[keys[i]].Type != base.CONTROL_INTEGER
+		second := byKey[keys[j]].Type != base.CONTROL_INTEGER
+		if first != second {
+			return first
+		}
+		return keys[i] < keys[j]
+	})
+	for _, key := range keys {
+		err = device.set(ids[key], values[key])
+		if err != nil {
+			return fmt.Errorf("set %s: %w", key, err)
+		}
+	}
+	return nil
+}
+
+func (x *Driver) controller() controller {
+	return &v4l2Device{path: x.path()}
+}
+
+// Controls lists the controls of the device with their current values.
+func (x *Driver) Controls() ([]base.Control, error) {
+	controls, _, err := x.controller().query()
+	return controls, err
+}
+
+// SetControls sets the controls live and again whenever the device is opened,
+// config.Controls is up to the caller.
+func (x *Driver) SetControls(values map[string]int32) error {
+	err := setControls(x.controller(), values)
+	if err != nil {
+		return err
+	}
+	// a new map, Open may be applying the old one
+	x.mutex.Lock()
+	defer x.mutex.Unlock()
+	controls := map[string]int32{}
+	for key, value := range x.controls {
+		controls[key] = value
+	}
+	for key, value := range values {
+		controls[key] = value
+	}
+	x.controls = controls
+	return nil
+}
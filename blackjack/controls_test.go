@@ -0,0 +1,55 @@
+// Copyright © 2023 Sloan Childers
+package blackjack
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/osintami/camz/base"
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeController struct {
+	controls []base.Control
+	order    []string
+}
+
+func (x *fakeController) query() ([]base.Control, map[string]uint32, error) {
+	ids := map[string]uint32{}
+	for i, control := range x.controls {
+		ids[control.Key] = uint32(i)
+	}
+	return x.controls, ids, nil
+}
+
+func (x *fakeController) set(id uint32, value int32) error {
+	x.order = append(x.order, x.controls[id].Key)
+	return nil
+}
+
+func TestSetControls(t *testing.T) {
+	device := &fakeController{controls: []base.Control{
+		{Key: "exposure_absolute", Type: base.CONTROL_INTEGER, Min: 3, Max: 2047},
+		{Key: "exposure_auto", Type: base.CONTROL_MENU, Min: 0, Max: 3},
+		{Key: "brightness", Type: base.CONTROL_INTEGER, Min: -64, Max: 64},
+		{Key: "focus_auto", Type: base.CONTROL_BOOLEAN, Min: 0, Max: 1},
+		{Key: "pixel_rate", Type: base.CONTROL_INTEGER, Min: 0, Max: 100, ReadOnly: true},
+	}}
+
+	// automatic modes first, or the manual values are rejected
+	assert.NoError(t, setControls(device, map[string]int32{"exposure_absolute": 300, "brightness": 0, "exposure_auto": 1, "focus_auto": 0}))
+	assert.Equal(t, []string{"exposure_auto", "focus_auto", "brightness", "exposure_absolute"}, device.order)
+
+	// nothing is set unless everything checks out
+	device.order = nil
+	for _, values := range []map[string]int32{
+		{"brightness": 1, "gamma": 100},
+		{"brightness": 65},
+		{"pixel_rate": 50},
+	} {
+		err := setControls(device, values)
+		assert.True(t, errors.Is(err, base.ErrControl), err)
+	}
+	assert.Nil(t, device.order)
+	assert.NoError(t, setControls(device, nil))
+}
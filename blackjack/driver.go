@@ -3,8 +3,10 @@ package blackjack
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"sort"
+	"strings"
 	"sync"
 	"time"
 
@@ -16,25 +18,74 @@ import (
 type Driver struct {
 	config *base.CameraConfig
 	webcam *webcam.Webcam
-	frame  []byte
-	mutex  sync.Mutex
-	stop   bool
+	frames *base.Publisher
+	// image type of the negotiated pixel format
+	pixelType int
+	// config.Controls and the ones set live since, applied on every open
+	controls map[string]int32
+	mutex    sync.Mutex
+	stop     bool
 }
 
 const (
-	V4L2_PIX_FMT_YUYV = 0x56595559
-	V4L2_PIX_FMT_MJPG = 0x47504A4D
+	V4L2_PIX_FMT_YUYV  = 0x56595559
+	V4L2_PIX_FMT_MJPG  = 0x47504A4D
+	V4L2_PIX_FMT_RGB24 = 0x33424752
+	V4L2_PIX_FMT_GREY  = 0x59455247
 )
 
+var ErrPixelFormat = errors.New("pixel format not supported by the camera")
+
+type pixelFormat struct {
+	name      string
+	code      webcam.PixelFormat
+	imageType int
+}
+
+// the formats of config.Format by their fourcc, without one the first the camera has
+var pixelFormats = []pixelFormat{
+	{"MJPG", V4L2_PIX_FMT_MJPG, base.JPEG},
+	{"YUYV", V4L2_PIX_FMT_YUYV, base.YUV422},
+	{"RGB3", V4L2_PIX_FMT_RGB24, base.RGB24},
+	{"GREY", V4L2_PIX_FMT_GREY, base.GREY},
+}
+
 func NewDriver(config *base.CameraConfig) *Driver {
 	return &Driver{
-		config: config,
-		frame:  base.EmptyFrame(config.Width, config.Height),
+		config:   config,
+		frames:   base.NewPublisher("blackjack"),
+		controls: config.Controls,
 	}
 }
 
+// choosePixelFormat picks config.Format, or the best format the camera supports.
+func choosePixelFormat(wanted string, supported map[webcam.PixelFormat]string) (pixelFormat, error) {
+	for _, format := range pixelFormats {
+		if _, ok := supported[format.code]; !ok {
+			continue
+		}
+		if wanted == "" || strings.EqualFold(wanted, format.name) {
+			return format, nil
+		}
+	}
+	names := []string{}
+	for _, name := range supported {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return pixelFormat{}, fmt.Errorf("%w: %q, the camera has %s", ErrPixelFormat, wanted, strings.Join(names, ", "))
+}
+
+func (x *Driver) path() string {
+	return fmt.Sprintf("/dev/video%d", x.config.Device)
+}
+
+// ListFormatsAndFrameSizes lists nothing while the device is closed.
 func (x *Driver) ListFormatsAndFrameSizes() base.Formats {
 	formats := base.Formats{}
+	if x.webcam == nil {
+		return formats
+	}
 	format_desc := x.webcam.GetSupportedFormats()
 	for formatObj, formatStr := range format_desc {
 		format := base.Format{Name: formatStr}
@@ -51,27 +102,29 @@ func (x *Driver) ListFormatsAndFrameSizes() base.Formats {
 }
 
 func (x *Driver) Grab() base.IFrame {
-	x.mutex.Lock()
-	defer x.mutex.Unlock()
-	frame := base.NewFrame(x.config)
-	frame.SetImage(x.frame, base.JPEG)
-	return frame
+	return x.frames.Frame(x.config)
 }
 
-func (x *Driver) grab() []byte {
-	var out []byte
+// Subscribe returns a channel of the frames as they are captured.
+func (x *Driver) Subscribe() (<-chan *base.Capture, func()) {
+	return x.frames.Subscribe()
+}
+
+// grab reads the next frame, nil when none came in time or it couldn't be read.
+func (x *Driver) grab() *base.Capture {
 	err := x.webcam.WaitForFrame(1)
 	if err != nil {
 		log.Error().Err(err).Str("component", "driver").Msg("WaitForFrame")
-	} else {
-		out, err = x.webcam.ReadFrame()
-		if err != nil || len(out) == 0 {
-			log.Warn().Str("component", "driver").Str("name", x.config.Name).Msg("ReadFrame")
-			out = base.EmptyFrame(x.config.Width, x.config.Height)
-		}
+		return nil
+	}
+	captured := time.Now()
+	out, err := x.webcam.ReadFrame()
+	if err != nil || len(out) == 0 {
+		log.Warn().Str("component", "driver").Str("name", x.config.Name).Msg("ReadFrame")
+		return nil
 	}
 	// NOTE:  must make a copy of the out slice
-	return base.Copy(out)
+	return &base.Capture{Image: base.Copy(out), Type: x.pixelType, Time: captured}
 }
 
 func (x *Driver) Stream() {
@@ -79,6 +132,9 @@ func (x *Driver) Stream() {
 }
 
 func (x *Driver) CheckSize(width, height uint32) bool {
+	if x.webcam == nil {
+		return false
+	}
 	format_desc := x.webcam.GetSupportedFormats()
 	for format, _ := range format_desc {
 		frameSizes := x.webcam.GetSupportedFrameSizes(format)
@@ -93,10 +149,10 @@ func (x *Driver) CheckSize(width, height uint32) bool {
 
 func (x *Driver) Open() error {
 	var err error
-	x.webcam, err = webcam.Open(fmt.Sprintf("/dev/video%d", x.config.Device))
+	x.webcam, err = webcam.Open(x.path())
 	if err != nil {
 		log.Error().Err(err).Str("component", "driver").Str("name", x.config.Name).Int("device", x.config.Device).Msg("webcam.Open")
-		return nil
+		return err
 	}
 
 	err = x.webcam.SetFramerate(float32(x.config.Rate))
@@ -111,16 +167,33 @@ func (x *Driver) Open() error {
 		return err
 	}
 
-	//	switch x.config.Format {
-	//	case "Motion-JPEG":
-	_, _, _, err = x.webcam.SetImageFormat(V4L2_PIX_FMT_MJPG, uint32(x.config.Width), uint32(x.config.Height))
-	//	case "YUYV 4:2:2":
-	//		_, _, _, err = x.webcam.SetImageFormat(V4L2_PIX_FMT_YUYV, uint32(x.config.Width), uint32(x.config.Height))
-	//	}
+	// the chosen controls, auto white balance included, win over the default
+	x.mutex.Lock()
+	controls := x.controls
+	x.mutex.Unlock()
+	err = setControls(x.controller(), controls)
 	if err != nil {
+		log.Error().Err(err).Str("component", "driver").Str("name", x.config.Name).Msg("SetControls")
+		return err
+	}
+
+	format, err := choosePixelFormat(x.config.Format, x.webcam.GetSupportedFormats())
+	if err != nil {
+		log.Error().Err(err).Str("component", "driver").Str("name", x.config.Name).Msg("pixel format")
+		return err
+	}
+	_, width, height, err := x.webcam.SetImageFormat(format.code, uint32(x.config.Width), uint32(x.config.Height))
+	if err != nil {
+		log.Error().Err(err).Str("component", "driver").Str("name", x.config.Name).Str("format", format.name).Msg("SetImageFormat")
+		return err
+	}
+	// raw frames are only understood at the configured size
+	if format.imageType != base.JPEG && (int(width) != x.config.Width || int(height) != x.config.Height) {
+		err = fmt.Errorf("%s is %dx%d on this camera, not %dx%d", format.name, width, height, x.config.Width, x.config.Height)
 		log.Error().Err(err).Str("component", "driver").Str("name", x.config.Name).Msg("SetImageFormat")
 		return err
 	}
+	x.pixelType = format.imageType
 	x.stop = false
 	return x.webcam.StartStreaming()
 }
@@ -128,12 +201,16 @@ func (x *Driver) Open() error {
 func (x *Driver) Stop() {
 	x.mutex.Lock()
 	x.stop = true
-	x.frame = base.EmptyFrame(x.config.Width, x.config.Height)
-	err := x.webcam.StopStreaming()
-	if err != nil {
-		log.Error().Err(err).Str("component", "driver").Str("name", x.config.Name).Msg("StopStreaming")
+	x.frames.Clear()
+	// a device that failed to open has nothing to stop
+	if x.webcam != nil {
+		err := x.webcam.StopStreaming()
+		if err != nil {
+			log.Error().Err(err).Str("component", "driver").Str("name", x.config.Name).Msg("StopStreaming")
+		}
+		x.webcam.Close()
+		x.webcam = nil
 	}
-	x.webcam.Close()
 	x.mutex.Unlock()
 }
 
@@ -141,7 +218,7 @@ func (x *Driver) Reset() error {
 	x.Stop()
 	err := x.Open()
 	if err != nil {
-		json, err := json.Marshal(x.config)
+		json, _ := json.Marshal(x.config)
 		log.Error().Err(err).Str("component", "driver").Str("name", x.config.Name).RawJSON("config", json).Msg("Open")
 		return err
 	}
@@ -157,7 +234,10 @@ func (x *Driver) stream() {
 			x.mutex.Unlock()
 			return
 		}
-		x.frame = x.grab()
+		capture := x.grab()
+		if capture != nil {
+			x.frames.Publish(capture)
+		}
 		x.mutex.Unlock()
 		base.Sleep(int64(x.config.Rate), time.Now().UnixMilli()-startTime)
 	}
@@ -0,0 +1,41 @@
+// Copyright © 2023 Sloan Childers
+package blackjack
+
+import (
+	"testing"
+
+	"github.com/blackjack/webcam"
+	"github.com/osintami/camz/base"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestChoosePixelFormat(t *testing.T) {
+	// a cheap camera without MJPEG
+	supported := map[webcam.PixelFormat]string{
+		V4L2_PIX_FMT_YUYV: "YUYV 4:2:2",
+		V4L2_PIX_FMT_GREY: "8-bit Greyscale",
+	}
+	format, err := choosePixelFormat("", supported)
+	assert.NoError(t, err)
+	assert.Equal(t, base.YUV422, format.imageType)
+
+	format, err = choosePixelFormat("grey", supported)
+	assert.NoError(t, err)
+	assert.Equal(t, webcam.PixelFormat(V4L2_PIX_FMT_GREY), format.code)
+
+	_, err = choosePixelFormat("MJPG", supported)
+	assert.ErrorIs(t, err, ErrPixelFormat)
+	assert.Contains(t, err.Error(), "8-bit Greyscale, YUYV 4:2:2")
+}
+
+func TestDriverMissingDevice(t *testing.T) {
+	config := &base.CameraConfig{Name: "unplugged", Device: 99, Width: 640, Height: 480, Rate: 10}
+	x := NewDriver(config)
+	assert.Error(t, x.Open())
+	// closed, the supervisor and /v1/formats can still call in
+	assert.Empty(t, x.ListFormatsAndFrameSizes().Formats)
+	assert.False(t, x.CheckSize(640, 480))
+	x.Stop()
+	assert.Error(t, x.Reset())
+	x.Stop()
+}
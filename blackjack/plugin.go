@@ -0,0 +1,16 @@
+// Copyright © 2023 Sloan Childers
+package blackjack
+
+import "github.com/osintami/camz/base"
+
+func init() {
+	base.Register(base.Plugin{
+		Name:        "blackjack",
+		Description: "local V4L2 camera, MJPEG or raw frames, with image controls",
+		Config: []base.PluginField{
+			{Name: "Device", Type: "int", Description: "N of /dev/videoN"},
+			{Name: "Format", Type: "string", Description: "fourcc MJPG, YUYV, RGB3 or GREY, the best the camera has when missing"},
+			{Name: "Controls", Type: "object", Description: "V4L2 control values by key, see /v1/controls"},
+		},
+		New: func(config *base.CameraConfig) base.IDriver { return NewDriver(config) }})
+}
@@ -0,0 +1,353 @@
+// Copyright © 2023 Sloan Childers
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/google/uuid"
+	"github.com/osintami/camz/base"
+	"github.com/osintami/camz/opencv"
+	"github.com/osintami/camz/sink"
+
+	// the plugins register their drivers
+	_ "github.com/osintami/camz/axis"
+	_ "github.com/osintami/camz/blackjack"
+	_ "github.com/osintami/camz/netcam"
+	_ "github.com/osintami/camz/replay"
+	_ "github.com/osintami/camz/rtsp"
+	_ "github.com/osintami/camz/testsrc"
+	"github.com/rs/zerolog/log"
+)
+
+var ErrCameraNotFound = errors.New("camera not found")
+var ErrForbidden = errors.New("api key not allowed")
+
+// Camz owns every camera configured in camera.json and routes requests to them by uuid.
+type Camz struct {
+	file    string
+	cfg     *Config
+	configs *base.Cameras
+	servers []*CamzServer
+	byUuid  map[string]*CamzServer
+	mutex   sync.Mutex
+}
+
+type CameraSummary struct {
+	Uuid    string
+	Name    string
+	Plugin  string
+	Enabled bool
+	Width   int
+	Height  int
+	Rate    float32
+	// state of the driver, missing for cameras that aren't running
+	Driver *base.DriverStatus `json:"Driver,omitempty"`
+}
+
+// LoadCameras reads a list of cameras from file, falling back to the original single camera layout.
+func LoadCameras(file string) (*base.Cameras, bool, error) {
+	cameras := &base.Cameras{}
+	err := sink.LoadJson(file, cameras)
+	if err != nil {
+		return nil, false, err
+	}
+	dirty := false
+	if len(cameras.Cameras) == 0 {
+		config := &base.CameraConfig{}
+		err = sink.LoadJson(file, config)
+		if err != nil {
+			return nil, false, err
+		}
+		// a single camera file was always started, regardless of the Enabled flag
+		config.Enabled = true
+		cameras.Cameras = append(cameras.Cameras, config)
+		dirty = true
+	}
+	for _, config := range cameras.Cameras {
+		if config.Uuid == "" {
+			config.Uuid = uuid.NewString()
+			dirty = true
+		}
+		if config.Motion == nil {
+			config.Motion = &base.MotionConfig{}
+		}
+		// the same checks as a config update, a bad file fails here and not in a driver
+		err = config.Validate()
+		if err != nil {
+			return nil, false, fmt.Errorf("camera %q: %w", config.Name, err)
+		}
+	}
+	if cameras.MigrateApiKeys() {
+		log.Info().Str("component", "auth").Msg("plaintext api keys replaced by hashed admin keys")
+		dirty = true
+	}
+	if len(cameras.ApiKeys) == 0 {
+		// without any key nothing is reachable, so hand out a first admin key once
+		apiKey, key, err := base.NewApiKey("admin", base.ROLE_ADMIN)
+		if err != nil {
+			return nil, false, err
+		}
+		// logs are kept and shipped, so the key only goes to a file its owner can read
+		path := adminKeyPath(file)
+		err = writeAdminKey(path, key)
+		if err != nil {
+			return nil, false, err
+		}
+		cameras.ApiKeys = append(cameras.ApiKeys, apiKey)
+		log.Warn().Str("component", "auth").Str("file", path).Msg("created admin api key, read it from the file and delete the file")
+		dirty = true
+	}
+	return cameras, dirty, nil
+}
+
+func NewCamz(file string, cfg *Config, configs *base.Cameras) *Camz {
+	return &Camz{
+		file:    file,
+		cfg:     cfg,
+		configs: configs,
+		byUuid:  make(map[string]*CamzServer)}
+}
+
+// NewDriver returns the driver of the camera's plugin, under a supervisor that
+// reconnects it.
+func NewDriver(config *base.CameraConfig) (base.IDriver, error) {
+	driver, err := base.NewPluginDriver(config)
+	if err != nil {
+		return nil, err
+	}
+	return base.NewSupervisor(driver, config), nil
+}
+
+// Start creates and opens a driver, motion detector and server for every enabled camera.
+// Every driver is created before any camera starts, so a bad plugin stops nothing
+// half way.
+func (x *Camz) Start(gps *base.GPS, shutdown *sink.ShutdownHandler) error {
+	configs := []*base.CameraConfig{}
+	webcams := []base.IDriver{}
+	uuids := map[string]bool{}
+	for _, config := range x.configs.Cameras {
+		if !config.Enabled {
+			log.Info().Str("component", "server").Str("name", config.Name).Str("uuid", config.Uuid).Msg("camera disabled")
+			continue
+		}
+		if uuids[config.Uuid] {
+			log.Error().Str("component", "server").Str("name", config.Name).Str("uuid", config.Uuid).Msg("duplicate camera uuid")
+			return errors.New("duplicate camera uuid " + config.Uuid)
+		}
+		uuids[config.Uuid] = true
+		webcam, err := NewDriver(config)
+		if err != nil {
+			log.Error().Err(err).Str("component", "server").Str("name", config.Name).Str("plugin", config.Plugin).Msg("driver")
+			return fmt.Errorf("camera %q: %w", config.Name, err)
+		}
+		configs = append(configs, config)
+		webcams = append(webcams, webcam)
+	}
+
+	for i, config := range configs {
+		webcam := webcams[i]
+		server := NewCamzServer(webcam, opencv.NewMotion(config), gps, x.cfg, config)
+		server.camz = x
+		x.servers = append(x.servers, server)
+		x.byUuid[config.Uuid] = server
+		shutdown.AddListener(server.detector.Stop)
+		shutdown.AddListener(server.clips.Stop)
+		shutdown.AddListener(server.segments.Stop)
+		shutdown.AddListener(server.pipeline.Stop)
+
+		err := webcam.Open()
+		if err != nil {
+			// the supervisor keeps trying, a camera may be up later than the server
+			log.Error().Err(err).Str("component", "server").Str("name", config.Name).Str("uuid", config.Uuid).Msg("webcam")
+		}
+		webcam.Stream()
+		// the driver is replaced by a config update
+		shutdown.AddListener(func() { server.pipeline.driver().Stop() })
+		server.pipeline.Start()
+		server.detector.Start()
+		server.clips.Start()
+		server.segments.Start()
+	}
+	return nil
+}
+
+// Save writes every camera configuration back to camera.json.  The file is written
+// next to it first and renamed over it, so a crash never leaves half a file behind.
+func (x *Camz) Save() error {
+	x.mutex.Lock()
+	defer x.mutex.Unlock()
+	return x.write()
+}
+
+// saveCamera saves camera.json with config in place of the camera with its uuid,
+// the configuration is left as it was when the file can't be written.
+func (x *Camz) saveCamera(config *base.CameraConfig) error {
+	x.mutex.Lock()
+	defer x.mutex.Unlock()
+	previous := x.swap(config)
+	err := x.write()
+	if err != nil {
+		x.swap(previous)
+	}
+	return err
+}
+
+func (x *Camz) write() error {
+	data, err := json.MarshalIndent(x.configs, "", "   ")
+	if err != nil {
+		return err
+	}
+	// CreateTemp makes the file 0600, camera.json holds passwords and key hashes
+	file, err := os.CreateTemp(filepath.Dir(x.file), "."+filepath.Base(x.file)+"-*")
+	if err != nil {
+		return err
+	}
+	_, err = file.Write(data)
+	if err == nil {
+		err = file.Sync()
+	}
+	closeErr := file.Close()
+	if err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(file.Name(), x.file)
+	}
+	if err != nil {
+		os.Remove(file.Name())
+	}
+	return err
+}
+
+// replace puts config in place of the camera with its uuid, for the next Save.
+func (x *Camz) replace(config *base.CameraConfig) {
+	x.mutex.Lock()
+	defer x.mutex.Unlock()
+	x.swap(config)
+}
+
+// swap replaces the camera with the uuid of config and returns the one it replaced.
+func (x *Camz) swap(config *base.CameraConfig) *base.CameraConfig {
+	for i, camera := range x.configs.Cameras {
+		if camera.Uuid == config.Uuid {
+			x.configs.Cameras[i] = config
+			return camera
+		}
+	}
+	return nil
+}
+
+func (x *Camz) Camera(uuid string) *CamzServer {
+	return x.byUuid[uuid]
+}
+
+// Default is the camera served by the original single camera routes.
+func (x *Camz) Default() *CamzServer {
+	if len(x.servers) == 0 {
+		return nil
+	}
+	return x.servers[0]
+}
+
+// CameraHandler routes a request to the camera named by the {uuid} path parameter.
+func (x *Camz) CameraHandler(handler func(*CamzServer, http.ResponseWriter, *http.Request)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		server := x.Camera(sink.Param(r, "uuid"))
+		if server == nil {
+			sink.SendError(w, ErrCameraNotFound, http.StatusNotFound)
+			return
+		}
+		handler(server, w, r)
+	}
+}
+
+// DefaultHandler routes a request to the default camera.
+func (x *Camz) DefaultHandler(handler func(*CamzServer, http.ResponseWriter, *http.Request)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		server := x.Default()
+		if server == nil {
+			sink.SendError(w, ErrCameraNotFound, http.StatusNotFound)
+			return
+		}
+		handler(server, w, r)
+	}
+}
+
+// apiKey returns the configured key of a request, taken from the key query parameter
+// or the X-Api-Key header, and logs requests without a valid one.
+func (x *Camz) apiKey(r *http.Request) *base.ApiKey {
+	key := r.URL.Query().Get("key")
+	if key == "" {
+		key = r.Header.Get("X-Api-Key")
+	}
+	x.mutex.Lock()
+	apiKey := x.configs.FindApiKey(key)
+	x.mutex.Unlock()
+	if apiKey == nil {
+		log.Warn().Str("component", "auth").Str("remote", r.RemoteAddr).Str("path", r.URL.Path).Bool("missing", key == "").Msg("api key invalid")
+	}
+	return apiKey
+}
+
+// checkAPIKey sends an error and returns false unless the request has a key with role on camera.
+func (x *Camz) checkAPIKey(w http.ResponseWriter, r *http.Request, camera string, role base.Role) bool {
+	apiKey := x.apiKey(r)
+	if apiKey == nil {
+		sink.SendError(w, ErrApiKey, http.StatusUnauthorized)
+		return false
+	}
+	if !apiKey.Allows(camera, role) {
+		log.Warn().Str("component", "auth").Str("remote", r.RemoteAddr).Str("path", r.URL.Path).Str("key", apiKey.Name).Str("role", string(apiKey.Role)).Str("required", string(role)).Msg("api key not allowed")
+		sink.SendError(w, ErrForbidden, http.StatusForbidden)
+		return false
+	}
+	return true
+}
+
+// PluginsHandler lists the drivers of this build with the settings they read.
+func (x *Camz) PluginsHandler(w http.ResponseWriter, r *http.Request) {
+	if x.apiKey(r) == nil {
+		sink.SendError(w, ErrApiKey, http.StatusUnauthorized)
+		return
+	}
+	sink.SendPrettyJSON(r.Context(), w, base.Plugins())
+}
+
+func (x *Camz) ListHandler(w http.ResponseWriter, r *http.Request) {
+	apiKey := x.apiKey(r)
+	if apiKey == nil {
+		sink.SendError(w, ErrApiKey, http.StatusUnauthorized)
+		return
+	}
+
+	x.mutex.Lock()
+	configs := append([]*base.CameraConfig{}, x.configs.Cameras...)
+	x.mutex.Unlock()
+
+	// only the cameras the key can view
+	cameras := []CameraSummary{}
+	for _, config := range configs {
+		if !apiKey.Allows(config.Uuid, base.ROLE_VIEWER) {
+			continue
+		}
+		summary := CameraSummary{
+			Uuid:    config.Uuid,
+			Name:    config.Name,
+			Plugin:  config.Plugin,
+			Enabled: config.Enabled,
+			Width:   config.Width,
+			Height:  config.Height,
+			Rate:    config.Rate}
+		if server := x.Camera(config.Uuid); server != nil {
+			summary.Driver = server.driverStatus()
+		}
+		cameras = append(cameras, summary)
+	}
+	sink.SendPrettyJSON(r.Context(), w, cameras)
+}
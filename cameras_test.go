@@ -0,0 +1,209 @@
+// Copyright © 2023 Sloan Childers
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/osintami/camz/base"
+	"github.com/osintami/camz/sink"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLoadCamerasList(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "camera.json")
+	data := `{"Cameras": [
+		{"Uuid": "door", "Name": "door", "Plugin": "testsrc", "Width": 320, "Height": 240, "Rate": 5},
+		{"Name": "yard", "Plugin": "testsrc", "Width": 320, "Height": 240, "Rate": 5}]}`
+	assert.NoError(t, os.WriteFile(file, []byte(data), 0600))
+	cameras, dirty, err := LoadCameras(file)
+	assert.NoError(t, err)
+	assert.True(t, dirty)
+	assert.Len(t, cameras.Cameras, 2)
+
+	// a uuid is kept, a missing one is assigned
+	assert.Equal(t, "door", cameras.Cameras[0].Uuid)
+	assert.NotEmpty(t, cameras.Cameras[1].Uuid)
+	assert.NotEqual(t, "door", cameras.Cameras[1].Uuid)
+	assert.False(t, cameras.Cameras[1].Enabled)
+	for _, config := range cameras.Cameras {
+		assert.NotNil(t, config.Motion)
+	}
+}
+
+func TestLoadCamerasSingle(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "camera.json")
+	data := `{"Name": "door", "Plugin": "testsrc", "Width": 320, "Height": 240, "Rate": 5}`
+	assert.NoError(t, os.WriteFile(file, []byte(data), 0600))
+	cameras, dirty, err := LoadCameras(file)
+	assert.NoError(t, err)
+	assert.True(t, dirty)
+	assert.Len(t, cameras.Cameras, 1)
+
+	// the original layout is one camera, always started
+	config := cameras.Cameras[0]
+	assert.Equal(t, "door", config.Name)
+	assert.True(t, config.Enabled)
+	assert.NotEmpty(t, config.Uuid)
+	assert.NotNil(t, config.Motion)
+}
+
+func TestCameraRoutes(t *testing.T) {
+	door, yard := &CamzServer{}, &CamzServer{}
+	names := map[*CamzServer]string{door: "door", yard: "yard"}
+	camz := &Camz{
+		servers: []*CamzServer{door, yard},
+		byUuid:  map[string]*CamzServer{"door-uuid": door, "yard-uuid": yard}}
+	name := func(server *CamzServer, w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(names[server]))
+	}
+	router := chi.NewMux()
+	router.Get("/v1/cameras/{uuid}/name", camz.CameraHandler(name))
+	router.Get("/v1/name", camz.DefaultHandler(name))
+
+	get := func(path string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+		return w
+	}
+	assert.Equal(t, "door", get("/v1/cameras/door-uuid/name").Body.String())
+	assert.Equal(t, "yard", get("/v1/cameras/yard-uuid/name").Body.String())
+	// the single camera routes go to the first camera
+	assert.Equal(t, "door", get("/v1/name").Body.String())
+	assert.Equal(t, http.StatusNotFound, get("/v1/cameras/gate-uuid/name").Code)
+
+	empty := &Camz{byUuid: map[string]*CamzServer{}}
+	router.Get("/v1/empty", empty.DefaultHandler(name))
+	assert.Equal(t, http.StatusNotFound, get("/v1/empty").Code)
+}
+
+func TestLoadCamerasValidates(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "camera.json")
+	camera := `{"Name": "door", "Plugin": "testsrc", "Width": 320, "Height": 240, "Rate": 5, "Motion": {"BeforeSeconds": %d}}`
+	assert.NoError(t, os.WriteFile(file, []byte(`{"Cameras": [`+fmt.Sprintf(camera, 2)+`]}`), 0600))
+	cameras, dirty, err := LoadCameras(file)
+	assert.NoError(t, err)
+	assert.True(t, dirty)
+	assert.Equal(t, 2, cameras.Cameras[0].Motion.BeforeSeconds)
+
+	assert.NoError(t, os.WriteFile(file, []byte(`{"Cameras": [`+fmt.Sprintf(camera, -2)+`]}`), 0600))
+	_, _, err = LoadCameras(file)
+	assert.True(t, errors.Is(err, base.ErrInvalidConfig))
+	assert.Contains(t, err.Error(), "door")
+}
+
+func TestLoadCamerasAdminKey(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "camera.json")
+	assert.NoError(t, os.WriteFile(file, []byte(`{"Cameras": [{"Name": "door", "Plugin": "testsrc", "Width": 320, "Height": 240, "Rate": 5}]}`), 0600))
+	cameras, _, err := LoadCameras(file)
+	assert.NoError(t, err)
+	assert.Len(t, cameras.ApiKeys, 1)
+
+	// the key is in a file only its owner can read
+	info, err := os.Stat(filepath.Join(dir, ADMIN_KEY_FILE))
+	assert.NoError(t, err)
+	assert.Equal(t, os.FileMode(0600), info.Mode().Perm())
+	data, err := os.ReadFile(filepath.Join(dir, ADMIN_KEY_FILE))
+	assert.NoError(t, err)
+	assert.Equal(t, cameras.ApiKeys[0], cameras.FindApiKey(strings.TrimSpace(string(data))))
+}
+
+func TestCamzStartPlugins(t *testing.T) {
+	cameras := &base.Cameras{}
+	for i, plugin := range []string{"fake", "fake", "fkae"} {
+		config := testConfig()
+		config.Uuid = fmt.Sprintf("camera-%d", i)
+		config.Plugin = plugin
+		config.Enabled = true
+		cameras.Cameras = append(cameras.Cameras, config)
+	}
+	camz := NewCamz(filepath.Join(t.TempDir(), "camera.json"), &Config{}, cameras)
+	fakes.mutex.Lock()
+	created := len(fakes.drivers)
+	fakes.mutex.Unlock()
+
+	// the third plugin is found out before the first two cameras start
+	err := camz.Start(base.NewGPS(1), sink.NewShutdownHandler())
+	assert.True(t, errors.Is(err, base.ErrUnknownPlugin))
+	assert.Empty(t, camz.servers)
+	fakes.mutex.Lock()
+	defer fakes.mutex.Unlock()
+	assert.Len(t, fakes.drivers, created+2)
+	for _, driver := range fakes.drivers[created:] {
+		assert.Equal(t, 0, driver.opens)
+	}
+}
+
+// newTestCamz serves one camera on a fake driver, with a key for every role.
+func newTestCamz(t *testing.T, driver base.IDriver, config *base.CameraConfig) (*Camz, http.Handler, map[base.Role]string) {
+	dir := t.TempDir()
+	cameras := &base.Cameras{Cameras: []*base.CameraConfig{config}}
+	keys := map[base.Role]string{}
+	for _, role := range []base.Role{base.ROLE_VIEWER, base.ROLE_OPERATOR, base.ROLE_ADMIN} {
+		apiKey, key, err := base.NewApiKey(string(role), role)
+		assert.NoError(t, err)
+		cameras.ApiKeys = append(cameras.ApiKeys, apiKey)
+		keys[role] = key
+	}
+	cfg := &Config{ClipDir: filepath.Join(dir, "clips"), RecordDir: filepath.Join(dir, "recordings")}
+	camz := NewCamz(filepath.Join(dir, "camera.json"), cfg, cameras)
+	server := NewCamzServer(driver, fakeMotion{}, base.NewGPS(1), cfg, config)
+	server.camz = camz
+	camz.servers = append(camz.servers, server)
+	camz.byUuid[config.Uuid] = server
+	return camz, NewRouter("/", camz), keys
+}
+
+func request(handler http.Handler, method, path, key, body string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(method, path, strings.NewReader(body))
+	if key != "" {
+		r.Header.Set("X-Api-Key", key)
+	}
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	return w
+}
+
+func TestCheckAPIKey(t *testing.T) {
+	config := testConfig()
+	camz, router, keys := newTestCamz(t, newFakeDriver(config, false), config)
+	camera := "/v1/cameras/" + config.Uuid
+	tests := []struct {
+		path string
+		key  string
+		code int
+	}{
+		{camera + "/motion", "", http.StatusUnauthorized},
+		{camera + "/motion", "changeme", http.StatusUnauthorized},
+		{camera + "/motion", keys[base.ROLE_VIEWER], http.StatusOK},
+		{"/v1/motion", keys[base.ROLE_VIEWER], http.StatusOK},
+		{camera + "/command", keys[base.ROLE_VIEWER], http.StatusForbidden},
+		{camera + "/command", keys[base.ROLE_OPERATOR], http.StatusOK},
+		{camera + "/command", keys[base.ROLE_ADMIN], http.StatusOK},
+		{camera + "/config", keys[base.ROLE_OPERATOR], http.StatusForbidden},
+		{"/v1/config", keys[base.ROLE_OPERATOR], http.StatusForbidden},
+		{camera + "/config", keys[base.ROLE_ADMIN], http.StatusOK},
+		{"/v1/cameras/other/motion", keys[base.ROLE_ADMIN], http.StatusNotFound},
+	}
+	for _, test := range tests {
+		assert.Equal(t, test.code, request(router, "GET", test.path, test.key, "").Code, test.path)
+	}
+
+	// a key for another camera can't see this one
+	apiKey, key, err := base.NewApiKey("garage", base.ROLE_ADMIN)
+	assert.NoError(t, err)
+	apiKey.Cameras = []string{"garage"}
+	camz.configs.ApiKeys = append(camz.configs.ApiKeys, apiKey)
+	assert.Equal(t, http.StatusForbidden, request(router, "GET", camera+"/motion", key, "").Code)
+	w := request(router, "GET", "/v1/cameras", key, "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, "[]", w.Body.String())
+}
@@ -12,11 +12,24 @@ import (
 func main() {
 	svr := getopt.StringLong("svr", 's', "localhost:8080", "mjpeg server addr:port")
 	key := getopt.StringLong("api-key", 'a', "changeme", "mjpeg server API key")
+	id := getopt.StringLong("uuid", 'u', "", "camera uuid, defaults to the first camera")
 	getopt.Parse()
-	config := &base.CameraConfig{}
-	sink.LoadJson("camera.json", config)
+	cameras := &base.Cameras{}
+	sink.LoadJson("camera.json", cameras)
 
-	url := fmt.Sprintf("http://%s/v1/config", *svr)
+	var config *base.CameraConfig
+	for _, camera := range cameras.Cameras {
+		if *id == "" || camera.Uuid == *id {
+			config = camera
+			break
+		}
+	}
+	if config == nil {
+		fmt.Println("camera not found in camera.json")
+		return
+	}
+
+	url := fmt.Sprintf("http://%s/v1/cameras/%s/config", *svr, config.Uuid)
 	resp, err := resty.New().R().SetHeader("Content-Type", "application/json").SetHeader("X-Api-Key", *key).SetBody(config).Post(url)
 	if err != nil {
 		fmt.Println("http status ", resp.StatusCode())
@@ -0,0 +1,194 @@
+// Copyright © 2023 Sloan Childers
+package main
+
+import (
+	"sync"
+	"time"
+
+	"github.com/osintami/camz/base"
+	"github.com/rs/zerolog/log"
+)
+
+type MotionState struct {
+	Armed      bool
+	Triggered  bool
+	Running    bool
+	Detections uint64
+	LastMotion *time.Time        `json:",omitempty"`
+	Event      *base.MotionEvent `json:",omitempty"`
+	Events     []base.MotionEvent
+}
+
+// Detector runs motion detection in its own goroutine on the frames the pipeline
+// offers it, whether or not anyone is watching the stream.  Single detections are
+// grouped into events, the detector is triggered while an event is active.
+type Detector struct {
+	config     *base.CameraConfig
+	motion     base.IMotion
+	events     *base.EventTracker
+	frames     chan base.IFrame
+	stop       chan struct{}
+	done       chan struct{}
+	listeners  []func(started, ended *base.MotionEvent)
+	detections uint64
+	lastMotion time.Time
+	// frames offered while the previous one was analysed, and the analysis time
+	skipped uint64
+	timing  base.Timing
+	mutex   sync.Mutex
+}
+
+func NewDetector(motion base.IMotion, config *base.CameraConfig) *Detector {
+	return &Detector{
+		config: config,
+		motion: motion,
+		events: base.NewEventTracker(config),
+		frames: make(chan base.IFrame, 1)}
+}
+
+// AddListener registers f to be told when a motion event starts or ends.
+func (x *Detector) AddListener(f func(started, ended *base.MotionEvent)) {
+	x.mutex.Lock()
+	defer x.mutex.Unlock()
+	x.listeners = append(x.listeners, f)
+}
+
+func (x *Detector) Start() {
+	x.mutex.Lock()
+	defer x.mutex.Unlock()
+	if x.stop != nil {
+		return
+	}
+	x.stop = make(chan struct{})
+	x.done = make(chan struct{})
+	go x.run(x.stop, x.done)
+}
+
+// Stop waits for the frame under analysis, then ends the active event.
+func (x *Detector) Stop() {
+	x.mutex.Lock()
+	stop, done := x.stop, x.done
+	x.stop, x.done = nil, nil
+	x.mutex.Unlock()
+	if stop != nil {
+		close(stop)
+		<-done
+	}
+	x.notify(nil, x.events.Close(time.Now()))
+}
+
+// SetConfig replaces the configuration of a stopped detector, events carry on.
+func (x *Detector) SetConfig(config *base.CameraConfig) {
+	x.mutex.Lock()
+	defer x.mutex.Unlock()
+	x.config = config
+	x.motion.SetConfig(config)
+	x.events.SetConfig(config)
+}
+
+// NeedsFrames reports whether the detector is armed, or still has an event to finish.
+func (x *Detector) NeedsFrames() bool {
+	x.mutex.Lock()
+	running, enabled := x.stop != nil, x.config.Motion.Enabled
+	x.mutex.Unlock()
+	return running && (enabled || x.Triggered())
+}
+
+// Offer hands a copy of frame to the detector, dropping it if the previous one is still being analysed.
+func (x *Detector) Offer(frame base.IFrame) {
+	clone := frame.Clone()
+	select {
+	case x.frames <- clone:
+	default:
+		clone.Close()
+		x.mutex.Lock()
+		x.skipped++
+		x.mutex.Unlock()
+	}
+}
+
+// stats fills in the figures of motion analysis.
+func (x *Detector) stats(stats *CameraStats) {
+	stats.Motion = x.timing.Stats()
+	x.mutex.Lock()
+	defer x.mutex.Unlock()
+	stats.Dropped.Motion = x.skipped
+}
+
+func (x *Detector) Triggered() bool {
+	return x.events.Current() != nil
+}
+
+func (x *Detector) State() MotionState {
+	x.mutex.Lock()
+	defer x.mutex.Unlock()
+	state := MotionState{
+		Armed:      x.config.Motion.Enabled && x.stop != nil,
+		Running:    x.stop != nil,
+		Detections: x.detections,
+		Event:      x.events.Current(),
+		Events:     x.events.History()}
+	state.Triggered = state.Event != nil
+	if !x.lastMotion.IsZero() {
+		lastMotion := x.lastMotion
+		state.LastMotion = &lastMotion
+	}
+	return state
+}
+
+func (x *Detector) run(stop, done chan struct{}) {
+	defer close(done)
+	for {
+		select {
+		case <-stop:
+			select {
+			case frame := <-x.frames:
+				frame.Close()
+			default:
+			}
+			return
+		case frame := <-x.frames:
+			x.detect(frame)
+		}
+	}
+}
+
+func (x *Detector) detect(frame base.IFrame) {
+	defer frame.Close()
+	x.mutex.Lock()
+	enabled := x.config.Motion.Enabled
+	x.mutex.Unlock()
+	intruder := false
+	if enabled {
+		start := time.Now()
+		intruder = x.motion.Detect(frame)
+		x.timing.Since(start)
+	}
+
+	x.mutex.Lock()
+	if intruder {
+		x.detections++
+		x.lastMotion = frame.Time()
+	}
+	x.mutex.Unlock()
+	started, ended := x.events.Update(intruder, frame.Time())
+	x.notify(started, ended)
+}
+
+func (x *Detector) notify(started, ended *base.MotionEvent) {
+	if started == nil && ended == nil {
+		return
+	}
+	x.mutex.Lock()
+	listeners, name := x.listeners, x.config.Name
+	x.mutex.Unlock()
+	for _, listener := range listeners {
+		listener(started, ended)
+	}
+	if started != nil {
+		log.Info().Str("component", "motion").Str("name", name).Str("event", started.Id).Time("start", started.Start).Msg("motion event started")
+	}
+	if ended != nil {
+		log.Info().Str("component", "motion").Str("name", name).Str("event", ended.Id).Time("start", ended.Start).Time("end", *ended.End).Int("detections", ended.Detections).Msg("motion event ended")
+	}
+}
@@ -0,0 +1,106 @@
+// Copyright © 2023 Sloan Childers
+package main
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/osintami/camz/base"
+	"github.com/stretchr/testify/assert"
+)
+
+// blockingMotion detects motion in every frame, each Detect waits for a release.
+type blockingMotion struct {
+	release  chan struct{}
+	detected int
+	mutex    sync.Mutex
+}
+
+func (x *blockingMotion) Detect(frame base.IFrame) bool {
+	<-x.release
+	x.mutex.Lock()
+	defer x.mutex.Unlock()
+	x.detected++
+	return true
+}
+
+func (x *blockingMotion) SetConfig(config *base.CameraConfig) {}
+
+func (x *blockingMotion) count() int {
+	x.mutex.Lock()
+	defer x.mutex.Unlock()
+	return x.detected
+}
+
+func testFrame(config *base.CameraConfig, at time.Time) base.IFrame {
+	return base.NewCaptureFrame(config, &base.Capture{Image: base.EmptyFrame(config.Width, config.Height), Type: base.JPEG, Time: at})
+}
+
+func TestDetectorOffer(t *testing.T) {
+	config := testConfig()
+	config.Motion.Enabled = true
+	motion := &blockingMotion{release: make(chan struct{})}
+	x := NewDetector(motion, config)
+	assert.False(t, x.NeedsFrames())
+	x.Start()
+	assert.True(t, x.NeedsFrames())
+
+	// one frame analysed, one waiting, the rest skipped
+	frame := testFrame(config, time.Now())
+	defer frame.Close()
+	x.Offer(frame)
+	assert.Eventually(t, func() bool { return len(x.frames) == 0 }, time.Second, time.Millisecond)
+	x.Offer(frame)
+	x.Offer(frame)
+	x.Offer(frame)
+	stats := &CameraStats{}
+	x.stats(stats)
+	assert.Equal(t, uint64(2), stats.Dropped.Motion)
+
+	close(motion.release)
+	assert.Eventually(t, func() bool { return motion.count() == 2 }, time.Second, time.Millisecond)
+	x.Stop()
+	assert.False(t, x.NeedsFrames())
+}
+
+func TestDetectorState(t *testing.T) {
+	config := testConfig()
+	config.Motion.Enabled = true
+	config.Motion.Detections = 2
+	motion := &blockingMotion{release: make(chan struct{})}
+	close(motion.release)
+	x := NewDetector(motion, config)
+	events := []string{}
+	x.AddListener(func(started, ended *base.MotionEvent) {
+		if started != nil {
+			events = append(events, "started")
+		}
+		if ended != nil {
+			events = append(events, "ended")
+		}
+	})
+	x.Start()
+	assert.Equal(t, MotionState{Armed: true, Running: true, Events: []base.MotionEvent{}}, x.State())
+
+	// two detections in the window make an event
+	now := time.Now()
+	for i := 0; i < 2; i++ {
+		frame := testFrame(config, now.Add(time.Duration(i)*100*time.Millisecond))
+		x.detect(frame.Clone())
+		frame.Close()
+	}
+	state := x.State()
+	assert.True(t, state.Triggered)
+	assert.Equal(t, uint64(2), state.Detections)
+	assert.Equal(t, now.Add(100*time.Millisecond), *state.LastMotion)
+	assert.Equal(t, []string{"started"}, events)
+
+	// stopping ends the event
+	x.Stop()
+	state = x.State()
+	assert.False(t, state.Armed)
+	assert.False(t, state.Triggered)
+	assert.Equal(t, 1, len(state.Events))
+	assert.Equal(t, []string{"started", "ended"}, events)
+}
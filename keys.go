@@ -0,0 +1,219 @@
+// Copyright © 2023 Sloan Childers
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+
+	"github.com/osintami/camz/base"
+	"github.com/osintami/camz/sink"
+	"github.com/rs/zerolog/log"
+)
+
+// the first admin key is written here, next to camera.json, and never logged
+const ADMIN_KEY_FILE = "admin.key"
+
+var ErrKeyName = errors.New("api key name is required")
+var ErrKeyRole = errors.New("api key role must be viewer, operator or admin")
+var ErrKeyExists = errors.New("api key name already taken")
+var ErrKeyNotFound = errors.New("api key not found")
+var ErrLastAdmin = errors.New("last admin key for every camera can't be deleted")
+
+// KeyRequest creates a named key, limited to Cameras when they are given.
+type KeyRequest struct {
+	Name    string
+	Role    base.Role
+	Cameras []string `json:"Cameras,omitempty"`
+}
+
+// KeySummary is a key without its hash, Key is only set in the answer that created it.
+type KeySummary struct {
+	Name    string
+	Role    base.Role
+	Cameras []string `json:"Cameras,omitempty"`
+	Key     string   `json:"Key,omitempty"`
+}
+
+// writeAdminKey saves a new key readable by its owner only, replacing an old file.
+func writeAdminKey(path, key string) error {
+	err := os.Remove(path)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintln(file, key)
+	closeErr := file.Close()
+	if err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// adminKey sends an error and returns nil unless the request has an admin key
+// for every camera, the only keys that manage keys.
+func (x *Camz) adminKey(w http.ResponseWriter, r *http.Request) *base.ApiKey {
+	apiKey := x.apiKey(r)
+	if apiKey == nil {
+		sink.SendError(w, ErrApiKey, http.StatusUnauthorized)
+		return nil
+	}
+	if apiKey.Role != base.ROLE_ADMIN || len(apiKey.Cameras) > 0 {
+		log.Warn().Str("component", "auth").Str("remote", r.RemoteAddr).Str("path", r.URL.Path).Str("key", apiKey.Name).Msg("api key not allowed")
+		sink.SendError(w, ErrForbidden, http.StatusForbidden)
+		return nil
+	}
+	return apiKey
+}
+
+// KeysHandler lists the keys by name and role.
+func (x *Camz) KeysHandler(w http.ResponseWriter, r *http.Request) {
+	if x.adminKey(w, r) == nil {
+		return
+	}
+
+	x.mutex.Lock()
+	keys := []KeySummary{}
+	for _, apiKey := range x.configs.ApiKeys {
+		keys = append(keys, KeySummary{Name: apiKey.Name, Role: apiKey.Role, Cameras: apiKey.Cameras})
+	}
+	x.mutex.Unlock()
+	sink.SendPrettyJSON(r.Context(), w, keys)
+}
+
+// KeyCreateHandler creates a key from a KeyRequest and answers with the key,
+// the only time it is shown.
+func (x *Camz) KeyCreateHandler(w http.ResponseWriter, r *http.Request) {
+	admin := x.adminKey(w, r)
+	if admin == nil {
+		return
+	}
+
+	defer r.Body.Close()
+	request := KeyRequest{}
+	decoder := json.NewDecoder(io.LimitReader(r.Body, MAX_CONFIG_SIZE))
+	decoder.DisallowUnknownFields()
+	err := decoder.Decode(&request)
+	if err != nil {
+		sink.SendError(w, err, http.StatusBadRequest)
+		return
+	}
+	if request.Name == "" {
+		sink.SendError(w, ErrKeyName, http.StatusBadRequest)
+		return
+	}
+	if !request.Role.Valid() {
+		sink.SendError(w, ErrKeyRole, http.StatusBadRequest)
+		return
+	}
+
+	apiKey, key, err := base.NewApiKey(request.Name, request.Role)
+	if err != nil {
+		sink.SendError(w, err, http.StatusInternalServerError)
+		return
+	}
+	apiKey.Cameras = request.Cameras
+	x.mutex.Lock()
+	for _, uuid := range request.Cameras {
+		if !x.configured(uuid) {
+			x.mutex.Unlock()
+			sink.SendError(w, fmt.Errorf("%w: %s", ErrCameraNotFound, uuid), http.StatusBadRequest)
+			return
+		}
+	}
+	if x.findKeyName(request.Name) >= 0 {
+		x.mutex.Unlock()
+		sink.SendError(w, ErrKeyExists, http.StatusConflict)
+		return
+	}
+	x.configs.ApiKeys = append(x.configs.ApiKeys, apiKey)
+	x.mutex.Unlock()
+
+	err = x.Save()
+	if err != nil {
+		log.Error().Err(err).Str("component", "server").Msg("save camera.json")
+		sink.SendError(w, ErrSaveConfig, http.StatusInternalServerError)
+		return
+	}
+	log.Info().Str("component", "auth").Str("key", apiKey.Name).Str("role", string(apiKey.Role)).Str("by", admin.Name).Msg("api key created")
+	sink.SendPrettyJSON(r.Context(), w, KeySummary{Name: apiKey.Name, Role: apiKey.Role, Cameras: apiKey.Cameras, Key: key})
+}
+
+// KeyDeleteHandler revokes the key named by the {name} path parameter.
+func (x *Camz) KeyDeleteHandler(w http.ResponseWriter, r *http.Request) {
+	admin := x.adminKey(w, r)
+	if admin == nil {
+		return
+	}
+
+	name := sink.Param(r, "name")
+	x.mutex.Lock()
+	i := x.findKeyName(name)
+	if i < 0 {
+		x.mutex.Unlock()
+		sink.SendError(w, ErrKeyNotFound, http.StatusNotFound)
+		return
+	}
+	// without one nothing could be configured until a restart with no keys at all
+	apiKey := x.configs.ApiKeys[i]
+	if apiKey.Role == base.ROLE_ADMIN && len(apiKey.Cameras) == 0 && x.admins() == 1 {
+		x.mutex.Unlock()
+		sink.SendError(w, ErrLastAdmin, http.StatusConflict)
+		return
+	}
+	keys := append([]*base.ApiKey{}, x.configs.ApiKeys[:i]...)
+	x.configs.ApiKeys = append(keys, x.configs.ApiKeys[i+1:]...)
+	x.mutex.Unlock()
+
+	err := x.Save()
+	if err != nil {
+		log.Error().Err(err).Str("component", "server").Msg("save camera.json")
+		sink.SendError(w, ErrSaveConfig, http.StatusInternalServerError)
+		return
+	}
+	log.Info().Str("component", "auth").Str("key", name).Str("by", admin.Name).Msg("api key deleted")
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// findKeyName returns the index of the key called name, -1 without one.
+func (x *Camz) findKeyName(name string) int {
+	for i, apiKey := range x.configs.ApiKeys {
+		if apiKey.Name == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// configured reports whether camera.json has a camera with uuid, running or not.
+func (x *Camz) configured(uuid string) bool {
+	for _, config := range x.configs.Cameras {
+		if config.Uuid == uuid {
+			return true
+		}
+	}
+	return false
+}
+
+// admins counts the admin keys for every camera.
+func (x *Camz) admins() int {
+	count := 0
+	for _, apiKey := range x.configs.ApiKeys {
+		if apiKey.Role == base.ROLE_ADMIN && len(apiKey.Cameras) == 0 {
+			count++
+		}
+	}
+	return count
+}
+
+// adminKeyPath is where the first admin key of file is written.
+func adminKeyPath(file string) string {
+	return filepath.Join(filepath.Dir(file), ADMIN_KEY_FILE)
+}
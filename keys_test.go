@@ -0,0 +1,53 @@
+// Copyright © 2023 Sloan Childers
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/osintami/camz/base"
+	"github.com/osintami/camz/sink"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestKeys(t *testing.T) {
+	config := testConfig()
+	camz, router, keys := newTestCamz(t, newFakeDriver(config, false), config)
+	admin := keys[base.ROLE_ADMIN]
+	camera := "/v1/cameras/" + config.Uuid
+
+	// only admins for every camera manage keys
+	body := `{"Name": "tablet", "Role": "viewer", "Cameras": ["` + config.Uuid + `"]}`
+	assert.Equal(t, http.StatusForbidden, request(router, "POST", "/v1/keys", keys[base.ROLE_OPERATOR], body).Code)
+	assert.Equal(t, http.StatusBadRequest, request(router, "POST", "/v1/keys", admin, `{"Name": "tablet", "Role": "root"}`).Code)
+	assert.Equal(t, http.StatusBadRequest, request(router, "POST", "/v1/keys", admin, `{"Name": "tablet", "Role": "viewer", "Cameras": ["garage"]}`).Code)
+
+	w := request(router, "POST", "/v1/keys", admin, body)
+	assert.Equal(t, http.StatusOK, w.Code)
+	created := KeySummary{}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &created))
+	assert.Equal(t, base.ROLE_VIEWER, created.Role)
+	assert.NotEmpty(t, created.Key)
+	assert.Equal(t, http.StatusConflict, request(router, "POST", "/v1/keys", admin, body).Code)
+
+	// the new key views but doesn't operate, and is saved as a hash
+	assert.Equal(t, http.StatusOK, request(router, "GET", camera+"/motion", created.Key, "").Code)
+	assert.Equal(t, http.StatusForbidden, request(router, "GET", camera+"/command", created.Key, "").Code)
+	cameras := &base.Cameras{}
+	assert.NoError(t, sink.LoadJson(camz.file, cameras))
+	assert.NotNil(t, cameras.FindApiKey(created.Key))
+
+	w = request(router, "GET", "/v1/keys", admin, "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.NotContains(t, w.Body.String(), created.Key)
+	assert.NotContains(t, w.Body.String(), "Hash")
+	listed := []KeySummary{}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &listed))
+	assert.Len(t, listed, 4)
+
+	assert.Equal(t, http.StatusNoContent, request(router, "DELETE", "/v1/keys/tablet", admin, "").Code)
+	assert.Equal(t, http.StatusUnauthorized, request(router, "GET", camera+"/motion", created.Key, "").Code)
+	assert.Equal(t, http.StatusNotFound, request(router, "DELETE", "/v1/keys/tablet", admin, "").Code)
+	assert.Equal(t, http.StatusConflict, request(router, "DELETE", "/v1/keys/admin", admin, "").Code)
+}
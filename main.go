@@ -2,12 +2,12 @@
 package main
 
 import (
+	"time"
+
 	"github.com/go-chi/chi/v5"
 	"github.com/joho/godotenv"
-	"github.com/osintami/camz/axis"
 	"github.com/osintami/camz/base"
-	"github.com/osintami/camz/blackjack"
-	"github.com/osintami/camz/opencv"
+	"github.com/osintami/camz/recorder"
 	"github.com/osintami/camz/sink"
 	"github.com/rs/zerolog/log"
 )
@@ -28,47 +28,34 @@ func main() {
 
 	log.Info().Msg("It's alive!")
 
-	config := &base.CameraConfig{}
-	err = sink.LoadJson("./camera.json", config)
+	cameras, dirty, err := LoadCameras("./camera.json")
 	if err != nil {
-		log.Fatal().Str("component", "server").Msg("load camera.json")
+		log.Fatal().Err(err).Str("component", "server").Msg("load camera.json")
 		return
 	}
 
-	motion := opencv.NewMotion(config)
 	const ONE_SECOND = 1
 	gps := base.NewGPS(ONE_SECOND)
 
-	var webcam base.IDriver
-
-	switch config.Plugin {
-	case "opencv":
-		webcam = opencv.NewDriver(config)
-	case "blackjack":
-		webcam = blackjack.NewDriver(config)
-	case "axis241q":
-		webcam = axis.NewDriver(config)
+	camz := NewCamz("./camera.json", serverCfg, cameras)
+	if dirty {
+		// assigned uuids must survive a restart so camera URLs stay stable
+		err = camz.Save()
+		if err != nil {
+			log.Error().Err(err).Str("component", "server").Msg("save camera.json")
+		}
 	}
-	err = webcam.Open()
+	err = camz.Start(gps, shutdown)
 	if err != nil {
-		log.Fatal().Err(err).Msg("webcam")
+		log.Fatal().Err(err).Msg("cameras")
 		return
 	}
-	webcam.Stream()
 
-	shutdown.AddListener(webcam.Stop)
+	retention := recorder.NewRetention(serverCfg.RecordDir, serverCfg.RecordMaxAge, serverCfg.RecordQuotaMB*1024*1024, serverCfg.RecordMaxUsage)
+	retention.Start(time.Minute)
+	shutdown.AddListener(retention.Stop)
 
-	handlers := NewCamzServer(webcam, motion, gps, config)
-	router := chi.NewMux()
-	router.Route(serverCfg.PathPrefix, func(r chi.Router) {
-		r.Get("/v1/stream", handlers.StreamHandler)
-		// change/view settings
-		r.Post("/v1/config", handlers.ConfigUpdateHandler)
-		r.Get("/v1/config", handlers.ConfigReadHandler)
-		// list formats and frame sizes supported by device
-		r.Get("/v1/formats", handlers.FormatsHandler)
-		r.Get("/v1/command", handlers.CommandHandler)
-	})
+	router := NewRouter(serverCfg.PathPrefix, camz)
 
 	shutdown.Listen()
 
@@ -77,3 +64,59 @@ func main() {
 		log.Error().Err(err).Str("component", "server").Msg("listen and serve")
 	}
 }
+
+// NewRouter serves the API of every camera under prefix.
+func NewRouter(prefix string, camz *Camz) *chi.Mux {
+	router := chi.NewMux()
+	router.Route(prefix, func(r chi.Router) {
+		r.Get("/v1/cameras", camz.ListHandler)
+		// drivers of this build and their settings
+		r.Get("/v1/plugins", camz.PluginsHandler)
+		// frame rates, drops, timings and viewers of every camera
+		r.Get("/v1/stats", camz.StatsHandler)
+		// named keys and their roles, the key itself is only shown when it is created
+		r.Get("/v1/keys", camz.KeysHandler)
+		r.Post("/v1/keys", camz.KeyCreateHandler)
+		r.Delete("/v1/keys/{name}", camz.KeyDeleteHandler)
+		r.Route("/v1/cameras/{uuid}", func(r chi.Router) {
+			r.Get("/stream", camz.CameraHandler((*CamzServer).StreamHandler))
+			r.Post("/config", camz.CameraHandler((*CamzServer).ConfigUpdateHandler))
+			r.Get("/config", camz.CameraHandler((*CamzServer).ConfigReadHandler))
+			r.Get("/formats", camz.CameraHandler((*CamzServer).FormatsHandler))
+			r.Get("/command", camz.CameraHandler((*CamzServer).CommandHandler))
+			r.Get("/motion", camz.CameraHandler((*CamzServer).MotionHandler))
+			r.Get("/driver", camz.CameraHandler((*CamzServer).DriverHandler))
+			r.Get("/stats", camz.CameraHandler((*CamzServer).StatsHandler))
+			r.Get("/ptz", camz.CameraHandler((*CamzServer).PTZHandler))
+			r.Post("/ptz", camz.CameraHandler((*CamzServer).PTZUpdateHandler))
+			r.Get("/controls", camz.CameraHandler((*CamzServer).ControlsHandler))
+			r.Post("/controls", camz.CameraHandler((*CamzServer).ControlsUpdateHandler))
+			r.Get("/recordings", camz.CameraHandler((*CamzServer).RecordingsHandler))
+			r.Get("/playback", camz.CameraHandler((*CamzServer).PlaybackHandler))
+		})
+
+		// single camera routes, served by the first enabled camera
+		r.Get("/v1/stream", camz.DefaultHandler((*CamzServer).StreamHandler))
+		// change/view settings
+		r.Post("/v1/config", camz.DefaultHandler((*CamzServer).ConfigUpdateHandler))
+		r.Get("/v1/config", camz.DefaultHandler((*CamzServer).ConfigReadHandler))
+		// recording status, free space and segments
+		r.Get("/v1/recordings", camz.DefaultHandler((*CamzServer).RecordingsHandler))
+		// recorded footage as MJPEG, ?from=&to=&speed=
+		r.Get("/v1/playback", camz.DefaultHandler((*CamzServer).PlaybackHandler))
+		// list formats and frame sizes supported by device
+		r.Get("/v1/formats", camz.DefaultHandler((*CamzServer).FormatsHandler))
+		r.Get("/v1/command", camz.DefaultHandler((*CamzServer).CommandHandler))
+		// armed and triggered state of motion detection
+		r.Get("/v1/motion", camz.DefaultHandler((*CamzServer).MotionHandler))
+		// connected, reconnecting or failed, with the reconnect attempts
+		r.Get("/v1/driver", camz.DefaultHandler((*CamzServer).DriverHandler))
+		// presets, and pan, tilt and zoom moves as POSTs, 501 for cameras without
+		r.Get("/v1/ptz", camz.DefaultHandler((*CamzServer).PTZHandler))
+		r.Post("/v1/ptz", camz.DefaultHandler((*CamzServer).PTZUpdateHandler))
+		// exposure, gain, focus and the like, {"key": value} to set them
+		r.Get("/v1/controls", camz.DefaultHandler((*CamzServer).ControlsHandler))
+		r.Post("/v1/controls", camz.DefaultHandler((*CamzServer).ControlsUpdateHandler))
+	})
+	return router
+}
@@ -0,0 +1,295 @@
+// Copyright © 2023 Sloan Childers
+package netcam
+
+import (
+	"crypto/md5"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+var ErrChallenge = errors.New("unsupported authentication challenge")
+
+// Challenge is one scheme offered by a WWW-Authenticate header.
+type Challenge struct {
+	Scheme string
+	Params map[string]string
+}
+
+// ParseChallenges reads the WWW-Authenticate headers of a response, a header can
+// hold several challenges.
+func ParseChallenges(headers []string) []Challenge {
+	challenges := []Challenge{}
+	for _, header := range headers {
+		for _, token := range splitParams(header) {
+			space := strings.IndexAny(token, " \t")
+			equals := strings.IndexByte(token, '=')
+			if equals < 0 || (space >= 0 && space < equals) {
+				// a scheme, maybe followed by its first parameter
+				scheme := token
+				if space >= 0 {
+					scheme = token[:space]
+					token = strings.TrimSpace(token[space:])
+				} else {
+					token = ""
+				}
+				challenges = append(challenges, Challenge{Scheme: scheme, Params: map[string]string{}})
+			}
+			name, value, ok := strings.Cut(token, "=")
+			if ok && len(challenges) > 0 {
+				challenges[len(challenges)-1].Params[strings.ToLower(strings.TrimSpace(name))] = unquote(strings.TrimSpace(value))
+			}
+		}
+	}
+	return challenges
+}
+
+// splitParams splits on the commas outside of quoted strings.
+func splitParams(header string) []string {
+	tokens := []string{}
+	quoted := false
+	start := 0
+	for i := 0; i < len(header); i++ {
+		switch header[i] {
+		case '\\':
+			i++
+		case '"':
+			quoted = !quoted
+		case ',':
+			if !quoted {
+				tokens = append(tokens, strings.TrimSpace(header[start:i]))
+				start = i + 1
+			}
+		}
+	}
+	tokens = append(tokens, strings.TrimSpace(header[start:]))
+	result := []string{}
+	for _, token := range tokens {
+		if token != "" {
+			result = append(result, token)
+		}
+	}
+	return result
+}
+
+func unquote(value string) string {
+	if len(value) < 2 || value[0] != '"' || value[len(value)-1] != '"' {
+		return value
+	}
+	value = value[1 : len(value)-1]
+	out := strings.Builder{}
+	for i := 0; i < len(value); i++ {
+		if value[i] == '\\' && i+1 < len(value) {
+			i++
+		}
+		out.WriteByte(value[i])
+	}
+	return out.String()
+}
+
+// BasicAuthorization is the Authorization header of basic authentication.
+func BasicAuthorization(user, pass string) string {
+	return "Basic " + base64.StdEncoding.EncodeToString([]byte(user+":"+pass))
+}
+
+// Digest answers the digest challenge of one server, counting the nonces it uses.
+type Digest struct {
+	user      string
+	pass      string
+	realm     string
+	nonce     string
+	opaque    string
+	algorithm string
+	hash      func() hash.Hash
+	qop       bool
+	count     uint32
+	cnonce    func() string
+	mutex     sync.Mutex
+}
+
+// digest algorithms, the stronger first
+var digestAlgorithms = []struct {
+	name string
+	hash func() hash.Hash
+}{
+	{"SHA-256", sha256.New},
+	{"MD5", md5.New},
+}
+
+// NewDigest picks the strongest digest challenge out of challenges.
+func NewDigest(challenges []Challenge, user, pass string) (*Digest, error) {
+	for _, algorithm := range digestAlgorithms {
+		for _, challenge := range challenges {
+			if !strings.EqualFold(challenge.Scheme, "Digest") {
+				continue
+			}
+			// MD5 when the challenge doesn't say
+			name := challenge.Params["algorithm"]
+			if name == "" {
+				name = "MD5"
+			}
+			if !strings.EqualFold(name, algorithm.name) {
+				continue
+			}
+			qop := false
+			if value, ok := challenge.Params["qop"]; ok {
+				for _, option := range strings.Split(value, ",") {
+					if strings.TrimSpace(option) == "auth" {
+						qop = true
+					}
+				}
+				if !qop {
+					// auth-int only
+					continue
+				}
+			}
+			return &Digest{
+				user:      user,
+				pass:      pass,
+				realm:     challenge.Params["realm"],
+				nonce:     challenge.Params["nonce"],
+				opaque:    challenge.Params["opaque"],
+				algorithm: challenge.Params["algorithm"],
+				hash:      algorithm.hash,
+				qop:       qop,
+				cnonce:    newNonce}, nil
+		}
+	}
+	return nil, ErrChallenge
+}
+
+// Authorization is the Authorization header for a request of method to uri.
+func (x *Digest) Authorization(method, uri string) string {
+	x.mutex.Lock()
+	x.count++
+	count := fmt.Sprintf("%08x", x.count)
+	x.mutex.Unlock()
+
+	ha1 := x.hex(x.user + ":" + x.realm + ":" + x.pass)
+	ha2 := x.hex(method + ":" + uri)
+	header := fmt.Sprintf(`Digest username="%s", realm="%s", nonce="%s", uri="%s"`, x.user, x.realm, x.nonce, uri)
+	if x.algorithm != "" {
+		header += ", algorithm=" + x.algorithm
+	}
+	if x.qop {
+		cnonce := x.cnonce()
+		response := x.hex(ha1 + ":" + x.nonce + ":" + count + ":" + cnonce + ":auth:" + ha2)
+		header += fmt.Sprintf(`, response="%s", qop=auth, nc=%s, cnonce="%s"`, response, count, cnonce)
+	} else {
+		header += fmt.Sprintf(`, response="%s"`, x.hex(ha1+":"+x.nonce+":"+ha2))
+	}
+	if x.opaque != "" {
+		header += fmt.Sprintf(`, opaque="%s"`, x.opaque)
+	}
+	return header
+}
+
+func (x *Digest) hex(value string) string {
+	h := x.hash()
+	h.Write([]byte(value))
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+func newNonce() string {
+	data := make([]byte, 16)
+	rand.Read(data)
+	return hex.EncodeToString(data)
+}
+
+// Auth signs the HTTP requests to one camera.  Digest is answered once the camera
+// asks for it, the password is only sent in the clear over TLS or when the camera
+// asks for basic authentication.
+type Auth struct {
+	user   string
+	pass   string
+	digest *Digest
+	basic  bool
+	mutex  sync.Mutex
+}
+
+func NewAuth(user, pass string) *Auth {
+	return &Auth{user: user, pass: pass}
+}
+
+// Authorize adds the Authorization header the camera is known to accept.
+func (x *Auth) Authorize(req *http.Request) {
+	if x.user == "" {
+		return
+	}
+	x.mutex.Lock()
+	digest, basic := x.digest, x.basic
+	x.mutex.Unlock()
+	if digest != nil {
+		req.Header.Set("Authorization", digest.Authorization(req.Method, req.URL.RequestURI()))
+	} else if basic || req.URL.Scheme == "https" {
+		req.Header.Set("Authorization", BasicAuthorization(x.user, x.pass))
+	}
+}
+
+// Do sends req and answers one challenge, a new one or a stale nonce.  Requests
+// with a body need GetBody to be sent again.
+func (x *Auth) Do(client *http.Client, req *http.Request) (*http.Response, error) {
+	x.Authorize(req)
+	resp, err := client.Do(req)
+	if err != nil || resp.StatusCode != http.StatusUnauthorized || x.user == "" {
+		return resp, err
+	}
+	if req.Body != nil && req.GetBody == nil {
+		return resp, nil
+	}
+	err = x.challenged(resp)
+	if err != nil {
+		// not a scheme we speak, leave the 401 to the caller
+		return resp, nil
+	}
+	resp.Body.Close()
+
+	retry := req.Clone(req.Context())
+	if req.GetBody != nil {
+		retry.Body, err = req.GetBody()
+		if err != nil {
+			return nil, err
+		}
+	}
+	x.Authorize(retry)
+	return client.Do(retry)
+}
+
+func (x *Auth) challenged(resp *http.Response) error {
+	challenges := ParseChallenges(resp.Header.Values("Www-Authenticate"))
+	x.mutex.Lock()
+	defer x.mutex.Unlock()
+	digest, err := NewDigest(challenges, x.user, x.pass)
+	if err == nil {
+		x.digest = digest
+		return nil
+	}
+	for _, challenge := range challenges {
+		if strings.EqualFold(challenge.Scheme, "Basic") {
+			x.basic = true
+			return nil
+		}
+	}
+	return err
+}
+
+// CheckRedirect signs redirects to the same host, credentials never follow a
+// camera to another one.
+func (x *Auth) CheckRedirect(req *http.Request, via []*http.Request) error {
+	if len(via) >= 10 {
+		return errors.New("stopped after 10 redirects")
+	}
+	if req.URL.Host == via[0].URL.Host {
+		x.Authorize(req)
+	} else {
+		req.Header.Del("Authorization")
+	}
+	return nil
+}
@@ -0,0 +1,84 @@
+// Copyright © 2023 Sloan Childers
+package netcam
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// the examples of RFC 7616 section 3.9.1
+func TestDigest(t *testing.T) {
+	challenges := ParseChallenges([]string{
+		`Digest realm="http-auth@example.org", qop="auth, auth-int", algorithm=MD5, nonce="7ypf/xlj9XXwfDPEoM4URrv/xwf94BcCAzFZH4GiTo0v", opaque="FQhe/qaU925kfnzjCev0ciny7QMkPqMAFRtzCUYo5tdS"`,
+		`Digest realm="http-auth@example.org", qop="auth, auth-int", algorithm=SHA-256, nonce="7ypf/xlj9XXwfDPEoM4URrv/xwf94BcCAzFZH4GiTo0v", opaque="FQhe/qaU925kfnzjCev0ciny7QMkPqMAFRtzCUYo5tdS"`,
+	})
+	assert.Equal(t, 2, len(challenges))
+	cnonce := func() string { return "f2/wE4q74E6zIJEtWaHKaf5wv/H5QzzpXusqGemxURZJ" }
+
+	// SHA-256 is preferred
+	x, err := NewDigest(challenges, "Mufasa", "Circle of Life")
+	assert.NoError(t, err)
+	x.cnonce = cnonce
+	header := x.Authorization("GET", "/dir/index.html")
+	assert.Contains(t, header, `response="753927fa0e85d155564e2e272a28d1802ca10daf4496794697cf8db5856cb6c1"`)
+	assert.Contains(t, header, "algorithm=SHA-256")
+	assert.Contains(t, header, "nc=00000001")
+	assert.Contains(t, header, `opaque="FQhe/qaU925kfnzjCev0ciny7QMkPqMAFRtzCUYo5tdS"`)
+
+	x, err = NewDigest(challenges[:1], "Mufasa", "Circle of Life")
+	assert.NoError(t, err)
+	x.cnonce = cnonce
+	assert.Contains(t, x.Authorization("GET", "/dir/index.html"), `response="8ca523f5e9506fed4657c9700eebdbec"`)
+
+	_, err = NewDigest(ParseChallenges([]string{`Digest realm="x", nonce="y", qop="auth-int"`, `Basic realm="x"`}), "a", "b")
+	assert.Equal(t, ErrChallenge, err)
+}
+
+func TestAuth(t *testing.T) {
+	var authorizations []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		header := r.Header.Get("Authorization")
+		authorizations = append(authorizations, header)
+		if strings.HasPrefix(header, "Digest ") && strings.Contains(header, "algorithm=SHA-256") {
+			w.Write([]byte("ok"))
+			return
+		}
+		w.Header().Add("WWW-Authenticate", `Basic realm="cam"`)
+		w.Header().Add("WWW-Authenticate", `Digest realm="cam", nonce="abc", qop="auth", algorithm=MD5`)
+		w.Header().Add("WWW-Authenticate", `Digest realm="cam", nonce="abc", qop="auth", algorithm=SHA-256`)
+		w.WriteHeader(http.StatusUnauthorized)
+	}))
+	defer server.Close()
+
+	x := NewAuth("admin", "secret")
+	req, _ := http.NewRequest("GET", server.URL+"/video?camera=1", nil)
+	resp, err := x.Do(http.DefaultClient, req)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	resp.Body.Close()
+
+	// nothing in the clear over http, then the digest of the request uri
+	assert.Equal(t, 2, len(authorizations))
+	assert.Equal(t, "", authorizations[0])
+	assert.Contains(t, authorizations[1], `uri="/video?camera=1"`)
+
+	// known from now on
+	req, _ = http.NewRequest("GET", server.URL+"/video", nil)
+	resp, err = x.Do(http.DefaultClient, req)
+	assert.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, 3, len(authorizations))
+	assert.Contains(t, authorizations[2], "nc=00000002")
+
+	// basic only goes out over TLS before being asked for
+	req, _ = http.NewRequest("GET", "https://cam/video", nil)
+	NewAuth("admin", "secret").Authorize(req)
+	assert.Equal(t, BasicAuthorization("admin", "secret"), req.Header.Get("Authorization"))
+	req, _ = http.NewRequest("GET", "http://cam/video", nil)
+	NewAuth("admin", "secret").Authorize(req)
+	assert.Equal(t, "", req.Header.Get("Authorization"))
+}
@@ -0,0 +1,192 @@
+// Copyright © 2023 Sloan Childers
+package netcam
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/osintami/camz/base"
+	"github.com/rs/zerolog/log"
+)
+
+// "plugin": "mjpeg",
+// "addr": "192.168.1.50",
+// "port": 81,
+// "uri": "stream",
+// "user": "",
+// "pass": "",
+
+const (
+	DIAL_TIMEOUT   = 10 * time.Second
+	HEADER_TIMEOUT = 10 * time.Second
+)
+
+var ErrNotMultipart = errors.New("response is not a multipart stream")
+
+// Driver reads an MJPEG stream over HTTP from any camera, e.g. other camz
+// instances or ESP32-CAMs.  The part boundary comes from the response
+// Content-Type and parts without a Content-Length are cut at the JPEG markers.
+type Driver struct {
+	config *base.CameraConfig
+	client *http.Client
+	body   io.ReadCloser
+	frames *base.Publisher
+	// the error that ended the stream and when the latest frame came in
+	err       error
+	lastFrame time.Time
+	// frames are only passed on between Stream and Stop
+	streaming bool
+	mutex     sync.Mutex
+}
+
+func NewDriver(config *base.CameraConfig) *Driver {
+	return &Driver{
+		config: config,
+		client: NewClient(),
+		frames: base.NewPublisher("mjpeg")}
+}
+
+// NewClient returns an HTTP client for long running streams, it only times out
+// connecting and waiting for the response headers.
+func NewClient() *http.Client {
+	return &http.Client{Transport: &http.Transport{
+		Proxy:                 http.ProxyFromEnvironment,
+		DialContext:           (&net.Dialer{Timeout: DIAL_TIMEOUT}).DialContext,
+		ResponseHeaderTimeout: HEADER_TIMEOUT,
+		MaxIdleConnsPerHost:   2}}
+}
+
+// URL builds the stream URL from Addr, Port and Uri, unless Uri is a URL already.
+func URL(config *base.CameraConfig) string {
+	if strings.HasPrefix(config.Uri, "http://") || strings.HasPrefix(config.Uri, "https://") {
+		return config.Uri
+	}
+	host := config.Addr
+	if config.Port != 0 {
+		host = fmt.Sprintf("%s:%d", config.Addr, config.Port)
+	}
+	return fmt.Sprintf("http://%s/%s", host, strings.TrimPrefix(config.Uri, "/"))
+}
+
+func (x *Driver) ListFormatsAndFrameSizes() base.Formats {
+	// a stream has the one size the camera sends
+	return base.Formats{}
+}
+
+func (x *Driver) Grab() base.IFrame {
+	return x.frames.Frame(x.config)
+}
+
+// Subscribe returns a channel of the frames as they arrive.
+func (x *Driver) Subscribe() (<-chan *base.Capture, func()) {
+	return x.frames.Subscribe()
+}
+
+func (x *Driver) Open() error {
+	req, err := http.NewRequest("GET", URL(x.config), nil)
+	if err != nil {
+		log.Error().Err(err).Str("component", "driver").Str("name", x.config.Name).Msg("http.NewRequest")
+		return err
+	}
+	resp, err := NewAuth(x.config.User, x.config.Pass).Do(x.client, req)
+	if err != nil {
+		log.Error().Err(err).Str("component", "driver").Str("name", x.config.Name).Msg("client.Do")
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		err = fmt.Errorf("stream returned %s", resp.Status)
+		log.Error().Err(err).Str("component", "driver").Str("name", x.config.Name).Msg("client.Do")
+		return err
+	}
+	if !strings.HasPrefix(strings.ToLower(resp.Header.Get("Content-Type")), "multipart/") {
+		resp.Body.Close()
+		log.Error().Err(ErrNotMultipart).Str("component", "driver").Str("name", x.config.Name).Str("type", resp.Header.Get("Content-Type")).Msg("client.Do")
+		return ErrNotMultipart
+	}
+
+	x.mutex.Lock()
+	defer x.mutex.Unlock()
+	x.body = resp.Body
+	x.streaming = false
+	x.err = nil
+	x.lastFrame = time.Now()
+	go x.stream(resp.Body, base.MjpegBoundary(resp.Header.Get("Content-Type")))
+	return nil
+}
+
+// Stream starts passing on frames, reading starts in Open so the connection never stalls.
+func (x *Driver) Stream() {
+	x.mutex.Lock()
+	defer x.mutex.Unlock()
+	x.streaming = true
+}
+
+func (x *Driver) Stop() {
+	x.mutex.Lock()
+	defer x.mutex.Unlock()
+	x.streaming = false
+	if x.body != nil {
+		// unblocks the reader
+		x.body.Close()
+		x.body = nil
+	}
+	x.frames.Clear()
+}
+
+// Health is the error that ended the stream, e.g. the camera closing the connection.
+func (x *Driver) Health() error {
+	x.mutex.Lock()
+	defer x.mutex.Unlock()
+	return x.err
+}
+
+func (x *Driver) LastFrame() time.Time {
+	x.mutex.Lock()
+	defer x.mutex.Unlock()
+	return x.lastFrame
+}
+
+func (x *Driver) Reset() error {
+	x.Stop()
+	err := x.Open()
+	if err != nil {
+		json, _ := json.Marshal(x.config)
+		log.Error().Err(err).Str("component", "driver").Str("name", x.config.Name).RawJSON("config", json).Msg("Open")
+		return err
+	}
+	x.Stream()
+	return nil
+}
+
+func (x *Driver) stream(body io.ReadCloser, boundary string) {
+	defer body.Close()
+	reader := base.NewMjpegReader(body, boundary)
+	for {
+		jpeg, err := reader.Next()
+		x.mutex.Lock()
+		if x.body != body {
+			// stopped or reset, this connection is done
+			x.mutex.Unlock()
+			return
+		}
+		if err != nil {
+			x.err = err
+			x.mutex.Unlock()
+			log.Error().Err(err).Str("component", "driver").Str("name", x.config.Name).Msg("read stream")
+			return
+		}
+		x.lastFrame = time.Now()
+		if x.streaming && base.ValidateJPEG(jpeg) {
+			x.frames.Publish(&base.Capture{Image: jpeg, Type: base.JPEG, Time: x.lastFrame})
+		}
+		x.mutex.Unlock()
+	}
+}
@@ -0,0 +1,78 @@
+// Copyright © 2023 Sloan Childers
+package netcam
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/osintami/camz/base"
+	"github.com/stretchr/testify/assert"
+)
+
+// ESP32-CAM style stream, its own boundary and no Content-Length
+func mjpegServer(t *testing.T, frames [][]byte) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, pass, ok := r.BasicAuth()
+		if !ok || user != "admin" || pass != "secret" {
+			w.Header().Set("WWW-Authenticate", `Basic realm="esp32"`)
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.Header().Set("Content-Type", "multipart/x-mixed-replace;boundary=123456789000000000000987654321")
+		for i := 0; ; i++ {
+			w.Write([]byte("--123456789000000000000987654321\r\nContent-Type: image/jpeg\r\nX-Timestamp: 1.0\r\n\r\n"))
+			w.Write(frames[i%len(frames)])
+			w.Write([]byte("\r\n"))
+			w.(http.Flusher).Flush()
+			select {
+			case <-r.Context().Done():
+				return
+			case <-time.After(5 * time.Millisecond):
+			}
+		}
+	}))
+}
+
+func TestDriver(t *testing.T) {
+	frames := [][]byte{base.EmptyFrame(16, 8), base.EmptyFrame(24, 8)}
+	server := mjpegServer(t, frames)
+	defer server.Close()
+
+	config := &base.CameraConfig{Name: "esp32", Uri: server.URL + "/stream", Width: 16, Height: 8, User: "admin", Pass: "secret"}
+	x := NewDriver(config)
+	assert.NoError(t, x.Open())
+	x.Stream()
+	captures, release := x.Subscribe()
+	defer release()
+	seen := map[int]bool{}
+	var seq uint64
+	for len(seen) < len(frames) {
+		select {
+		case capture := <-captures:
+			assert.True(t, capture.Seq > seq)
+			seq = capture.Seq
+			for i, frame := range frames {
+				if string(frame) == string(capture.Image) {
+					seen[i] = true
+				}
+			}
+		case <-time.After(time.Second):
+			t.Fatal("no frame")
+		}
+	}
+	x.Stop()
+
+	config.Pass = "wrong"
+	err := x.Reset()
+	assert.Error(t, err)
+	assert.True(t, strings.Contains(err.Error(), "401"))
+}
+
+func TestURL(t *testing.T) {
+	assert.Equal(t, "http://10.0.0.5:81/stream", URL(&base.CameraConfig{Addr: "10.0.0.5", Port: 81, Uri: "/stream"}))
+	assert.Equal(t, "http://10.0.0.5/", URL(&base.CameraConfig{Addr: "10.0.0.5"}))
+	assert.Equal(t, "https://cam/video", URL(&base.CameraConfig{Addr: "ignored", Uri: "https://cam/video"}))
+}
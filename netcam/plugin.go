@@ -0,0 +1,29 @@
+// Copyright © 2023 Sloan Childers
+package netcam
+
+import "github.com/osintami/camz/base"
+
+func init() {
+	base.Register(base.Plugin{
+		Name:        "mjpeg",
+		Description: "any network camera with an MJPEG stream over HTTP",
+		Config: []base.PluginField{
+			{Name: "Uri", Type: "string", Description: "stream URL, or its path on Addr"},
+			{Name: "Addr", Type: "string", Description: "host name or IP address, unless Uri is a URL"},
+			{Name: "Port", Type: "int", Description: "HTTP port"},
+			{Name: "User", Type: "string", Description: "user for digest or basic authentication"},
+			{Name: "Pass", Type: "string", Description: "password of User"},
+		},
+		New: func(config *base.CameraConfig) base.IDriver { return NewDriver(config) }})
+	base.Register(base.Plugin{
+		Name:        "snapshot",
+		Description: "network camera polled for a still JPEG at Rate",
+		Config: []base.PluginField{
+			{Name: "Uri", Type: "string", Description: "snapshot URL, or its path on Addr"},
+			{Name: "Addr", Type: "string", Description: "host name or IP address, unless Uri is a URL"},
+			{Name: "Port", Type: "int", Description: "HTTP port"},
+			{Name: "User", Type: "string", Description: "user for digest or basic authentication"},
+			{Name: "Pass", Type: "string", Description: "password of User"},
+		},
+		New: func(config *base.CameraConfig) base.IDriver { return NewSnapshot(config) }})
+}
@@ -0,0 +1,257 @@
+// Copyright © 2023 Sloan Childers
+package netcam
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/osintami/camz/base"
+	"github.com/rs/zerolog/log"
+)
+
+// "plugin": "snapshot",
+// "addr": "192.168.1.60",
+// "uri": "snapshot.jpg",
+// "rate": 2,
+// "user": "",
+// "pass": "",
+
+const (
+	// longest wait for one snapshot, a slower one is a dropped frame
+	SNAPSHOT_TIMEOUT = 5 * time.Second
+	MAX_SNAPSHOT     = 16 << 20
+)
+
+var ErrNotJPEG = errors.New("snapshot is not a JPEG")
+
+// Snapshot polls a still JPEG at Rate for cameras without a stream.  The camera
+// is asked for the image only when it changed, with the ETag and Last-Modified of
+// the previous one, and only a new image is published, so an image is decoded
+// once however often it is polled or grabbed.
+type Snapshot struct {
+	config  *base.CameraConfig
+	client  *http.Client
+	auth    *Auth
+	timeout time.Duration
+	frames  *base.Publisher
+	// the latest capture decoded for Grab
+	image base.IFrame
+	// validators of the latest image
+	etag     string
+	modified string
+	// the error that ended polling, when the camera last answered and the polls that timed out
+	err       error
+	lastFrame time.Time
+	dropped   uint64
+	stop      chan struct{}
+	mutex     sync.Mutex
+}
+
+func NewSnapshot(config *base.CameraConfig) *Snapshot {
+	return &Snapshot{
+		config:  config,
+		frames:  base.NewPublisher("snapshot"),
+		timeout: SNAPSHOT_TIMEOUT}
+}
+
+func (x *Snapshot) ListFormatsAndFrameSizes() base.Formats {
+	// a snapshot has the one size the camera sends
+	return base.Formats{}
+}
+
+func (x *Snapshot) Grab() base.IFrame {
+	x.mutex.Lock()
+	defer x.mutex.Unlock()
+	last := x.frames.Last()
+	if last == nil {
+		return base.NewCaptureFrame(x.config, nil)
+	}
+	if x.image == nil || x.image.Seq() != last.Seq {
+		if x.image != nil {
+			x.image.Close()
+		}
+		x.image = base.NewCaptureFrame(x.config, last)
+	}
+	return x.image.Clone()
+}
+
+// Subscribe returns a channel of the images as they change.
+func (x *Snapshot) Subscribe() (<-chan *base.Capture, func()) {
+	return x.frames.Subscribe()
+}
+
+// Open fetches the first snapshot, any error including a timeout fails it.
+func (x *Snapshot) Open() error {
+	auth := NewAuth(x.config.User, x.config.Pass)
+	client := NewClient()
+	client.CheckRedirect = auth.CheckRedirect
+	x.mutex.Lock()
+	x.auth = auth
+	x.client = client
+	x.etag, x.modified = "", ""
+	x.err = nil
+	x.mutex.Unlock()
+
+	err := x.poll(nil)
+	if err != nil {
+		log.Error().Err(err).Str("component", "driver").Str("name", x.config.Name).Msg("snapshot")
+		return err
+	}
+	return nil
+}
+
+func (x *Snapshot) Stream() {
+	x.mutex.Lock()
+	defer x.mutex.Unlock()
+	if x.stop != nil {
+		return
+	}
+	x.stop = make(chan struct{})
+	go x.stream(x.stop)
+}
+
+func (x *Snapshot) Stop() {
+	x.mutex.Lock()
+	defer x.mutex.Unlock()
+	if x.stop != nil {
+		close(x.stop)
+		x.stop = nil
+	}
+	if x.image != nil {
+		x.image.Close()
+		x.image = nil
+	}
+	x.frames.Clear()
+}
+
+func (x *Snapshot) Reset() error {
+	x.Stop()
+	err := x.Open()
+	if err != nil {
+		json, _ := json.Marshal(x.config)
+		log.Error().Err(err).Str("component", "driver").Str("name", x.config.Name).RawJSON("config", json).Msg("Open")
+		return err
+	}
+	x.Stream()
+	return nil
+}
+
+// Health is the error that ended polling, e.g. a 401 after the password changed.
+func (x *Snapshot) Health() error {
+	x.mutex.Lock()
+	defer x.mutex.Unlock()
+	return x.err
+}
+
+// LastFrame is when the camera last answered, with a new image or an unchanged one.
+func (x *Snapshot) LastFrame() time.Time {
+	x.mutex.Lock()
+	defer x.mutex.Unlock()
+	return x.lastFrame
+}
+
+// Dropped counts the polls that timed out or brought no usable image.
+func (x *Snapshot) Dropped() uint64 {
+	x.mutex.Lock()
+	defer x.mutex.Unlock()
+	return x.dropped
+}
+
+func (x *Snapshot) stream(stop chan struct{}) {
+	for {
+		startTime := time.Now().UnixMilli()
+		select {
+		case <-stop:
+			return
+		default:
+		}
+		err := x.poll(stop)
+		if dropped(err) {
+			x.mutex.Lock()
+			x.dropped++
+			x.mutex.Unlock()
+			log.Warn().Err(err).Str("component", "driver").Str("name", x.config.Name).Msg("snapshot dropped")
+		} else if err != nil {
+			x.mutex.Lock()
+			if x.stop == stop {
+				x.err = err
+			}
+			x.mutex.Unlock()
+			log.Error().Err(err).Str("component", "driver").Str("name", x.config.Name).Msg("snapshot")
+			return
+		}
+		base.Sleep(int64(x.config.Rate), time.Now().UnixMilli()-startTime)
+	}
+}
+
+// dropped is true for the errors that only lose one frame.
+func dropped(err error) bool {
+	var netErr net.Error
+	return errors.Is(err, context.DeadlineExceeded) || errors.Is(err, ErrNotJPEG) || (errors.As(err, &netErr) && netErr.Timeout())
+}
+
+// poll fetches the snapshot unless it is unchanged, the results of a poll that
+// outlived the stop channel it was started with are thrown away.
+func (x *Snapshot) poll(stop chan struct{}) error {
+	x.mutex.Lock()
+	client, auth, etag, modified := x.client, x.auth, x.etag, x.modified
+	x.mutex.Unlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), x.timeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, "GET", URL(x.config), nil)
+	if err != nil {
+		return err
+	}
+	if etag != "" {
+		req.Header.Set("If-None-Match", etag)
+	}
+	if modified != "" {
+		req.Header.Set("If-Modified-Since", modified)
+	}
+	resp, err := auth.Do(client, req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	var data []byte
+	switch resp.StatusCode {
+	case http.StatusNotModified:
+	case http.StatusOK:
+		data, err = io.ReadAll(io.LimitReader(resp.Body, MAX_SNAPSHOT))
+		if err != nil {
+			return err
+		}
+		if !base.ValidateJPEG(data) {
+			return ErrNotJPEG
+		}
+	default:
+		return fmt.Errorf("snapshot returned %s", resp.Status)
+	}
+
+	x.mutex.Lock()
+	defer x.mutex.Unlock()
+	if x.stop != stop {
+		return nil
+	}
+	x.lastFrame = time.Now()
+	if data == nil {
+		return nil
+	}
+	x.etag = resp.Header.Get("ETag")
+	x.modified = resp.Header.Get("Last-Modified")
+	// cameras without validators send the same image again
+	if last := x.frames.Last(); last == nil || !bytes.Equal(data, last.Image) {
+		x.frames.Publish(&base.Capture{Image: data, Type: base.JPEG, Time: x.lastFrame})
+	}
+	return nil
+}
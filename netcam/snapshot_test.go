@@ -0,0 +1,111 @@
+// Copyright © 2023 Sloan Childers
+package netcam
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/osintami/camz/base"
+	"github.com/stretchr/testify/assert"
+)
+
+// snapshotServer serves one image with an ETag, slowly when delay is set.
+type snapshotServer struct {
+	image       []byte
+	version     int
+	delay       time.Duration
+	notModified int
+	mutex       sync.Mutex
+}
+
+func (x *snapshotServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	user, pass, ok := r.BasicAuth()
+	if !ok || user != "admin" || pass != "secret" {
+		w.Header().Set("WWW-Authenticate", `Basic realm="snapshot"`)
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	x.mutex.Lock()
+	image, etag, delay := x.image, fmt.Sprintf(`"%d"`, x.version), x.delay
+	if r.Header.Get("If-None-Match") == etag {
+		x.notModified++
+	}
+	x.mutex.Unlock()
+	select {
+	case <-r.Context().Done():
+		return
+	case <-time.After(delay):
+	}
+	if r.Header.Get("If-None-Match") == etag {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	w.Header().Set("ETag", etag)
+	w.Header().Set("Content-Type", "image/jpeg")
+	w.Write(image)
+}
+
+func (x *snapshotServer) set(image []byte, delay time.Duration) {
+	x.mutex.Lock()
+	defer x.mutex.Unlock()
+	if image != nil {
+		x.image = image
+		x.version++
+	}
+	x.delay = delay
+}
+
+func TestSnapshot(t *testing.T) {
+	first, second := base.EmptyFrame(16, 8), base.EmptyFrame(24, 8)
+	camera := &snapshotServer{}
+	camera.set(first, 0)
+	server := httptest.NewServer(camera)
+	defer server.Close()
+
+	config := &base.CameraConfig{Name: "snapshot", Uri: server.URL + "/snapshot.jpg", Width: 16, Height: 8, Rate: 100, User: "admin", Pass: "secret"}
+	x := NewSnapshot(config)
+	x.timeout = 50 * time.Millisecond
+	assert.NoError(t, x.Open())
+	assert.Equal(t, first, x.frames.Last().Image)
+	captures, release := x.Subscribe()
+	defer release()
+	x.Stream()
+
+	// unchanged, not fetched or published again
+	assert.Eventually(t, func() bool {
+		camera.mutex.Lock()
+		defer camera.mutex.Unlock()
+		return camera.notModified > 2
+	}, time.Second, time.Millisecond)
+	assert.Equal(t, 0, len(captures))
+	assert.Equal(t, uint64(1), x.frames.Last().Seq)
+
+	camera.set(second, 0)
+	select {
+	case capture := <-captures:
+		assert.Equal(t, second, capture.Image)
+		assert.Equal(t, uint64(2), capture.Seq)
+	case <-time.After(time.Second):
+		t.Fatal("no new image")
+	}
+
+	// slow polls are dropped frames, polling goes on
+	camera.set(nil, 100*time.Millisecond)
+	assert.Eventually(t, func() bool { return x.Dropped() > 1 }, time.Second, time.Millisecond)
+	assert.NoError(t, x.Health())
+	camera.set(first, 0)
+	assert.Eventually(t, func() bool {
+		return string(x.frames.Last().Image) == string(first)
+	}, time.Second, time.Millisecond)
+
+	x.Stop()
+	config.Pass = "wrong"
+	err := x.Reset()
+	assert.Error(t, err)
+	assert.True(t, strings.Contains(err.Error(), "401"))
+}
@@ -26,7 +26,7 @@ import (
 type Driver struct {
 	config *base.CameraConfig
 	webcam *gocv.VideoCapture
-	frame  gocv.Mat
+	frames *base.Publisher
 	mutex  sync.Mutex
 	stop   bool
 }
@@ -34,11 +34,24 @@ type Driver struct {
 func NewDriver(config *base.CameraConfig) base.IDriver {
 	return &Driver{
 		config: config,
-		frame:  gocv.NewMat(),
+		frames: base.NewPublisher("opencv"),
 	}
 }
 
 func (x *Driver) ListFormatsAndFrameSizes() base.Formats {
+	// the device can't be opened twice, capture pauses while it is asked
+	x.mutex.Lock()
+	running := x.webcam != nil && !x.stop
+	x.mutex.Unlock()
+	if running {
+		x.Stop()
+		defer func() {
+			if x.Open() == nil {
+				x.Stream()
+			}
+		}()
+	}
+
 	formats := base.Formats{}
 	webcam, err := webcam.Open(fmt.Sprintf("/dev/video%d", x.config.Device))
 	if err != nil {
@@ -62,28 +75,28 @@ func (x *Driver) ListFormatsAndFrameSizes() base.Formats {
 }
 
 func (x *Driver) Grab() base.IFrame {
-	x.mutex.Lock()
-	defer x.mutex.Unlock()
-	frame := base.NewFrame(x.config)
-	frame.SetImage(x.frame.Clone(), base.GOCV)
-	return frame
+	return x.frames.Frame(x.config)
+}
+
+// Subscribe returns a channel of the frames as they are captured.
+func (x *Driver) Subscribe() (<-chan *base.Capture, func()) {
+	return x.frames.Subscribe()
 }
 
-func (x *Driver) grab() gocv.Mat {
+// grab reads the next frame as BGR bytes the subscribers can share, nil after
+// three failed reads.
+func (x *Driver) grab() *base.Capture {
 	img := gocv.NewMat()
+	defer img.Close()
 	if !x.webcam.Read(&img) {
 		if !x.webcam.Read(&img) {
 			if !x.webcam.Read(&img) {
 				log.Warn().Str("component", "driver").Str("name", x.config.Name).Msg("empty frame")
-				jpeg := base.EmptyFrame(x.config.Width, x.config.Height)
-				err := gocv.IMDecodeIntoMat(jpeg, gocv.IMReadAnyColor, &img)
-				if err != nil {
-					log.Error().Err(err).Str("component", "driver").Str("name", x.config.Name).Msg("JPEG decode with OpenCV")
-				}
+				return nil
 			}
 		}
 	}
-	return img
+	return &base.Capture{Image: img.ToBytes(), Type: base.BGR24, Width: img.Cols(), Height: img.Rows(), Time: time.Now()}
 }
 
 func (x *Driver) Stream() {
@@ -107,6 +120,7 @@ func (x *Driver) Open() error {
 func (x *Driver) Stop() {
 	x.mutex.Lock()
 	x.stop = true
+	x.frames.Clear()
 	err := x.webcam.Close()
 	if err != nil {
 		log.Error().Err(err).Str("component", "driver").Str("name", x.config.Name).Msg("Close")
@@ -118,7 +132,7 @@ func (x *Driver) Reset() error {
 	x.Stop()
 	err := x.Open()
 	if err != nil {
-		json, err := json.Marshal(x.config)
+		json, _ := json.Marshal(x.config)
 		log.Error().Err(err).Str("component", "driver").Str("name", x.config.Name).RawJSON("config", json).Msg("Open")
 		return err
 	}
@@ -133,8 +147,10 @@ func (x *Driver) stream() {
 			x.mutex.Unlock()
 			return
 		}
-		x.frame.Close()
-		x.frame = x.grab()
+		capture := x.grab()
+		if capture != nil {
+			x.frames.Publish(capture)
+		}
 		// TODO:  investigate skipping frames in lieu of a higher framerate to avoid buffering
 		//x.webcam.Grab(2)
 		x.mutex.Unlock()
@@ -23,6 +23,14 @@ func NewMotion(config *base.CameraConfig) base.IMotion {
 		lastFrame: gocv.NewMat()}
 }
 
+// SetConfig starts over with config, the size or mask of the previous frame may no
+// longer match.
+func (x *Motion) SetConfig(config *base.CameraConfig) {
+	x.config = config
+	x.lastFrame.Close()
+	x.lastFrame = gocv.NewMat()
+}
+
 func (x *Motion) Overlaps(currFrame gocv.Mat, contours []image.Rectangle) int {
 	num := 0
 	for i := 0; i < len(contours); i++ {
@@ -0,0 +1,14 @@
+// Copyright © 2023 Sloan Childers
+package opencv
+
+import "github.com/osintami/camz/base"
+
+func init() {
+	base.Register(base.Plugin{
+		Name:        "opencv",
+		Description: "local camera captured through OpenCV",
+		Config: []base.PluginField{
+			{Name: "Device", Type: "int", Description: "N of /dev/videoN"},
+		},
+		New: NewDriver})
+}
@@ -0,0 +1,265 @@
+// Copyright © 2023 Sloan Childers
+package main
+
+import (
+	"image"
+	"image/color"
+	"sync"
+	"time"
+
+	"github.com/osintami/camz/base"
+	"github.com/rs/zerolog/log"
+	"gocv.io/x/gocv"
+)
+
+var orange = color.RGBA{255, 127, 0, 0}
+
+// how long the pipeline waits for the capture of a pushing driver before it grabs one
+const STATUS_INTERVAL = time.Second
+
+// FrameSink receives every encoded frame of a camera while it wants them.
+type FrameSink interface {
+	Wants() bool
+	Add(*base.EncodedFrame)
+}
+
+// Pipeline is the one capture loop of a camera.  Each frame is grabbed and encoded
+// once, then the JPEG is shared with every subscriber.  Motion detection runs on
+// its own in the detector, the pipeline only reads its results.
+type Pipeline struct {
+	config   *base.CameraConfig
+	webcam   base.IDriver
+	detector *Detector
+	sinks    []FrameSink
+	gps      *base.GPS
+	frames   *base.Broadcast[*base.EncodedFrame]
+	interval time.Duration
+	stop     chan struct{}
+	done     chan struct{}
+	// figures for /v1/stats, missed are captures the pipeline never saw and
+	// lagged the frames viewers were too slow for
+	captured base.Meter
+	encoded  base.Meter
+	missed   uint64
+	lagged   uint64
+	decode   base.Timing
+	encode   base.Timing
+	mutex    sync.Mutex
+}
+
+func NewPipeline(webcam base.IDriver, detector *Detector, gps *base.GPS, config *base.CameraConfig, sinks ...FrameSink) *Pipeline {
+	return &Pipeline{
+		config:   config,
+		webcam:   webcam,
+		detector: detector,
+		sinks:    sinks,
+		gps:      gps,
+		interval: STATUS_INTERVAL,
+		frames:   base.NewBroadcast[*base.EncodedFrame]()}
+}
+
+func (x *Pipeline) Start() {
+	x.mutex.Lock()
+	defer x.mutex.Unlock()
+	if x.stop != nil {
+		return
+	}
+	x.stop = make(chan struct{})
+	x.done = make(chan struct{})
+	go x.run(x.stop, x.done)
+}
+
+// Stop returns once the frame under way is done, nothing is grabbed after it.
+func (x *Pipeline) Stop() {
+	x.mutex.Lock()
+	stop, done := x.stop, x.done
+	x.stop, x.done = nil, nil
+	x.mutex.Unlock()
+	if stop != nil {
+		close(stop)
+		<-done
+	}
+}
+
+// SetDriver replaces the driver frames are grabbed from.
+func (x *Pipeline) SetDriver(webcam base.IDriver) {
+	x.mutex.Lock()
+	defer x.mutex.Unlock()
+	x.webcam = webcam
+}
+
+// SetConfig replaces the configuration of a stopped pipeline.
+func (x *Pipeline) SetConfig(config *base.CameraConfig) {
+	x.mutex.Lock()
+	defer x.mutex.Unlock()
+	x.config = config
+}
+
+func (x *Pipeline) driver() base.IDriver {
+	x.mutex.Lock()
+	defer x.mutex.Unlock()
+	return x.webcam
+}
+
+// Subscribe returns a channel of encoded frames and a function to release it.
+func (x *Pipeline) Subscribe() (<-chan *base.EncodedFrame, func()) {
+	return x.frames.Subscribe()
+}
+
+// subscribe returns the captures of a driver that pushes them, nil for the rest.
+func subscribe(driver base.IDriver) (<-chan *base.Capture, func()) {
+	publisher, ok := base.Unwrap(driver).(base.IPublisher)
+	if !ok {
+		return nil, func() {}
+	}
+	return publisher.Subscribe()
+}
+
+// period is the time between frames at Rate.
+func (x *Pipeline) period() time.Duration {
+	if x.config.Rate <= 0 {
+		return time.Second
+	}
+	return time.Duration(float64(time.Second) / float64(x.config.Rate))
+}
+
+// run waits for the captures of drivers that push them and grabs the frames of
+// the rest at Rate.  Pushing drivers are grabbed as well when they go quiet, for
+// the status frame of a reconnecting driver, but a frame is never processed twice.
+func (x *Pipeline) run(stop, done chan struct{}) {
+	defer close(done)
+	var subscribed base.IDriver
+	var captures <-chan *base.Capture
+	release := func() {}
+	defer func() { release() }()
+	var seq, received uint64
+	started := time.Now()
+	for {
+		driver := x.driver()
+		if driver != subscribed {
+			release()
+			captures, release = subscribe(driver)
+			subscribed = driver
+			received = 0
+		}
+		wait := x.period() - time.Since(started)
+		if captures != nil {
+			wait = x.interval
+		}
+
+		var capture *base.Capture
+		select {
+		case <-stop:
+			return
+		case capture = <-captures:
+		case <-time.After(wait):
+		}
+		started = time.Now()
+		if capture != nil {
+			x.received(capture.Seq, received)
+			received = capture.Seq
+		}
+
+		// nothing to do until someone is watching or motion detection needs the frames
+		sinks := x.wantedSinks()
+		encode := x.frames.Subscribers() > 0 || len(sinks) > 0
+		if !encode && !x.detector.NeedsFrames() {
+			continue
+		}
+		var frame base.IFrame
+		if capture != nil {
+			frame = base.NewCaptureFrame(x.config, capture)
+		} else {
+			frame = driver.Grab()
+		}
+		x.decode.Since(started)
+		if frame.Seq() != 0 && frame.Seq() == seq {
+			frame.Close()
+			continue
+		}
+		seq = frame.Seq()
+		out := x.process(frame, encode)
+		if out != nil {
+			lagged := x.frames.Publish(out)
+			x.mutex.Lock()
+			x.lagged += uint64(lagged)
+			x.mutex.Unlock()
+			for _, sink := range sinks {
+				sink.Add(out)
+			}
+		}
+	}
+}
+
+// received counts a capture and the ones missed since the previous.
+func (x *Pipeline) received(seq, previous uint64) {
+	x.captured.Mark(1)
+	if previous != 0 && seq > previous+1 {
+		x.mutex.Lock()
+		x.missed += seq - previous - 1
+		x.mutex.Unlock()
+	}
+}
+
+// stats fills in the figures of the pipeline.
+func (x *Pipeline) stats(stats *CameraStats) {
+	stats.Captured = x.captured.Total()
+	stats.CaptureFps = x.captured.Rate()
+	stats.Encoded = x.encoded.Total()
+	stats.EncodeFps = x.encoded.Rate()
+	stats.Decode = x.decode.Stats()
+	stats.Encode = x.encode.Stats()
+	x.mutex.Lock()
+	defer x.mutex.Unlock()
+	stats.Dropped.Capture = x.missed
+	stats.Dropped.Stream = x.lagged
+}
+
+func (x *Pipeline) wantedSinks() []FrameSink {
+	sinks := []FrameSink{}
+	for _, sink := range x.sinks {
+		if sink.Wants() {
+			sinks = append(sinks, sink)
+		}
+	}
+	return sinks
+}
+
+// process hands frame to motion detection and encodes it, the frame is closed.
+func (x *Pipeline) process(frame base.IFrame, encode bool) *base.EncodedFrame {
+	defer frame.Close()
+
+	if x.detector.NeedsFrames() {
+		x.detector.Offer(frame)
+	}
+	if !encode {
+		return nil
+	}
+
+	start := time.Now()
+	defer x.encode.Since(start)
+	intruder := x.detector.Triggered()
+	if intruder && x.config.Motion.Decorate {
+		currFrame := frame.OpenCV(false)
+		gocv.Rectangle(&currFrame, image.Rect(0, 0, x.config.Width, x.config.Height), orange, 2)
+	}
+
+	jpeg := frame.ToColorJpeg(nil)
+	if intruder {
+		exifInfo, err := x.gps.ToExif()
+		if err == nil {
+			// TODO:  these values needs to live in camera.json
+			out, err := base.WriteExif(exifInfo, "OSINTAMI", "CarCamz", "0.1", "camz-dev", frame.Time(), jpeg)
+			if err == nil {
+				jpeg = out
+			}
+		}
+	}
+
+	if !base.ValidateJPEG(jpeg) {
+		log.Warn().Str("component", "pipeline").Str("name", x.config.Name).Msg("invalid JPEG, skipping")
+		jpeg = base.EmptyFrame(x.config.Width, x.config.Height)
+	}
+	x.encoded.Mark(1)
+	return &base.EncodedFrame{Jpeg: jpeg, Time: frame.Time(), Seq: frame.Seq(), Source: frame.Source()}
+}
@@ -0,0 +1,221 @@
+// Copyright © 2023 Sloan Childers
+package main
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/osintami/camz/base"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeDriver captures a numbered frame per Grab, each number twice, or publishes
+// its captures when push is set.  Open fails while down.
+type fakeDriver struct {
+	config *base.CameraConfig
+	frames *base.Publisher
+	push   bool
+	down   bool
+	grabs  int
+	subs   int
+	opens  int
+	stops  int
+	mutex  sync.Mutex
+}
+
+func newFakeDriver(config *base.CameraConfig, push bool) *fakeDriver {
+	return &fakeDriver{config: config, frames: base.NewPublisher("fake"), push: push}
+}
+
+func (x *fakeDriver) Open() error {
+	x.mutex.Lock()
+	defer x.mutex.Unlock()
+	x.opens++
+	if x.down {
+		return errors.New("camera refused the configuration")
+	}
+	return nil
+}
+
+func (x *fakeDriver) Stop() {
+	x.mutex.Lock()
+	defer x.mutex.Unlock()
+	x.stops++
+}
+
+func (x *fakeDriver) Stream() {}
+
+func (x *fakeDriver) Reset() error {
+	x.Stop()
+	return x.Open()
+}
+
+func (x *fakeDriver) Grab() base.IFrame {
+	x.mutex.Lock()
+	x.grabs++
+	grabs := x.grabs
+	x.mutex.Unlock()
+	if x.push {
+		return x.frames.Frame(x.config)
+	}
+	image := base.EmptyFrame(x.config.Width, x.config.Height)
+	return base.NewCaptureFrame(x.config, &base.Capture{Image: image, Type: base.JPEG, Time: time.Now(), Seq: uint64(grabs+1) / 2})
+}
+
+func (x *fakeDriver) ListFormatsAndFrameSizes() base.Formats {
+	return base.Formats{}
+}
+
+func (x *fakeDriver) publish() {
+	x.frames.Publish(&base.Capture{Image: base.EmptyFrame(x.config.Width, x.config.Height), Type: base.JPEG})
+}
+
+func (x *fakeDriver) grabbed() int {
+	x.mutex.Lock()
+	defer x.mutex.Unlock()
+	return x.grabs
+}
+
+// pushDriver is a fakeDriver with the optional IPublisher.
+type pushDriver struct {
+	*fakeDriver
+}
+
+func (x pushDriver) Subscribe() (<-chan *base.Capture, func()) {
+	captures, release := x.frames.Subscribe()
+	x.mutex.Lock()
+	defer x.mutex.Unlock()
+	x.subs++
+	return captures, release
+}
+
+func (x *fakeDriver) subscribed() bool {
+	x.mutex.Lock()
+	defer x.mutex.Unlock()
+	return x.subs > 0
+}
+
+type fakeMotion struct{}
+
+func (x fakeMotion) Detect(frame base.IFrame) bool {
+	return false
+}
+
+func (x fakeMotion) SetConfig(config *base.CameraConfig) {}
+
+func testConfig() *base.CameraConfig {
+	return &base.CameraConfig{Name: "test", Uuid: "test-uuid", Plugin: "testsrc", Width: 32, Height: 24, Rate: 50, Motion: &base.MotionConfig{}}
+}
+
+func newTestPipeline(driver base.IDriver, config *base.CameraConfig) *Pipeline {
+	return NewPipeline(driver, NewDetector(fakeMotion{}, config), base.NewGPS(1), config)
+}
+
+func receive(t *testing.T, frames <-chan *base.EncodedFrame) *base.EncodedFrame {
+	select {
+	case frame := <-frames:
+		return frame
+	case <-time.After(time.Second):
+		t.Fatal("no frame")
+		return nil
+	}
+}
+
+func TestPipelinePublisher(t *testing.T) {
+	config := testConfig()
+	driver := newFakeDriver(config, true)
+	x := newTestPipeline(pushDriver{driver}, config)
+	x.interval = 50 * time.Millisecond
+	frames, release := x.Subscribe()
+	defer release()
+	x.Start()
+	defer x.Stop()
+	assert.Eventually(t, driver.subscribed, time.Second, time.Millisecond)
+
+	// every capture once, in order, without grabbing
+	for seq := uint64(1); seq <= 3; seq++ {
+		driver.publish()
+		frame := receive(t, frames)
+		assert.Equal(t, seq, frame.Seq)
+		assert.Equal(t, "fake", frame.Source)
+	}
+	assert.Equal(t, 0, driver.grabbed())
+
+	// a quiet driver is grabbed, but the capture it returns was already sent
+	assert.Eventually(t, func() bool { return driver.grabbed() > 2 }, time.Second, time.Millisecond)
+	assert.Equal(t, 0, len(frames))
+	driver.publish()
+	assert.Equal(t, uint64(4), receive(t, frames).Seq)
+}
+
+func TestPipelineGrab(t *testing.T) {
+	config := testConfig()
+	driver := newFakeDriver(config, false)
+	x := newTestPipeline(driver, config)
+	frames, release := x.Subscribe()
+	defer release()
+	x.Start()
+
+	// each number is grabbed twice but sent once
+	for seq := uint64(1); seq <= 3; seq++ {
+		assert.Equal(t, seq, receive(t, frames).Seq)
+	}
+	x.Stop()
+	grabs := driver.grabbed()
+	time.Sleep(50 * time.Millisecond)
+	assert.Equal(t, grabs, driver.grabbed())
+}
+
+func TestPipelineReceived(t *testing.T) {
+	x := newTestPipeline(newFakeDriver(testConfig(), false), testConfig())
+	x.received(1, 0)
+	x.received(2, 1)
+	x.received(5, 2)
+	stats := &CameraStats{}
+	x.stats(stats)
+	assert.Equal(t, uint64(3), stats.Captured)
+	assert.Equal(t, uint64(2), stats.Dropped.Capture)
+}
+
+func TestPipelineShared(t *testing.T) {
+	config := testConfig()
+	x := newTestPipeline(newFakeDriver(config, false), config)
+	first, releaseFirst := x.Subscribe()
+	defer releaseFirst()
+	second, releaseSecond := x.Subscribe()
+	defer releaseSecond()
+	x.Start()
+	defer x.Stop()
+
+	// both viewers get the one JPEG of a capture
+	frame := receive(t, first)
+	assert.True(t, base.ValidateJPEG(frame.Jpeg))
+	for frame != receive(t, second) {
+		frame = receive(t, first)
+	}
+}
+
+func TestPipelineIdle(t *testing.T) {
+	config := testConfig()
+	driver := newFakeDriver(config, false)
+	x := newTestPipeline(driver, config)
+	x.Start()
+	defer x.Stop()
+
+	// nobody watching and no motion detection, nothing is grabbed
+	time.Sleep(50 * time.Millisecond)
+	assert.Equal(t, 0, driver.grabbed())
+
+	// motion detection grabs without a viewer
+	config = testConfig()
+	config.Motion.Enabled = true
+	driver = newFakeDriver(config, false)
+	x = newTestPipeline(driver, config)
+	x.detector.Start()
+	defer x.detector.Stop()
+	x.Start()
+	defer x.Stop()
+	assert.Eventually(t, func() bool { return driver.grabbed() > 2 }, time.Second, time.Millisecond)
+}
@@ -0,0 +1,297 @@
+// Copyright © 2023 Sloan Childers
+package recorder
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/osintami/camz/base"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	CLIP_TIME_FORMAT = "20060102T150405.000Z"
+	CLIP_QUEUE_SIZE  = 64
+	// dropped frames are logged at most this often, a slow disk drops at frame rate
+	DROP_LOG_INTERVAL = 10 * time.Second
+)
+
+// Clip is the metadata of one motion event recording, saved next to the video.
+type Clip struct {
+	Event  base.MotionEvent
+	Camera string
+	Name   string
+	File   string
+	Start  time.Time
+	End    time.Time
+	Frames int
+	Width  int
+	Height int
+	Rate   float32
+	path   string
+	file   *os.File
+	avi    *base.AviWriter
+	until  time.Time
+}
+
+// ClipRecorder writes a clip for every motion event, starting BeforeSeconds before
+// the event and running until AfterSeconds after it started, or for as long as the
+// event stays active.
+type ClipRecorder struct {
+	config  *base.CameraConfig
+	dir     string
+	ring    *Ring
+	frames  chan *base.EncodedFrame
+	pending *base.MotionEvent
+	ended   *base.MotionEvent
+	clip    *Clip
+	stop    chan struct{}
+	done    chan struct{}
+	// atomic, Add must not wait for the mutex held while writing
+	dropped uint64
+	drops   dropLog
+	mutex   sync.Mutex
+}
+
+// dropLog tells of the frames dropped since it last did.
+type dropLog struct {
+	logged uint64
+	at     time.Time
+}
+
+// report logs the frames dropped since the last report, once DROP_LOG_INTERVAL is up.
+func (x *dropLog) report(component, name string, dropped uint64, now time.Time) {
+	if dropped == x.logged || now.Sub(x.at) < DROP_LOG_INTERVAL {
+		return
+	}
+	log.Warn().Str("component", component).Str("name", name).Uint64("dropped", dropped-x.logged).Msg("queue full, frames dropped")
+	x.logged = dropped
+	x.at = now
+}
+
+func NewClipRecorder(dir string, config *base.CameraConfig) *ClipRecorder {
+	return &ClipRecorder{
+		config: config,
+		dir:    dir,
+		ring:   NewRing(0),
+		frames: make(chan *base.EncodedFrame, CLIP_QUEUE_SIZE)}
+}
+
+func (x *ClipRecorder) Start() {
+	x.mutex.Lock()
+	defer x.mutex.Unlock()
+	if x.stop != nil {
+		return
+	}
+	drain(x.frames)
+	x.stop = make(chan struct{})
+	x.done = make(chan struct{})
+	go x.run(x.stop, x.done)
+}
+
+// Stop waits for the frame being written before it closes the clip, so no frame
+// reopens one afterwards.
+func (x *ClipRecorder) Stop() {
+	x.mutex.Lock()
+	stop, done := x.stop, x.done
+	x.stop, x.done = nil, nil
+	x.mutex.Unlock()
+	if stop != nil {
+		close(stop)
+		<-done
+	}
+
+	x.mutex.Lock()
+	defer x.mutex.Unlock()
+	x.finish()
+	x.pending = nil
+	x.ring.Clear()
+}
+
+// SetConfig replaces the configuration of a stopped recorder.
+func (x *ClipRecorder) SetConfig(config *base.CameraConfig) {
+	x.mutex.Lock()
+	defer x.mutex.Unlock()
+	x.config = config
+}
+
+// Wants reports whether the pipeline should hand encoded frames to the recorder.
+func (x *ClipRecorder) Wants() bool {
+	x.mutex.Lock()
+	defer x.mutex.Unlock()
+	if x.stop == nil {
+		return false
+	}
+	motion := x.config.Motion
+	return x.clip != nil || (motion.Enabled && (motion.BeforeSeconds > 0 || motion.AfterSeconds > 0))
+}
+
+// Add queues an encoded frame, dropping it if the disk can't keep up.
+func (x *ClipRecorder) Add(frame *base.EncodedFrame) {
+	select {
+	case x.frames <- frame:
+	default:
+		// logged by run, which has the lock
+		atomic.AddUint64(&x.dropped, 1)
+	}
+}
+
+// Dropped counts the frames the disk couldn't keep up with.
+func (x *ClipRecorder) Dropped() uint64 {
+	return atomic.LoadUint64(&x.dropped)
+}
+
+// Event is a detector listener, it starts a clip when a motion event starts.
+func (x *ClipRecorder) Event(started, ended *base.MotionEvent) {
+	x.mutex.Lock()
+	defer x.mutex.Unlock()
+	if started != nil {
+		x.pending = started
+	}
+	if ended != nil {
+		x.ended = ended
+	}
+}
+
+func (x *ClipRecorder) run(stop, done chan struct{}) {
+	defer close(done)
+	for {
+		select {
+		case <-stop:
+			return
+		case frame := <-x.frames:
+			x.mutex.Lock()
+			x.add(frame)
+			x.drops.report("clip", x.config.Name, x.Dropped(), time.Now())
+			x.mutex.Unlock()
+		}
+	}
+}
+
+// drain throws away the frames left queued when a recorder stopped, a restart
+// mustn't write them.
+func drain(frames chan *base.EncodedFrame) {
+	for {
+		select {
+		case <-frames:
+		default:
+			return
+		}
+	}
+}
+
+func (x *ClipRecorder) add(frame *base.EncodedFrame) {
+	x.ring.Resize(int(math.Ceil(float64(x.config.Motion.BeforeSeconds) * float64(x.config.Rate))))
+
+	if x.pending != nil {
+		// a new event closes the clip of the previous one
+		x.finish()
+		err := x.open(*x.pending)
+		if err != nil {
+			log.Error().Err(err).Str("component", "clip").Str("name", x.config.Name).Str("event", x.pending.Id).Msg("open clip")
+		}
+		x.pending = nil
+	}
+
+	if x.clip != nil {
+		x.write(frame)
+		if x.ended != nil && x.ended.Id == x.clip.Event.Id {
+			x.clip.Event = *x.ended
+			x.ended = nil
+		}
+		if !frame.Time.Before(x.clip.until) && !x.clip.Event.Active() {
+			x.finish()
+		}
+	}
+	x.ring.Push(frame)
+}
+
+func (x *ClipRecorder) open(event base.MotionEvent) error {
+	dir := filepath.Join(x.dir, x.config.Uuid)
+	err := os.MkdirAll(dir, 0755)
+	if err != nil {
+		return err
+	}
+	path := filepath.Join(dir, fmt.Sprintf("%s_%s.part", event.Start.UTC().Format(CLIP_TIME_FORMAT), event.Id))
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	avi, err := base.NewAviWriter(file, x.config.Width, x.config.Height, x.config.Rate)
+	if err != nil {
+		file.Close()
+		os.Remove(path)
+		return err
+	}
+	x.clip = &Clip{
+		Event:  event,
+		Camera: x.config.Uuid,
+		Name:   x.config.Name,
+		Width:  x.config.Width,
+		Height: x.config.Height,
+		Rate:   x.config.Rate,
+		path:   path,
+		file:   file,
+		avi:    avi,
+		until:  event.Start.Add(time.Duration(x.config.Motion.AfterSeconds) * time.Second)}
+	log.Info().Str("component", "clip").Str("name", x.config.Name).Str("event", event.Id).Str("file", path).Msg("clip started")
+
+	before := event.Start.Add(-time.Duration(x.config.Motion.BeforeSeconds) * time.Second)
+	for _, frame := range x.ring.Since(before) {
+		x.write(frame)
+	}
+	return nil
+}
+
+func (x *ClipRecorder) write(frame *base.EncodedFrame) {
+	err := x.clip.avi.WriteFrame(frame.Jpeg, frame.Time)
+	if err != nil {
+		log.Error().Err(err).Str("component", "clip").Str("name", x.config.Name).Str("event", x.clip.Event.Id).Msg("write clip")
+		return
+	}
+	if x.clip.Frames == 0 {
+		x.clip.Start = frame.Time
+	}
+	x.clip.End = frame.Time
+	x.clip.Frames++
+}
+
+// finish closes the active clip and renames it to carry the time range it covers.
+func (x *ClipRecorder) finish() {
+	clip := x.clip
+	if clip == nil {
+		return
+	}
+	x.clip = nil
+	err := clip.avi.Close()
+	if err != nil {
+		log.Error().Err(err).Str("component", "clip").Str("name", x.config.Name).Str("event", clip.Event.Id).Msg("close clip")
+	}
+	clip.file.Close()
+	if clip.Frames == 0 {
+		os.Remove(clip.path)
+		return
+	}
+
+	name := fmt.Sprintf("%s_%s_%s", clip.Start.UTC().Format(CLIP_TIME_FORMAT), clip.End.UTC().Format(CLIP_TIME_FORMAT), clip.Event.Id)
+	clip.File = filepath.Join(filepath.Dir(clip.path), name+".avi")
+	err = os.Rename(clip.path, clip.File)
+	if err != nil {
+		log.Error().Err(err).Str("component", "clip").Str("name", x.config.Name).Str("event", clip.Event.Id).Msg("rename clip")
+		return
+	}
+	data, err := json.MarshalIndent(clip, "", "   ")
+	if err == nil {
+		err = os.WriteFile(filepath.Join(filepath.Dir(clip.path), name+".json"), data, 0644)
+	}
+	if err != nil {
+		log.Error().Err(err).Str("component", "clip").Str("name", x.config.Name).Str("event", clip.Event.Id).Msg("clip metadata")
+	}
+	log.Info().Str("component", "clip").Str("name", x.config.Name).Str("event", clip.Event.Id).Str("file", clip.File).Int("frames", clip.Frames).Msg("clip saved")
+}
@@ -0,0 +1,145 @@
+// Copyright © 2023 Sloan Childers
+package recorder
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/osintami/camz/base"
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRing(t *testing.T) {
+	ring := NewRing(3)
+	now := time.Now()
+	for i := 0; i < 5; i++ {
+		ring.Push(&base.EncodedFrame{Time: now.Add(time.Duration(i) * time.Second)})
+	}
+	frames := ring.Frames()
+	assert.Len(t, frames, 3)
+	assert.Equal(t, now.Add(2*time.Second), frames[0].Time)
+	assert.Equal(t, now.Add(4*time.Second), frames[2].Time)
+	assert.Len(t, ring.Since(now.Add(3*time.Second)), 2)
+
+	ring.Resize(2)
+	frames = ring.Frames()
+	assert.Len(t, frames, 2)
+	assert.Equal(t, now.Add(3*time.Second), frames[0].Time)
+
+	ring.Resize(-1)
+	assert.Equal(t, 0, ring.Size())
+	ring.Push(&base.EncodedFrame{Time: now})
+	assert.Equal(t, 0, ring.Len())
+}
+
+func TestClipRecorder(t *testing.T) {
+	dir := t.TempDir()
+	config := &base.CameraConfig{
+		Uuid: "camera",
+		Rate: 10,
+		Motion: &base.MotionConfig{
+			Enabled:       true,
+			BeforeSeconds: 1,
+			AfterSeconds:  1}}
+	x := NewClipRecorder(dir, config)
+	jpeg := base.EmptyFrame(32, 24)
+	now := time.Now()
+	frameAt := func(i int) *base.EncodedFrame {
+		return &base.EncodedFrame{Jpeg: jpeg, Time: now.Add(time.Duration(i) * 100 * time.Millisecond)}
+	}
+
+	// 2 seconds of history, only the last second is kept for the clip
+	for i := 0; i < 20; i++ {
+		x.add(frameAt(i))
+	}
+	assert.Equal(t, 10, x.ring.Len())
+
+	event := base.MotionEvent{Id: "event", Start: frameAt(20).Time}
+	x.Event(&event, nil)
+	for i := 20; i < 35; i++ {
+		x.add(frameAt(i))
+	}
+	// the event is still active, so the clip keeps going
+	assert.NotNil(t, x.clip)
+
+	end := frameAt(35).Time
+	event.End = &end
+	x.Event(nil, &event)
+	x.add(frameAt(35))
+	assert.Nil(t, x.clip)
+
+	files, _ := filepath.Glob(filepath.Join(dir, "camera", "*_event.json"))
+	assert.Len(t, files, 1)
+	data, err := os.ReadFile(files[0])
+	assert.NoError(t, err)
+	clip := &Clip{}
+	assert.NoError(t, json.Unmarshal(data, clip))
+	assert.Equal(t, "event", clip.Event.Id)
+	assert.Equal(t, 26, clip.Frames)
+	assert.Equal(t, frameAt(10).Time.UnixMilli(), clip.Start.UnixMilli())
+	assert.Equal(t, end.UnixMilli(), clip.End.UnixMilli())
+
+	file, err := os.Open(clip.File)
+	assert.NoError(t, err)
+	defer file.Close()
+	avi, err := base.NewAviReader(file)
+	assert.NoError(t, err)
+	assert.Equal(t, 26, avi.Len())
+	assert.Equal(t, clip.Start.UnixNano(), avi.Time(0).UnixNano())
+}
+
+func TestClipRecorderStop(t *testing.T) {
+	dir := t.TempDir()
+	config := &base.CameraConfig{Uuid: "camera", Rate: 10, Motion: &base.MotionConfig{Enabled: true, AfterSeconds: 60}}
+	x := NewClipRecorder(dir, config)
+	x.Start()
+	jpeg := base.EmptyFrame(32, 24)
+	now := time.Now()
+	x.Event(&base.MotionEvent{Id: "event", Start: now}, nil)
+	for i := 0; i < 10; i++ {
+		x.Add(&base.EncodedFrame{Jpeg: jpeg, Time: now.Add(time.Duration(i) * 100 * time.Millisecond)})
+	}
+	assert.Eventually(t, func() bool { return len(x.frames) == 0 }, time.Second, time.Millisecond)
+
+	// frames after Stop neither reopen the clip nor wait for the next start
+	x.Stop()
+	x.Add(&base.EncodedFrame{Jpeg: jpeg, Time: now.Add(time.Second)})
+	assert.Nil(t, x.clip)
+	assert.False(t, x.Wants())
+	parts, _ := filepath.Glob(filepath.Join(dir, "camera", "*.part"))
+	assert.Len(t, parts, 0)
+	clips, _ := filepath.Glob(filepath.Join(dir, "camera", "*_event.avi"))
+	assert.Len(t, clips, 1)
+
+	x.Start()
+	defer x.Stop()
+	assert.Eventually(t, func() bool { return len(x.frames) == 0 }, time.Second, time.Millisecond)
+	x.mutex.Lock()
+	defer x.mutex.Unlock()
+	assert.Nil(t, x.clip)
+}
+
+func TestDropLog(t *testing.T) {
+	out := bytes.Buffer{}
+	logger := log.Logger
+	log.Logger = zerolog.New(&out)
+	defer func() { log.Logger = logger }()
+
+	// one line per interval with the drops since the last one
+	x := dropLog{}
+	now := time.Now()
+	for i := uint64(1); i <= 100; i++ {
+		x.report("clip", "door", i, now.Add(time.Duration(i)*time.Second/10))
+	}
+	x.report("clip", "door", 100, now.Add(time.Minute))
+	lines := bytes.Split(bytes.TrimSpace(out.Bytes()), []byte("\n"))
+	assert.Len(t, lines, 2)
+	assert.Contains(t, string(lines[0]), `"dropped":1,`)
+	assert.Contains(t, string(lines[1]), `"dropped":99,`)
+}
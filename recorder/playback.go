@@ -0,0 +1,111 @@
+// Copyright © 2023 Sloan Childers
+package recorder
+
+import (
+	"context"
+	"errors"
+	"os"
+	"time"
+
+	"github.com/osintami/camz/base"
+)
+
+// a longer pause between two recorded frames is a gap in the recording, it is skipped
+const PLAYBACK_MAX_GAP = 2 * time.Second
+
+var ErrBadSpeed = errors.New("speed must be greater than zero")
+
+// Playback sends the recorded frames of from..to to send at their original timing,
+// scaled by speed.  Every MJPEG frame is a keyframe, so playback starts at the first
+// frame at or after from.  Gaps between segments are skipped.
+func Playback(ctx context.Context, segments []Segment, from, to time.Time, speed float64, send func(jpeg []byte, at time.Time) error) (int, error) {
+	if speed <= 0 {
+		return 0, ErrBadSpeed
+	}
+	player := &player{ctx: ctx, speed: speed, send: send}
+	for _, segment := range segments {
+		err := player.play(segment, from, to)
+		if err != nil {
+			return player.frames, err
+		}
+	}
+	return player.frames, nil
+}
+
+type player struct {
+	ctx    context.Context
+	speed  float64
+	send   func(jpeg []byte, at time.Time) error
+	frames int
+	// wall clock and recording time of the frame playback is timed from
+	clock time.Time
+	media time.Time
+	last  time.Time
+}
+
+func (x *player) play(segment Segment, from, to time.Time) error {
+	file, err := os.Open(segment.File)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	avi, err := base.NewAviReader(file)
+	if err != nil {
+		return err
+	}
+
+	start := 0
+	if from.After(segment.Start) {
+		start = avi.Seek(from.Sub(segment.Start))
+	}
+	for i := start; i < avi.Len(); i++ {
+		at := avi.Time(i)
+		if at.IsZero() {
+			// still being written, the capture times are only saved on close
+			at = segment.Start.Add(avi.Offset(i))
+		}
+		if at.Before(from) {
+			continue
+		}
+		if !to.IsZero() && at.After(to) {
+			return nil
+		}
+		jpeg, err := avi.Frame(i)
+		if err != nil {
+			return err
+		}
+		err = x.wait(at)
+		if err != nil {
+			return err
+		}
+		err = x.send(jpeg, at)
+		if err != nil {
+			return err
+		}
+		x.frames++
+	}
+	return nil
+}
+
+// wait sleeps until the frame recorded at is due.
+func (x *player) wait(at time.Time) error {
+	timer := time.NewTimer(time.Until(x.due(at, time.Now())))
+	defer timer.Stop()
+	select {
+	case <-x.ctx.Done():
+		return x.ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// due is the wall clock time the frame recorded at is sent, playback is timed
+// from now again after a gap.
+func (x *player) due(at, now time.Time) time.Time {
+	if x.clock.IsZero() || at.Before(x.last) || at.Sub(x.last) > PLAYBACK_MAX_GAP {
+		x.clock = now
+		x.media = at
+	}
+	x.last = at
+	return x.clock.Add(time.Duration(float64(at.Sub(x.media)) / x.speed))
+}
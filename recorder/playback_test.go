@@ -0,0 +1,80 @@
+// Copyright © 2023 Sloan Childers
+package recorder
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/osintami/camz/base"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPlayback(t *testing.T) {
+	dir := t.TempDir()
+	config := &base.CameraConfig{
+		Uuid:      "camera",
+		Width:     32,
+		Height:    24,
+		Rate:      10,
+		Motion:    &base.MotionConfig{},
+		Recording: &base.RecordingConfig{Enabled: true, SegmentMinutes: 1}}
+	x := NewSegmentRecorder(dir, config)
+	jpeg := base.EmptyFrame(32, 24)
+
+	// 20 seconds across two segments, with an hour long gap before the last 5
+	start := time.Date(2023, 10, 17, 10, 15, 50, 0, time.UTC)
+	for i := 0; i < 200; i++ {
+		at := start.Add(time.Duration(i) * 100 * time.Millisecond)
+		if i >= 150 {
+			at = at.Add(time.Hour)
+		}
+		x.add(&base.EncodedFrame{Jpeg: jpeg, Time: at})
+	}
+	x.close()
+
+	from := start.Add(5 * time.Second)
+	to := start.Add(time.Hour + 17*time.Second)
+	segments, err := Segments(dir, "camera", from, to)
+	assert.NoError(t, err)
+	assert.Len(t, segments, 3)
+
+	times := []time.Time{}
+	frames, err := Playback(context.Background(), segments, from, to, 1000, func(data []byte, at time.Time) error {
+		assert.Equal(t, jpeg, data)
+		times = append(times, at.UTC())
+		return nil
+	})
+	assert.NoError(t, err)
+	// every frame of from..to in order, across the segments and the gap
+	assert.Equal(t, 121, frames)
+	assert.Equal(t, from, times[0])
+	assert.Equal(t, to, times[len(times)-1])
+	for i := 1; i < len(times); i++ {
+		step := times[i].Sub(times[i-1])
+		if i == 100 {
+			assert.Equal(t, time.Hour+100*time.Millisecond, step)
+		} else {
+			assert.Equal(t, 100*time.Millisecond, step, i)
+		}
+	}
+
+	_, err = Playback(context.Background(), segments, from, to, 0, nil)
+	assert.Equal(t, ErrBadSpeed, err)
+}
+
+func TestPlayerDue(t *testing.T) {
+	x := &player{speed: 2}
+	now := time.Now()
+	recorded := time.Date(2023, 10, 17, 10, 15, 50, 0, time.UTC)
+
+	// recording time runs at twice the speed of the wall clock
+	assert.Equal(t, now, x.due(recorded, now))
+	assert.Equal(t, now.Add(500*time.Millisecond), x.due(recorded.Add(time.Second), now))
+	assert.Equal(t, now.Add(time.Second), x.due(recorded.Add(2*time.Second), now.Add(10*time.Millisecond)))
+
+	// a gap restarts the timing from the frame after it
+	later := now.Add(2 * time.Second)
+	assert.Equal(t, later, x.due(recorded.Add(time.Hour), later))
+	assert.Equal(t, later.Add(50*time.Millisecond), x.due(recorded.Add(time.Hour+100*time.Millisecond), later))
+}
@@ -0,0 +1,151 @@
+// Copyright © 2023 Sloan Childers
+package recorder
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// files touched more recently than this are still being written
+const ACTIVE_SEGMENT_AGE = time.Minute
+
+type Volume struct {
+	Path  string
+	Total uint64
+	Free  uint64
+	Used  float64
+}
+
+// Retention deletes the oldest segments under dir once they pass MaxAge, or while
+// the finished recordings take more than Quota bytes or the volume is more than
+// MaxUsage percent full.  A zero limit is not enforced.  Segments still being
+// written are never deleted, so they don't count towards the Quota either.
+type Retention struct {
+	dir      string
+	MaxAge   time.Duration
+	Quota    int64
+	MaxUsage float64
+	stop     chan struct{}
+}
+
+func NewRetention(dir string, maxAge time.Duration, quota int64, maxUsage float64) *Retention {
+	return &Retention{
+		dir:      dir,
+		MaxAge:   maxAge,
+		Quota:    quota,
+		MaxUsage: maxUsage}
+}
+
+func (x *Retention) Start(interval time.Duration) {
+	x.stop = make(chan struct{})
+	go func(stop chan struct{}) {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			x.Enforce(time.Now())
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+			}
+		}
+	}(x.stop)
+}
+
+func (x *Retention) Stop() {
+	if x.stop != nil {
+		close(x.stop)
+		x.stop = nil
+	}
+}
+
+// VolumeStatus reports the size and free space of the volume holding the recordings.
+func VolumeStatus(dir string) (Volume, error) {
+	volume := Volume{Path: dir}
+	stat := syscall.Statfs_t{}
+	err := syscall.Statfs(dir, &stat)
+	if err != nil {
+		return volume, err
+	}
+	volume.Total = uint64(stat.Blocks) * uint64(stat.Bsize)
+	volume.Free = uint64(stat.Bavail) * uint64(stat.Bsize)
+	if volume.Total > 0 {
+		volume.Used = 100 * float64(volume.Total-uint64(stat.Bfree)*uint64(stat.Bsize)) / float64(volume.Total)
+	}
+	return volume, nil
+}
+
+// Enforce applies the retention limits once and returns the number of deleted segments.
+func (x *Retention) Enforce(now time.Time) int {
+	segments, total := x.segments(now)
+	deleted := 0
+	for len(segments) > 0 {
+		oldest := segments[0]
+		expired := x.MaxAge > 0 && now.Sub(oldest.End) > x.MaxAge
+		if !expired && !x.overQuota(total) {
+			break
+		}
+		err := os.Remove(oldest.File)
+		if err != nil {
+			log.Error().Err(err).Str("component", "retention").Str("file", oldest.File).Msg("remove segment")
+			break
+		}
+		log.Debug().Str("component", "retention").Str("file", oldest.File).Bool("expired", expired).Msg("segment removed")
+		x.removeEmptyDirs(filepath.Dir(oldest.File))
+		total -= oldest.Bytes
+		segments = segments[1:]
+		deleted++
+	}
+	return deleted
+}
+
+func (x *Retention) overQuota(total int64) bool {
+	if x.Quota > 0 && total > x.Quota {
+		return true
+	}
+	if x.MaxUsage > 0 {
+		volume, err := VolumeStatus(x.dir)
+		if err == nil && volume.Used > x.MaxUsage {
+			return true
+		}
+	}
+	return false
+}
+
+// segments lists every finished segment of every camera, oldest first, and their total size.
+func (x *Retention) segments(now time.Time) ([]Segment, int64) {
+	segments := []Segment{}
+	var total int64
+	filepath.Walk(x.dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() || !strings.HasSuffix(path, SEGMENT_EXT) {
+			return nil
+		}
+		if now.Sub(info.ModTime()) < ACTIVE_SEGMENT_AGE {
+			return nil
+		}
+		total += info.Size()
+		segments = append(segments, Segment{File: path, End: info.ModTime(), Bytes: info.Size()})
+		return nil
+	})
+	sort.Slice(segments, func(i, j int) bool {
+		return segments[i].End.Before(segments[j].End)
+	})
+	return segments, total
+}
+
+// removeEmptyDirs prunes the directories left empty, stopping at the recording root.
+func (x *Retention) removeEmptyDirs(dir string) {
+	root := filepath.Clean(x.dir)
+	for dir != root && strings.HasPrefix(dir, root) {
+		if os.Remove(dir) != nil {
+			return
+		}
+		dir = filepath.Dir(dir)
+	}
+}
@@ -0,0 +1,45 @@
+// Copyright © 2023 Sloan Childers
+package recorder
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRetention(t *testing.T) {
+	dir := t.TempDir()
+	now := time.Now()
+	for i := 0; i < 4; i++ {
+		day := filepath.Join(dir, "camera", "2023", "10", string(rune('1'+i)))
+		assert.NoError(t, os.MkdirAll(day, 0755))
+		file := filepath.Join(day, "101500.000.avi")
+		assert.NoError(t, os.WriteFile(file, make([]byte, 1000), 0644))
+		modified := now.Add(-time.Duration(4-i) * 24 * time.Hour)
+		assert.NoError(t, os.Chtimes(file, modified, modified))
+	}
+	// still being written
+	active := filepath.Join(dir, "camera", "2023", "10", "5", "101500.000.avi")
+	assert.NoError(t, os.MkdirAll(filepath.Dir(active), 0755))
+	assert.NoError(t, os.WriteFile(active, make([]byte, 1000), 0644))
+
+	retention := NewRetention(dir, 60*time.Hour, 0, 0)
+	assert.Equal(t, 2, retention.Enforce(now))
+	_, err := os.Stat(filepath.Join(dir, "camera", "2023", "10", "1"))
+	assert.True(t, os.IsNotExist(err))
+
+	retention = NewRetention(dir, 0, 1500, 0)
+	assert.Equal(t, 1, retention.Enforce(now))
+	assert.Equal(t, 0, retention.Enforce(now))
+	_, err = os.Stat(active)
+	assert.NoError(t, err)
+
+	// an active segment over the quota on its own leaves the finished ones alone
+	assert.NoError(t, os.WriteFile(active, make([]byte, 5000), 0644))
+	assert.Equal(t, 0, retention.Enforce(now))
+	segments, _ := retention.segments(now)
+	assert.Len(t, segments, 1)
+}
@@ -0,0 +1,91 @@
+// Copyright © 2023 Sloan Childers
+package recorder
+
+import (
+	"time"
+
+	"github.com/osintami/camz/base"
+)
+
+// Ring keeps the most recent encoded frames of a camera in memory.
+type Ring struct {
+	frames []*base.EncodedFrame
+	next   int
+	count  int
+}
+
+func NewRing(size int) *Ring {
+	return &Ring{frames: make([]*base.EncodedFrame, size)}
+}
+
+func (x *Ring) Size() int {
+	return len(x.frames)
+}
+
+func (x *Ring) Len() int {
+	return x.count
+}
+
+// Resize changes the capacity, keeping the newest frames that still fit.  A
+// negative size is 0.
+func (x *Ring) Resize(size int) {
+	if size < 0 {
+		size = 0
+	}
+	if size == len(x.frames) {
+		return
+	}
+	frames := x.Frames()
+	if len(frames) > size {
+		frames = frames[len(frames)-size:]
+	}
+	x.frames = make([]*base.EncodedFrame, size)
+	x.next = 0
+	x.count = 0
+	for _, frame := range frames {
+		x.Push(frame)
+	}
+}
+
+func (x *Ring) Push(frame *base.EncodedFrame) {
+	if len(x.frames) == 0 {
+		return
+	}
+	x.frames[x.next] = frame
+	x.next = (x.next + 1) % len(x.frames)
+	if x.count < len(x.frames) {
+		x.count++
+	}
+}
+
+// Frames returns the buffered frames, oldest first.
+func (x *Ring) Frames() []*base.EncodedFrame {
+	out := make([]*base.EncodedFrame, 0, x.count)
+	if x.count == 0 {
+		return out
+	}
+	start := (x.next - x.count + len(x.frames)) % len(x.frames)
+	for i := 0; i < x.count; i++ {
+		out = append(out, x.frames[(start+i)%len(x.frames)])
+	}
+	return out
+}
+
+// Since returns the buffered frames taken at or after from, oldest first.
+func (x *Ring) Since(from time.Time) []*base.EncodedFrame {
+	out := []*base.EncodedFrame{}
+	for _, frame := range x.Frames() {
+		if !frame.Time.Before(from) {
+			out = append(out, frame)
+		}
+	}
+	return out
+}
+
+func (x *Ring) Clear() {
+	for i := range x.frames {
+		x.frames[i] = nil
+	}
+	x.next = 0
+	x.count = 0
+}
@@ -0,0 +1,291 @@
+// Copyright © 2023 Sloan Childers
+package recorder
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/osintami/camz/base"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	DEFAULT_SEGMENT_MINUTES = 5
+	SEGMENT_QUEUE_SIZE      = 64
+	SEGMENT_EXT             = ".avi"
+	SEGMENT_NAME_FORMAT     = "150405.000"
+	SEGMENT_DIR_FORMAT      = "2006/01/02"
+)
+
+// Segment is one file of continuous recording, named after the time of its first frame.
+type Segment struct {
+	Camera string
+	File   string
+	Start  time.Time
+	End    time.Time
+	Bytes  int64
+}
+
+type Status struct {
+	Enabled   bool
+	Recording bool
+	File      string    `json:",omitempty"`
+	Start     time.Time `json:",omitempty"`
+	Frames    int
+	Dropped   uint64
+}
+
+// SegmentRecorder writes the stream of a camera to time based segments under
+// <dir>/<camera uuid>/<yyyy>/<mm>/<dd>/<hhmmss.mmm>.avi, all times in UTC.
+type SegmentRecorder struct {
+	config  *base.CameraConfig
+	dir     string
+	frames  chan *base.EncodedFrame
+	segment *segment
+	// atomic, Add must not wait for the mutex held while writing
+	dropped uint64
+	drops   dropLog
+	stop    chan struct{}
+	done    chan struct{}
+	mutex   sync.Mutex
+}
+
+type segment struct {
+	path   string
+	start  time.Time
+	until  time.Time
+	width  int
+	height int
+	rate   float32
+	file   *os.File
+	avi    *base.AviWriter
+}
+
+func NewSegmentRecorder(dir string, config *base.CameraConfig) *SegmentRecorder {
+	return &SegmentRecorder{
+		config: config,
+		dir:    dir,
+		frames: make(chan *base.EncodedFrame, SEGMENT_QUEUE_SIZE)}
+}
+
+func (x *SegmentRecorder) enabled() bool {
+	return x.config.Recording != nil && x.config.Recording.Enabled
+}
+
+func (x *SegmentRecorder) length() time.Duration {
+	if x.config.Recording == nil || x.config.Recording.SegmentMinutes <= 0 {
+		return DEFAULT_SEGMENT_MINUTES * time.Minute
+	}
+	return time.Duration(x.config.Recording.SegmentMinutes) * time.Minute
+}
+
+func (x *SegmentRecorder) Start() {
+	x.mutex.Lock()
+	defer x.mutex.Unlock()
+	if x.stop != nil {
+		return
+	}
+	drain(x.frames)
+	x.stop = make(chan struct{})
+	x.done = make(chan struct{})
+	go x.run(x.stop, x.done)
+}
+
+// Stop waits for the frame being written before it closes the segment, so no
+// frame opens a new one afterwards.
+func (x *SegmentRecorder) Stop() {
+	x.mutex.Lock()
+	stop, done := x.stop, x.done
+	x.stop, x.done = nil, nil
+	x.mutex.Unlock()
+	if stop != nil {
+		close(stop)
+		<-done
+	}
+
+	x.mutex.Lock()
+	defer x.mutex.Unlock()
+	x.close()
+}
+
+// SetConfig replaces the configuration of a stopped recorder.
+func (x *SegmentRecorder) SetConfig(config *base.CameraConfig) {
+	x.mutex.Lock()
+	defer x.mutex.Unlock()
+	x.config = config
+}
+
+// Wants reports whether the pipeline should hand encoded frames to the recorder.
+func (x *SegmentRecorder) Wants() bool {
+	x.mutex.Lock()
+	defer x.mutex.Unlock()
+	return x.stop != nil && x.enabled()
+}
+
+// Add queues an encoded frame, dropping it if the disk can't keep up.
+func (x *SegmentRecorder) Add(frame *base.EncodedFrame) {
+	select {
+	case x.frames <- frame:
+	default:
+		// logged by run, which has the lock
+		atomic.AddUint64(&x.dropped, 1)
+	}
+}
+
+func (x *SegmentRecorder) Status() Status {
+	x.mutex.Lock()
+	defer x.mutex.Unlock()
+	status := Status{Enabled: x.enabled(), Dropped: atomic.LoadUint64(&x.dropped)}
+	if x.segment != nil {
+		status.Recording = true
+		status.File = x.segment.path
+		status.Start = x.segment.start
+		status.Frames = x.segment.avi.Frames()
+	}
+	return status
+}
+
+func (x *SegmentRecorder) run(stop, done chan struct{}) {
+	defer close(done)
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			// recording was switched off, or the camera stopped sending frames
+			x.mutex.Lock()
+			if x.segment != nil && (!x.enabled() || time.Now().After(x.segment.until)) {
+				x.close()
+			}
+			x.mutex.Unlock()
+		case frame := <-x.frames:
+			x.mutex.Lock()
+			x.add(frame)
+			x.drops.report("recorder", x.config.Name, atomic.LoadUint64(&x.dropped), time.Now())
+			x.mutex.Unlock()
+		}
+	}
+}
+
+func (x *SegmentRecorder) add(frame *base.EncodedFrame) {
+	if x.segment != nil {
+		current := x.segment
+		if !frame.Time.Before(current.until) || current.width != x.config.Width || current.height != x.config.Height || current.rate != x.config.Rate {
+			x.close()
+		}
+	}
+	if x.segment == nil {
+		err := x.open(frame.Time)
+		if err != nil {
+			log.Error().Err(err).Str("component", "recorder").Str("name", x.config.Name).Msg("open segment")
+			return
+		}
+	}
+	err := x.segment.avi.WriteFrame(frame.Jpeg, frame.Time)
+	if err != nil {
+		log.Error().Err(err).Str("component", "recorder").Str("name", x.config.Name).Str("file", x.segment.path).Msg("write segment")
+		x.close()
+	}
+}
+
+func (x *SegmentRecorder) open(start time.Time) error {
+	start = start.UTC()
+	dir := filepath.Join(x.dir, x.config.Uuid, start.Format(SEGMENT_DIR_FORMAT))
+	err := os.MkdirAll(dir, 0755)
+	if err != nil {
+		return err
+	}
+	path := filepath.Join(dir, start.Format(SEGMENT_NAME_FORMAT)+SEGMENT_EXT)
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	avi, err := base.NewAviWriter(file, x.config.Width, x.config.Height, x.config.Rate)
+	if err != nil {
+		file.Close()
+		return err
+	}
+	// segments end on wall clock boundaries, i.e. every 5 minutes on the 5 minutes
+	length := x.length()
+	x.segment = &segment{
+		path:   path,
+		start:  start,
+		until:  start.Truncate(length).Add(length),
+		width:  x.config.Width,
+		height: x.config.Height,
+		rate:   x.config.Rate,
+		file:   file,
+		avi:    avi}
+	log.Debug().Str("component", "recorder").Str("name", x.config.Name).Str("file", path).Msg("segment started")
+	return nil
+}
+
+func (x *SegmentRecorder) close() {
+	if x.segment == nil {
+		return
+	}
+	err := x.segment.avi.Close()
+	if err != nil {
+		log.Error().Err(err).Str("component", "recorder").Str("name", x.config.Name).Str("file", x.segment.path).Msg("close segment")
+	}
+	x.segment.file.Close()
+	x.segment = nil
+}
+
+// Segments lists the recorded segments of a camera that overlap from..to, oldest first.
+// A zero from or to leaves that end of the range open.
+func Segments(dir, camera string, from, to time.Time) ([]Segment, error) {
+	segments := []Segment{}
+	root := filepath.Join(dir, camera)
+	err := filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		if info.IsDir() || !strings.HasSuffix(path, SEGMENT_EXT) {
+			return nil
+		}
+		start, ok := segmentStart(root, path)
+		if !ok {
+			return nil
+		}
+		segment := Segment{
+			Camera: camera,
+			File:   path,
+			Start:  start,
+			End:    info.ModTime().UTC(),
+			Bytes:  info.Size()}
+		if (!to.IsZero() && segment.Start.After(to)) || (!from.IsZero() && segment.End.Before(from)) {
+			return nil
+		}
+		segments = append(segments, segment)
+		return nil
+	})
+	sort.Slice(segments, func(i, j int) bool {
+		return segments[i].Start.Before(segments[j].Start)
+	})
+	return segments, err
+}
+
+// segmentStart recovers the start time of a segment from its path.
+func segmentStart(root, path string) (time.Time, bool) {
+	rel, err := filepath.Rel(root, path)
+	if err != nil {
+		return time.Time{}, false
+	}
+	name := strings.TrimSuffix(filepath.ToSlash(rel), SEGMENT_EXT)
+	start, err := time.Parse(SEGMENT_DIR_FORMAT+"/"+SEGMENT_NAME_FORMAT, name)
+	if err != nil {
+		return time.Time{}, false
+	}
+	return start, true
+}
@@ -0,0 +1,79 @@
+// Copyright © 2023 Sloan Childers
+package recorder
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/osintami/camz/base"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSegmentRecorder(t *testing.T) {
+	dir := t.TempDir()
+	config := &base.CameraConfig{
+		Uuid:      "camera",
+		Width:     32,
+		Height:    24,
+		Rate:      2,
+		Motion:    &base.MotionConfig{},
+		Recording: &base.RecordingConfig{Enabled: true, SegmentMinutes: 1}}
+	x := NewSegmentRecorder(dir, config)
+	jpeg := base.EmptyFrame(32, 24)
+
+	// two minutes of frames starting halfway through a minute
+	start := time.Date(2023, 10, 17, 10, 15, 30, 0, time.UTC)
+	for i := 0; i < 240; i++ {
+		x.add(&base.EncodedFrame{Jpeg: jpeg, Time: start.Add(time.Duration(i) * 500 * time.Millisecond)})
+	}
+	assert.Equal(t, 60, x.Status().Frames)
+	x.close()
+
+	segments, err := Segments(dir, "camera", time.Time{}, time.Time{})
+	assert.NoError(t, err)
+	assert.Len(t, segments, 3)
+	assert.Equal(t, start, segments[0].Start)
+	assert.Equal(t, filepath.Join(dir, "camera", "2023", "10", "17", "101530.000.avi"), segments[0].File)
+	assert.Equal(t, start.Add(30*time.Second), segments[1].Start)
+
+	file, err := os.Open(segments[1].File)
+	assert.NoError(t, err)
+	defer file.Close()
+	avi, err := base.NewAviReader(file)
+	assert.NoError(t, err)
+	assert.Equal(t, 120, avi.Len())
+	assert.Equal(t, start.Add(30*time.Second), avi.Time(0).UTC())
+
+	// only segments that start before the end of the range
+	segments, err = Segments(dir, "camera", time.Time{}, start.Add(45*time.Second))
+	assert.NoError(t, err)
+	assert.Len(t, segments, 2)
+}
+
+func TestSegmentRecorderStop(t *testing.T) {
+	dir := t.TempDir()
+	config := &base.CameraConfig{Uuid: "camera", Width: 32, Height: 24, Rate: 10, Motion: &base.MotionConfig{}, Recording: &base.RecordingConfig{Enabled: true}}
+	x := NewSegmentRecorder(dir, config)
+	x.Start()
+	jpeg := base.EmptyFrame(32, 24)
+	now := time.Now()
+	for i := 0; i < 10; i++ {
+		x.Add(&base.EncodedFrame{Jpeg: jpeg, Time: now.Add(time.Duration(i) * 100 * time.Millisecond)})
+	}
+	assert.Eventually(t, func() bool { return len(x.frames) == 0 }, time.Second, time.Millisecond)
+
+	// frames after Stop neither open a segment nor wait for the next start
+	x.Stop()
+	x.Add(&base.EncodedFrame{Jpeg: jpeg, Time: now.Add(time.Hour)})
+	assert.False(t, x.Status().Recording)
+	assert.False(t, x.Wants())
+	x.Start()
+	defer x.Stop()
+	assert.Eventually(t, func() bool { return len(x.frames) == 0 }, time.Second, time.Millisecond)
+	assert.False(t, x.Status().Recording)
+	segments, err := Segments(dir, "camera", time.Time{}, time.Time{})
+	assert.NoError(t, err)
+	assert.Len(t, segments, 1)
+}
@@ -0,0 +1,168 @@
+// Copyright © 2023 Sloan Childers
+package replay
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"image/jpeg"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/osintami/camz/base"
+	"github.com/rs/zerolog/log"
+)
+
+// "plugin": "file",
+// "uri": "/var/camz/driveway.mjpeg",
+// "rate": 10,
+// "loop": true,
+
+// Driver replays a recording as if it was a camera, at Rate frames per second.
+// Uri is an MJPEG capture, an AVI file or a directory of JPEGs.  Without Loop the
+// last frame is held once the recording ends.
+type Driver struct {
+	config *base.CameraConfig
+	source source
+	frames *base.Publisher
+	width  int
+	height int
+	done   bool
+	stop   chan struct{}
+	mutex  sync.Mutex
+}
+
+func NewDriver(config *base.CameraConfig) *Driver {
+	return &Driver{
+		config: config,
+		frames: base.NewPublisher("file")}
+}
+
+func (x *Driver) ListFormatsAndFrameSizes() base.Formats {
+	x.mutex.Lock()
+	defer x.mutex.Unlock()
+	if x.width == 0 {
+		return base.Formats{}
+	}
+	return base.Formats{Formats: []base.Format{{
+		Name:  "Motion-JPEG",
+		Sizes: []base.Size{{Size: fmt.Sprintf("%dx%d", x.width, x.height)}}}}}
+}
+
+func (x *Driver) Grab() base.IFrame {
+	return x.frames.Frame(x.config)
+}
+
+// Subscribe returns a channel of the frames as they are played.
+func (x *Driver) Subscribe() (<-chan *base.Capture, func()) {
+	return x.frames.Subscribe()
+}
+
+func (x *Driver) Open() error {
+	source, err := openSource(x.config.Uri)
+	if err != nil {
+		log.Error().Err(err).Str("component", "driver").Str("name", x.config.Name).Str("uri", x.config.Uri).Msg("open recording")
+		return err
+	}
+
+	// the size of the first frame stands for the recording
+	first, err := source.Next()
+	if err == nil {
+		err = source.Rewind()
+	}
+	if err != nil {
+		source.Close()
+		log.Error().Err(err).Str("component", "driver").Str("name", x.config.Name).Str("uri", x.config.Uri).Msg("read recording")
+		return err
+	}
+	size, err := jpeg.DecodeConfig(bytes.NewReader(first))
+	if err == nil && (size.Width != x.config.Width || size.Height != x.config.Height) {
+		log.Warn().Str("component", "driver").Str("name", x.config.Name).Int("width", size.Width).Int("height", size.Height).Msg("recording size differs from config")
+	}
+
+	x.mutex.Lock()
+	defer x.mutex.Unlock()
+	x.source = source
+	x.width = size.Width
+	x.height = size.Height
+	x.done = false
+	return nil
+}
+
+func (x *Driver) Stream() {
+	x.mutex.Lock()
+	defer x.mutex.Unlock()
+	if x.stop != nil || x.source == nil {
+		return
+	}
+	x.stop = make(chan struct{})
+	go x.stream(x.stop, x.source)
+}
+
+func (x *Driver) Stop() {
+	x.mutex.Lock()
+	defer x.mutex.Unlock()
+	if x.stop != nil {
+		close(x.stop)
+		x.stop = nil
+	}
+	if x.source != nil {
+		x.source.Close()
+		x.source = nil
+	}
+	x.frames.Clear()
+}
+
+func (x *Driver) Reset() error {
+	x.Stop()
+	err := x.Open()
+	if err != nil {
+		json, _ := json.Marshal(x.config)
+		log.Error().Err(err).Str("component", "driver").Str("name", x.config.Name).RawJSON("config", json).Msg("Open")
+		return err
+	}
+	x.Stream()
+	return nil
+}
+
+// Done reports whether a one-shot replay has played its last frame.
+func (x *Driver) Done() bool {
+	x.mutex.Lock()
+	defer x.mutex.Unlock()
+	return x.done
+}
+
+func (x *Driver) stream(stop chan struct{}, source source) {
+	for {
+		startTime := time.Now().UnixMilli()
+		// the source is closed by Stop, so only read it while holding the lock
+		x.mutex.Lock()
+		select {
+		case <-stop:
+			x.mutex.Unlock()
+			return
+		default:
+		}
+		data, err := source.Next()
+		if err == io.EOF && x.config.Loop {
+			err = source.Rewind()
+			if err == nil {
+				data, err = source.Next()
+			}
+		}
+		if err != nil {
+			if err == io.EOF {
+				log.Info().Str("component", "driver").Str("name", x.config.Name).Str("uri", x.config.Uri).Msg("replay finished")
+				x.done = true
+			} else {
+				log.Error().Err(err).Str("component", "driver").Str("name", x.config.Name).Str("uri", x.config.Uri).Msg("replay")
+			}
+			x.mutex.Unlock()
+			return
+		}
+		x.frames.Publish(&base.Capture{Image: data, Type: base.JPEG})
+		x.mutex.Unlock()
+		base.Sleep(int64(x.config.Rate), time.Now().UnixMilli()-startTime)
+	}
+}
@@ -0,0 +1,96 @@
+// Copyright © 2023 Sloan Childers
+package replay
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/osintami/camz/base"
+	"github.com/stretchr/testify/assert"
+)
+
+func testFrames() [][]byte {
+	return [][]byte{base.EmptyFrame(16, 8), base.EmptyFrame(24, 8), base.EmptyFrame(32, 8)}
+}
+
+func writeSources(t *testing.T) map[string]string {
+	dir := t.TempDir()
+	frames := testFrames()
+
+	capture := &bytes.Buffer{}
+	for _, frame := range frames {
+		base.WriteMjpeg(capture, frame)
+	}
+	mjpeg := filepath.Join(dir, "capture.mjpeg")
+	assert.NoError(t, os.WriteFile(mjpeg, capture.Bytes(), 0644))
+
+	jpegs := filepath.Join(dir, "jpegs")
+	assert.NoError(t, os.Mkdir(jpegs, 0755))
+	for i, frame := range frames {
+		assert.NoError(t, os.WriteFile(filepath.Join(jpegs, string(rune('a'+i))+".jpg"), frame, 0644))
+	}
+	assert.NoError(t, os.WriteFile(filepath.Join(jpegs, "notes.txt"), []byte("skipped"), 0644))
+
+	avi := filepath.Join(dir, "clip.avi")
+	file, err := os.Create(avi)
+	assert.NoError(t, err)
+	writer, err := base.NewAviWriter(file, 16, 8, 10)
+	assert.NoError(t, err)
+	for _, frame := range frames {
+		assert.NoError(t, writer.WriteFrame(frame, time.Now()))
+	}
+	assert.NoError(t, writer.Close())
+	file.Close()
+
+	return map[string]string{"mjpeg": mjpeg, "dir": jpegs, "avi": avi}
+}
+
+func TestSources(t *testing.T) {
+	frames := testFrames()
+	for kind, path := range writeSources(t) {
+		source, err := openSource(path)
+		assert.NoError(t, err, kind)
+		// twice, the second time after a rewind
+		for pass := 0; pass < 2; pass++ {
+			for _, frame := range frames {
+				data, err := source.Next()
+				assert.NoError(t, err, kind)
+				assert.Equal(t, frame, data, kind)
+			}
+			_, err = source.Next()
+			assert.Equal(t, io.EOF, err, kind)
+			assert.NoError(t, source.Rewind())
+		}
+		assert.NoError(t, source.Close())
+	}
+
+	_, err := openSource(t.TempDir())
+	assert.Equal(t, ErrNoFrames, err)
+}
+
+func TestDriverModes(t *testing.T) {
+	frames := testFrames()
+	path := writeSources(t)["mjpeg"]
+
+	config := &base.CameraConfig{Name: "replay", Uri: path, Width: 16, Height: 8, Rate: 200}
+	x := NewDriver(config)
+	assert.NoError(t, x.Open())
+	assert.Equal(t, "16x8", x.ListFormatsAndFrameSizes().Formats[0].Sizes[0].Size)
+	x.Stream()
+	assert.Eventually(t, x.Done, time.Second, 5*time.Millisecond)
+	// one-shot holds the last frame
+	assert.Equal(t, frames[2], x.frames.Last().Image)
+	assert.Equal(t, uint64(3), x.frames.Last().Seq)
+	x.Stop()
+
+	config.Loop = true
+	assert.NoError(t, x.Open())
+	x.Stream()
+	time.Sleep(100 * time.Millisecond)
+	assert.False(t, x.Done())
+	x.Stop()
+}
@@ -0,0 +1,15 @@
+// Copyright © 2023 Sloan Childers
+package replay
+
+import "github.com/osintami/camz/base"
+
+func init() {
+	base.Register(base.Plugin{
+		Name:        "file",
+		Description: "replay of a recording as if it were a live camera",
+		Config: []base.PluginField{
+			{Name: "Uri", Type: "string", Required: true, Description: "directory of JPEGs, AVI file or MJPEG capture"},
+			{Name: "Loop", Type: "bool", Description: "start over at the end of the recording"},
+		},
+		New: func(config *base.CameraConfig) base.IDriver { return NewDriver(config) }})
+}
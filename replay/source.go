@@ -0,0 +1,158 @@
+// Copyright © 2023 Sloan Childers
+package replay
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/osintami/camz/base"
+)
+
+var ErrNoFrames = errors.New("no frames to replay")
+
+// source is a recording the driver plays back frame by frame.
+type source interface {
+	// Next returns the next JPEG, io.EOF after the last one
+	Next() ([]byte, error)
+	Rewind() error
+	Close() error
+}
+
+// openSource picks the reader for path, a directory of JPEGs, an AVI file or an
+// MJPEG multipart capture.
+func openSource(path string) (source, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	if info.IsDir() {
+		return openDir(path)
+	}
+	if strings.EqualFold(filepath.Ext(path), ".avi") {
+		return openAvi(path)
+	}
+	return openMjpeg(path)
+}
+
+// mjpegSource reads a capture of a multipart stream, e.g. curl saving /v1/stream.
+type mjpegSource struct {
+	file   *os.File
+	reader *base.MjpegReader
+}
+
+func openMjpeg(path string) (*mjpegSource, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	return &mjpegSource{file: file, reader: base.NewMjpegReader(file, "")}, nil
+}
+
+func (x *mjpegSource) Next() ([]byte, error) {
+	jpeg, err := x.reader.Next()
+	if err == io.ErrUnexpectedEOF {
+		// capture cut off in the middle of a frame
+		err = io.EOF
+	}
+	return jpeg, err
+}
+
+func (x *mjpegSource) Rewind() error {
+	_, err := x.file.Seek(0, io.SeekStart)
+	if err != nil {
+		return err
+	}
+	x.reader = base.NewMjpegReader(x.file, "")
+	return nil
+}
+
+func (x *mjpegSource) Close() error {
+	return x.file.Close()
+}
+
+// dirSource plays the JPEGs of a directory in file name order.
+type dirSource struct {
+	files []string
+	next  int
+}
+
+func openDir(path string) (*dirSource, error) {
+	entries, err := os.ReadDir(path)
+	if err != nil {
+		return nil, err
+	}
+	files := []string{}
+	for _, entry := range entries {
+		ext := strings.ToLower(filepath.Ext(entry.Name()))
+		if !entry.IsDir() && (ext == ".jpg" || ext == ".jpeg") {
+			files = append(files, filepath.Join(path, entry.Name()))
+		}
+	}
+	if len(files) == 0 {
+		return nil, ErrNoFrames
+	}
+	sort.Strings(files)
+	return &dirSource{files: files}, nil
+}
+
+func (x *dirSource) Next() ([]byte, error) {
+	if x.next >= len(x.files) {
+		return nil, io.EOF
+	}
+	x.next++
+	return os.ReadFile(x.files[x.next-1])
+}
+
+func (x *dirSource) Rewind() error {
+	x.next = 0
+	return nil
+}
+
+func (x *dirSource) Close() error {
+	return nil
+}
+
+// aviSource plays an MJPEG AVI, such as a motion clip or recording segment.
+type aviSource struct {
+	file *os.File
+	avi  *base.AviReader
+	next int
+}
+
+func openAvi(path string) (*aviSource, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	avi, err := base.NewAviReader(file)
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	if avi.Len() == 0 {
+		file.Close()
+		return nil, ErrNoFrames
+	}
+	return &aviSource{file: file, avi: avi}, nil
+}
+
+func (x *aviSource) Next() ([]byte, error) {
+	if x.next >= x.avi.Len() {
+		return nil, io.EOF
+	}
+	x.next++
+	return x.avi.Frame(x.next - 1)
+}
+
+func (x *aviSource) Rewind() error {
+	x.next = 0
+	return nil
+}
+
+func (x *aviSource) Close() error {
+	return x.file.Close()
+}
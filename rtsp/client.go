@@ -0,0 +1,307 @@
+// Copyright © 2023 Sloan Childers
+package rtsp
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/textproto"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/osintami/camz/netcam"
+)
+
+const (
+	RTSP_PORT    = 554
+	RTSP_TIMEOUT = 10 * time.Second
+	// keepalives are sent at half the session timeout
+	DEFAULT_SESSION_TIMEOUT = 60 * time.Second
+	USER_AGENT              = "camz"
+	MAX_BODY_SIZE           = 1 << 20
+)
+
+var ErrClosed = errors.New("rtsp connection closed")
+
+type Response struct {
+	Status int
+	Reason string
+	Header textproto.MIMEHeader
+	Body   []byte
+}
+
+// client is one RTSP control connection.  A single reader takes responses and,
+// once playing over TCP, the interleaved RTP packets off the connection.
+type client struct {
+	conn      net.Conn
+	reader    *bufio.Reader
+	user      string
+	pass      string
+	cseq      int
+	session   string
+	timeout   time.Duration
+	digest    *netcam.Digest
+	basic     bool
+	responses chan *Response
+	packets   func(channel byte, data []byte)
+	done      chan struct{}
+	err       error
+	// mutex serializes requests, state guards what the reader shares
+	mutex sync.Mutex
+	state sync.Mutex
+}
+
+// dial connects to the server of address, an rtsp:// URL that may carry the credentials.
+func dial(address, user, pass string) (*client, *url.URL, error) {
+	location, err := url.Parse(address)
+	if err != nil {
+		return nil, nil, err
+	}
+	if location.Scheme != "rtsp" {
+		return nil, nil, fmt.Errorf("not an rtsp url: %s", address)
+	}
+	if user == "" && location.User != nil {
+		user = location.User.Username()
+		pass, _ = location.User.Password()
+	}
+	location.User = nil
+	host := location.Host
+	if location.Port() == "" {
+		host = net.JoinHostPort(location.Hostname(), strconv.Itoa(RTSP_PORT))
+	}
+	conn, err := net.DialTimeout("tcp", host, RTSP_TIMEOUT)
+	if err != nil {
+		return nil, nil, err
+	}
+	x := &client{
+		conn:      conn,
+		reader:    bufio.NewReader(conn),
+		user:      user,
+		pass:      pass,
+		timeout:   DEFAULT_SESSION_TIMEOUT,
+		responses: make(chan *Response, 4),
+		done:      make(chan struct{})}
+	go x.read()
+	return x, location, nil
+}
+
+func (x *client) Close() error {
+	return x.conn.Close()
+}
+
+// Done is closed once the connection is gone.
+func (x *client) Done() <-chan struct{} {
+	return x.done
+}
+
+func (x *client) Err() error {
+	x.state.Lock()
+	defer x.state.Unlock()
+	return x.err
+}
+
+// setPackets installs the handler of interleaved packets.
+func (x *client) setPackets(packets func(channel byte, data []byte)) {
+	x.state.Lock()
+	defer x.state.Unlock()
+	x.packets = packets
+}
+
+// Do sends a request and waits for its response, answering one authentication
+// challenge on the way.  Anything but 200 is an error.
+func (x *client) Do(method, uri string, header map[string]string) (*Response, error) {
+	x.mutex.Lock()
+	defer x.mutex.Unlock()
+	for attempt := 0; ; attempt++ {
+		resp, err := x.roundTrip(method, uri, header)
+		if err != nil {
+			return nil, err
+		}
+		if resp.Status == 401 && attempt == 0 && x.user != "" {
+			err = x.authenticate(resp)
+			if err != nil {
+				return nil, err
+			}
+			continue
+		}
+		if resp.Status != 200 {
+			return resp, fmt.Errorf("rtsp %s returned %d %s", method, resp.Status, resp.Reason)
+		}
+		if session := resp.Header.Get("Session"); session != "" {
+			x.setSession(session)
+		}
+		return resp, nil
+	}
+}
+
+// authenticate prefers digest and only sends the password in the clear when asked to.
+func (x *client) authenticate(resp *Response) error {
+	challenges := netcam.ParseChallenges(resp.Header.Values("Www-Authenticate"))
+	digest, err := netcam.NewDigest(challenges, x.user, x.pass)
+	if err == nil {
+		x.digest = digest
+		return nil
+	}
+	for _, challenge := range challenges {
+		if strings.EqualFold(challenge.Scheme, "Basic") {
+			x.basic = true
+			return nil
+		}
+	}
+	return err
+}
+
+func (x *client) setSession(header string) {
+	id, params, _ := strings.Cut(header, ";")
+	x.session = strings.TrimSpace(id)
+	for _, param := range strings.Split(params, ";") {
+		name, value, _ := strings.Cut(strings.TrimSpace(param), "=")
+		if strings.EqualFold(name, "timeout") {
+			seconds, err := strconv.Atoi(value)
+			if err == nil && seconds > 0 {
+				x.timeout = time.Duration(seconds) * time.Second
+			}
+		}
+	}
+}
+
+// Timeout is the session timeout the server asked for.
+func (x *client) Timeout() time.Duration {
+	x.mutex.Lock()
+	defer x.mutex.Unlock()
+	return x.timeout
+}
+
+func (x *client) roundTrip(method, uri string, header map[string]string) (*Response, error) {
+	x.cseq++
+	request := strings.Builder{}
+	fmt.Fprintf(&request, "%s %s RTSP/1.0\r\nCSeq: %d\r\nUser-Agent: %s\r\n", method, uri, x.cseq, USER_AGENT)
+	if x.session != "" {
+		fmt.Fprintf(&request, "Session: %s\r\n", x.session)
+	}
+	if x.digest != nil {
+		fmt.Fprintf(&request, "Authorization: %s\r\n", x.digest.Authorization(method, uri))
+	} else if x.basic {
+		fmt.Fprintf(&request, "Authorization: %s\r\n", netcam.BasicAuthorization(x.user, x.pass))
+	}
+	for name, value := range header {
+		fmt.Fprintf(&request, "%s: %s\r\n", name, value)
+	}
+	request.WriteString("\r\n")
+
+	x.conn.SetWriteDeadline(time.Now().Add(RTSP_TIMEOUT))
+	_, err := x.conn.Write([]byte(request.String()))
+	if err != nil {
+		return nil, err
+	}
+
+	timeout := time.NewTimer(RTSP_TIMEOUT)
+	defer timeout.Stop()
+	for {
+		select {
+		case resp := <-x.responses:
+			if resp.Header.Get("CSeq") != strconv.Itoa(x.cseq) {
+				// the late answer to an earlier request
+				continue
+			}
+			return resp, nil
+		case <-x.done:
+			return nil, ErrClosed
+		case <-timeout.C:
+			return nil, fmt.Errorf("rtsp %s timed out", method)
+		}
+	}
+}
+
+func (x *client) read() {
+	defer close(x.done)
+	text := textproto.NewReader(x.reader)
+	for {
+		err := x.readMessage(text)
+		if err != nil {
+			x.state.Lock()
+			x.err = err
+			x.state.Unlock()
+			return
+		}
+	}
+}
+
+func (x *client) readMessage(text *textproto.Reader) error {
+	first, err := x.reader.Peek(1)
+	if err != nil {
+		return err
+	}
+	if first[0] == '$' {
+		// interleaved packet, $ channel length payload
+		header := make([]byte, 4)
+		_, err = io.ReadFull(x.reader, header)
+		if err != nil {
+			return err
+		}
+		data := make([]byte, binary.BigEndian.Uint16(header[2:]))
+		_, err = io.ReadFull(x.reader, data)
+		if err != nil {
+			return err
+		}
+		x.state.Lock()
+		packets := x.packets
+		x.state.Unlock()
+		if packets != nil {
+			packets(header[1], data)
+		}
+		return nil
+	}
+
+	line, err := text.ReadLine()
+	if err != nil {
+		return err
+	}
+	if line == "" {
+		return nil
+	}
+	header, err := text.ReadMIMEHeader()
+	if err != nil {
+		return err
+	}
+	var body []byte
+	if value := header.Get("Content-Length"); value != "" {
+		length, err := strconv.Atoi(value)
+		if err != nil || length < 0 || length > MAX_BODY_SIZE {
+			return fmt.Errorf("bad rtsp Content-Length %q", value)
+		}
+		body = make([]byte, length)
+		_, err = io.ReadFull(x.reader, body)
+		if err != nil {
+			return err
+		}
+	}
+	if !strings.HasPrefix(line, "RTSP/") {
+		// a request from the server, e.g. ANNOUNCE, nothing we act on
+		return nil
+	}
+	parts := strings.SplitN(line, " ", 3)
+	if len(parts) < 2 {
+		return fmt.Errorf("bad rtsp status line %q", line)
+	}
+	status, err := strconv.Atoi(parts[1])
+	if err != nil {
+		return fmt.Errorf("bad rtsp status line %q", line)
+	}
+	resp := &Response{Status: status, Header: header, Body: body}
+	if len(parts) == 3 {
+		resp.Reason = parts[2]
+	}
+	select {
+	case x.responses <- resp:
+	default:
+		// nobody is waiting for it
+	}
+	return nil
+}
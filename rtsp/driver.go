@@ -0,0 +1,427 @@
+// Copyright © 2023 Sloan Childers
+package rtsp
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/rand"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/osintami/camz/base"
+	"github.com/rs/zerolog/log"
+)
+
+// "plugin": "rtsp",
+// "addr": "192.168.1.64",
+// "port": 554,
+// "uri": "live/mjpeg",
+// "user": "admin",
+// "pass": "",
+// "transport": "tcp",
+
+const (
+	TRANSPORT_TCP = "tcp"
+	TRANSPORT_UDP = "udp"
+	UDP_BUFFER    = 65536
+	// how long Stop waits on the TEARDOWN of a camera that may be gone
+	TEARDOWN_TIMEOUT = 500 * time.Millisecond
+)
+
+// Driver plays the MJPEG track of an RTSP camera, over TCP interleaved by default
+// or over UDP with "transport": "udp".
+type Driver struct {
+	config *base.CameraConfig
+	client *client
+	udp    []*net.UDPConn
+	track  *track
+	jpeg   *Depacketizer
+	frames *base.Publisher
+	stop   chan struct{}
+	// the aggregate control URL PLAY and TEARDOWN go to
+	address string
+	// what the receiver reports over UDP tell the camera, from our own ssrc
+	reception reception
+	ssrc      uint32
+	lastFrame time.Time
+	// frames are only passed on between Stream and Stop
+	streaming bool
+	mutex     sync.Mutex
+}
+
+func NewDriver(config *base.CameraConfig) *Driver {
+	return &Driver{
+		config: config,
+		frames: base.NewPublisher("rtsp")}
+}
+
+// URL builds the rtsp:// URL from Addr, Port and Uri, unless Uri is one already.
+func URL(config *base.CameraConfig) string {
+	if strings.HasPrefix(config.Uri, "rtsp://") {
+		return config.Uri
+	}
+	port := config.Port
+	if port == 0 {
+		port = RTSP_PORT
+	}
+	return fmt.Sprintf("rtsp://%s:%d/%s", config.Addr, port, strings.TrimPrefix(config.Uri, "/"))
+}
+
+func (x *Driver) ListFormatsAndFrameSizes() base.Formats {
+	// a stream has the one size the camera sends
+	return base.Formats{}
+}
+
+func (x *Driver) Grab() base.IFrame {
+	return x.frames.Frame(x.config)
+}
+
+// Subscribe returns a channel of the frames as they are reassembled.
+func (x *Driver) Subscribe() (<-chan *base.Capture, func()) {
+	return x.frames.Subscribe()
+}
+
+func (x *Driver) Open() error {
+	err := x.open()
+	if err != nil {
+		log.Error().Err(err).Str("component", "driver").Str("name", x.config.Name).Str("url", URL(x.config)).Msg("rtsp")
+		x.close()
+	}
+	return err
+}
+
+func (x *Driver) open() error {
+	// the session of an earlier Open that failed half way, or was never stopped
+	x.close()
+	client, location, err := dial(URL(x.config), x.config.User, x.config.Pass)
+	if err != nil {
+		return err
+	}
+	x.mutex.Lock()
+	x.client = client
+	x.jpeg = NewDepacketizer()
+	x.stop = make(chan struct{})
+	x.lastFrame = time.Now()
+	x.reception = reception{}
+	x.ssrc = rand.Uint32()
+	x.mutex.Unlock()
+
+	address := location.String()
+	options, err := client.Do("OPTIONS", address, nil)
+	if err != nil {
+		return err
+	}
+	describe, err := client.Do("DESCRIBE", address, map[string]string{"Accept": "application/sdp"})
+	if err != nil {
+		return err
+	}
+	track, err := parseSDP(describe.Body)
+	if err != nil {
+		return err
+	}
+	base := address
+	if value := describe.Header.Get("Content-Base"); value != "" {
+		base = value
+	} else if value := describe.Header.Get("Content-Location"); value != "" {
+		base = value
+	}
+	x.mutex.Lock()
+	x.track = track
+	x.address = base
+	x.mutex.Unlock()
+
+	var rtp, rtcp *net.UDPConn
+	transport := "RTP/AVP/TCP;unicast;interleaved=0-1"
+	if strings.EqualFold(x.config.Transport, TRANSPORT_UDP) {
+		rtp, rtcp, err = listenPair()
+		if err != nil {
+			return err
+		}
+		x.mutex.Lock()
+		x.udp = []*net.UDPConn{rtp, rtcp}
+		x.mutex.Unlock()
+		port := rtp.LocalAddr().(*net.UDPAddr).Port
+		transport = fmt.Sprintf("RTP/AVP;unicast;client_port=%d-%d", port, port+1)
+	}
+	setup, err := client.Do("SETUP", controlURL(base, track.control), map[string]string{"Transport": transport})
+	if err != nil {
+		return err
+	}
+
+	if rtp != nil {
+		go x.readUDP(rtp)
+		// reports go to the camera's RTCP port, or where its sender reports come from
+		var camera *net.UDPAddr
+		if port, ok := serverPort(setup.Header.Get("Transport")); ok {
+			camera = &net.UDPAddr{IP: client.conn.RemoteAddr().(*net.TCPAddr).IP, Port: port}
+		}
+		go x.readRTCP(rtcp, camera, x.stop)
+	} else {
+		client.setPackets(func(channel byte, data []byte) {
+			if channel == 0 {
+				x.packet(data)
+			}
+		})
+	}
+	_, err = client.Do("PLAY", base, map[string]string{"Range": "npt=0.000-"})
+	if err != nil {
+		return err
+	}
+
+	keepalive := "OPTIONS"
+	if strings.Contains(options.Header.Get("Public"), "GET_PARAMETER") {
+		keepalive = "GET_PARAMETER"
+	}
+	go x.keepalive(client, base, keepalive, x.stop)
+	return nil
+}
+
+// serverPort is the RTCP port of server_port=rtp-rtcp in a Transport header.
+func serverPort(transport string) (int, bool) {
+	for _, param := range strings.Split(transport, ";") {
+		param = strings.TrimSpace(param)
+		if !strings.HasPrefix(param, "server_port=") {
+			continue
+		}
+		rtp, rtcp, pair := strings.Cut(strings.TrimPrefix(param, "server_port="), "-")
+		if !pair {
+			rtcp = strconv.Itoa(atoi(rtp) + 1)
+		}
+		port := atoi(rtcp)
+		return port, port > 0
+	}
+	return 0, false
+}
+
+func atoi(value string) int {
+	number, _ := strconv.Atoi(value)
+	return number
+}
+
+// listenPair opens the RTP and RTCP ports, an even port and the one after it.
+func listenPair() (*net.UDPConn, *net.UDPConn, error) {
+	var err error
+	for i := 0; i < 16; i++ {
+		var rtp, rtcp *net.UDPConn
+		rtp, err = net.ListenUDP("udp", &net.UDPAddr{})
+		if err != nil {
+			continue
+		}
+		port := rtp.LocalAddr().(*net.UDPAddr).Port
+		if port%2 != 0 {
+			rtp.Close()
+			continue
+		}
+		rtcp, err = net.ListenUDP("udp", &net.UDPAddr{Port: port + 1})
+		if err != nil {
+			rtp.Close()
+			continue
+		}
+		return rtp, rtcp, nil
+	}
+	if err == nil {
+		err = errors.New("no free RTP port pair")
+	}
+	return nil, nil, err
+}
+
+// Stream starts passing on frames, packets are read from Open on so the session never stalls.
+func (x *Driver) Stream() {
+	x.mutex.Lock()
+	defer x.mutex.Unlock()
+	x.streaming = true
+}
+
+func (x *Driver) Stop() {
+	x.mutex.Lock()
+	client, address := x.client, x.address
+	x.mutex.Unlock()
+	if client != nil && address != "" {
+		// best effort, the camera drops the session on its own after the timeout
+		done := make(chan struct{})
+		go func() {
+			client.Do("TEARDOWN", address, nil)
+			close(done)
+		}()
+		select {
+		case <-done:
+		case <-time.After(TEARDOWN_TIMEOUT):
+		}
+	}
+	x.close()
+}
+
+func (x *Driver) close() {
+	x.mutex.Lock()
+	defer x.mutex.Unlock()
+	x.streaming = false
+	if x.stop != nil {
+		close(x.stop)
+		x.stop = nil
+	}
+	if x.client != nil {
+		x.client.Close()
+		x.client = nil
+	}
+	for _, conn := range x.udp {
+		conn.Close()
+	}
+	x.udp = nil
+	x.track = nil
+	x.address = ""
+	x.frames.Clear()
+}
+
+// Health is the error that closed the control connection.
+func (x *Driver) Health() error {
+	x.mutex.Lock()
+	client := x.client
+	x.mutex.Unlock()
+	if client == nil {
+		return nil
+	}
+	select {
+	case <-client.Done():
+		err := client.Err()
+		if err == nil {
+			err = ErrClosed
+		}
+		return err
+	default:
+		return nil
+	}
+}
+
+// LastFrame is when the latest complete frame came in, a camera that stops
+// sending over UDP is only noticed this way.
+func (x *Driver) LastFrame() time.Time {
+	x.mutex.Lock()
+	defer x.mutex.Unlock()
+	return x.lastFrame
+}
+
+func (x *Driver) Reset() error {
+	x.Stop()
+	err := x.Open()
+	if err != nil {
+		json, _ := json.Marshal(x.config)
+		log.Error().Err(err).Str("component", "driver").Str("name", x.config.Name).RawJSON("config", json).Msg("Open")
+		return err
+	}
+	x.Stream()
+	return nil
+}
+
+func (x *Driver) keepalive(client *client, address, method string, stop chan struct{}) {
+	interval := client.Timeout() / 2
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-client.Done():
+			log.Error().Err(client.Err()).Str("component", "driver").Str("name", x.config.Name).Msg("rtsp connection lost")
+			return
+		case <-ticker.C:
+			_, err := client.Do(method, address, nil)
+			if err != nil {
+				log.Warn().Err(err).Str("component", "driver").Str("name", x.config.Name).Msg("rtsp keepalive")
+			}
+		}
+	}
+}
+
+func (x *Driver) readUDP(conn *net.UDPConn) {
+	buffer := make([]byte, UDP_BUFFER)
+	for {
+		n, _, err := conn.ReadFromUDP(buffer)
+		if err != nil {
+			// closed by Stop
+			return
+		}
+		x.packet(base.Copy(buffer[:n]))
+	}
+}
+
+// readRTCP reads the sender reports and sends a receiver report at once and then
+// every RTCP_INTERVAL.  Without the camera's address the first report waits for
+// a packet from it.
+func (x *Driver) readRTCP(conn *net.UDPConn, camera *net.UDPAddr, stop chan struct{}) {
+	addresses := make(chan *net.UDPAddr, 1)
+	go func() {
+		buffer := make([]byte, UDP_BUFFER)
+		for {
+			n, from, err := conn.ReadFromUDP(buffer)
+			if err != nil {
+				// closed by Stop
+				return
+			}
+			select {
+			case addresses <- from:
+			default:
+			}
+			x.senderReport(buffer[:n])
+		}
+	}()
+
+	if camera == nil {
+		select {
+		case <-stop:
+			return
+		case camera = <-addresses:
+		}
+	}
+	ticker := time.NewTicker(RTCP_INTERVAL)
+	defer ticker.Stop()
+	for {
+		x.mutex.Lock()
+		report := x.reception.report(x.ssrc, time.Now())
+		x.mutex.Unlock()
+		_, err := conn.WriteToUDP(report, camera)
+		if err != nil {
+			log.Warn().Err(err).Str("component", "driver").Str("name", x.config.Name).Msg("rtcp receiver report")
+		}
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (x *Driver) senderReport(data []byte) {
+	x.mutex.Lock()
+	defer x.mutex.Unlock()
+	x.reception.senderReport(data, time.Now())
+}
+
+// packet feeds one RTP packet to the depacketizer.
+func (x *Driver) packet(data []byte) {
+	packet, err := ParsePacket(data)
+	if err != nil {
+		return
+	}
+	x.mutex.Lock()
+	defer x.mutex.Unlock()
+	if x.track == nil || packet.PayloadType != x.track.payloadType {
+		return
+	}
+	x.reception.packet(packet.SSRC, packet.Sequence)
+	jpeg, err := x.jpeg.Push(packet.Payload, packet.Timestamp, packet.Marker)
+	if err != nil {
+		log.Warn().Err(err).Str("component", "driver").Str("name", x.config.Name).Msg("rtp/jpeg")
+		return
+	}
+	if jpeg == nil || !base.ValidateJPEG(jpeg) {
+		return
+	}
+	x.lastFrame = time.Now()
+	if x.streaming {
+		x.frames.Publish(&base.Capture{Image: jpeg, Type: base.JPEG, Time: x.lastFrame})
+	}
+}
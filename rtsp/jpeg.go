@@ -0,0 +1,306 @@
+// Copyright © 2023 Sloan Childers
+package rtsp
+
+import (
+	"encoding/binary"
+	"errors"
+)
+
+// RFC 2435 RTP payload format for JPEG
+const (
+	JPEG_PAYLOAD_TYPE   = 26
+	JPEG_HEADER_SIZE    = 8
+	RESTART_HEADER_SIZE = 4
+	QTABLE_HEADER_SIZE  = 4
+	// largest frame a depacketizer assembles
+	MAX_FRAME_SIZE = 16 << 20
+)
+
+var ErrJpegPayload = errors.New("bad RTP/JPEG payload")
+
+// quantization tables of section K.1 of the JPEG spec, in zig-zag order
+var lumaQuantizer = [64]byte{
+	16, 11, 12, 14, 12, 10, 16, 14,
+	13, 14, 18, 17, 16, 19, 24, 40,
+	26, 24, 22, 22, 24, 49, 35, 37,
+	29, 40, 58, 51, 61, 60, 57, 51,
+	56, 55, 64, 72, 92, 78, 64, 68,
+	87, 69, 55, 56, 80, 109, 81, 87,
+	95, 98, 103, 104, 103, 62, 77, 113,
+	121, 112, 100, 120, 92, 101, 103, 99,
+}
+
+var chromaQuantizer = [64]byte{
+	17, 18, 18, 24, 21, 24, 47, 26,
+	26, 47, 99, 66, 56, 66, 99, 99,
+	99, 99, 99, 99, 99, 99, 99, 99,
+	99, 99, 99, 99, 99, 99, 99, 99,
+	99, 99, 99, 99, 99, 99, 99, 99,
+	99, 99, 99, 99, 99, 99, 99, 99,
+	99, 99, 99, 99, 99, 99, 99, 99,
+	99, 99, 99, 99, 99, 99, 99, 99,
+}
+
+type huffmanTable struct {
+	class  byte
+	id     byte
+	counts [16]byte
+	values []byte
+}
+
+// the Huffman tables of section K.3 of the JPEG spec, which RTP/JPEG always uses
+var huffmanTables = []huffmanTable{
+	{0, 0, [16]byte{0, 1, 5, 1, 1, 1, 1, 1, 1, 0, 0, 0, 0, 0, 0, 0},
+		[]byte{0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11}},
+	{1, 0, [16]byte{0, 2, 1, 3, 3, 2, 4, 3, 5, 5, 4, 4, 0, 0, 1, 125},
+		[]byte{
+			0x01, 0x02, 0x03, 0x00, 0x04, 0x11, 0x05, 0x12,
+			0x21, 0x31, 0x41, 0x06, 0x13, 0x51, 0x61, 0x07,
+			0x22, 0x71, 0x14, 0x32, 0x81, 0x91, 0xa1, 0x08,
+			0x23, 0x42, 0xb1, 0xc1, 0x15, 0x52, 0xd1, 0xf0,
+			0x24, 0x33, 0x62, 0x72, 0x82, 0x09, 0x0a, 0x16,
+			0x17, 0x18, 0x19, 0x1a, 0x25, 0x26, 0x27, 0x28,
+			0x29, 0x2a, 0x34, 0x35, 0x36, 0x37, 0x38, 0x39,
+			0x3a, 0x43, 0x44, 0x45, 0x46, 0x47, 0x48, 0x49,
+			0x4a, 0x53, 0x54, 0x55, 0x56, 0x57, 0x58, 0x59,
+			0x5a, 0x63, 0x64, 0x65, 0x66, 0x67, 0x68, 0x69,
+			0x6a, 0x73, 0x74, 0x75, 0x76, 0x77, 0x78, 0x79,
+			0x7a, 0x83, 0x84, 0x85, 0x86, 0x87, 0x88, 0x89,
+			0x8a, 0x92, 0x93, 0x94, 0x95, 0x96, 0x97, 0x98,
+			0x99, 0x9a, 0xa2, 0xa3, 0xa4, 0xa5, 0xa6, 0xa7,
+			0xa8, 0xa9, 0xaa, 0xb2, 0xb3, 0xb4, 0xb5, 0xb6,
+			0xb7, 0xb8, 0xb9, 0xba, 0xc2, 0xc3, 0xc4, 0xc5,
+			0xc6, 0xc7, 0xc8, 0xc9, 0xca, 0xd2, 0xd3, 0xd4,
+			0xd5, 0xd6, 0xd7, 0xd8, 0xd9, 0xda, 0xe1, 0xe2,
+			0xe3, 0xe4, 0xe5, 0xe6, 0xe7, 0xe8, 0xe9, 0xea,
+			0xf1, 0xf2, 0xf3, 0xf4, 0xf5, 0xf6, 0xf7, 0xf8,
+			0xf9, 0xfa,
+		}},
+	{0, 1, [16]byte{0, 3, 1, 1, 1, 1, 1, 1, 1, 1, 1, 0, 0, 0, 0, 0},
+		[]byte{0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11}},
+	{1, 1, [16]byte{0, 2, 1, 2, 4, 4, 3, 4, 7, 5, 4, 4, 0, 1, 2, 119},
+		[]byte{
+			0x00, 0x01, 0x02, 0x03, 0x11, 0x04, 0x05, 0x21,
+			0x31, 0x06, 0x12, 0x41, 0x51, 0x07, 0x61, 0x71,
+			0x13, 0x22, 0x32, 0x81, 0x08, 0x14, 0x42, 0x91,
+			0xa1, 0xb1, 0xc1, 0x09, 0x23, 0x33, 0x52, 0xf0,
+			0x15, 0x62, 0x72, 0xd1, 0x0a, 0x16, 0x24, 0x34,
+			0xe1, 0x25, 0xf1, 0x17, 0x18, 0x19, 0x1a, 0x26,
+			0x27, 0x28, 0x29, 0x2a, 0x35, 0x36, 0x37, 0x38,
+			0x39, 0x3a, 0x43, 0x44, 0x45, 0x46, 0x47, 0x48,
+			0x49, 0x4a, 0x53, 0x54, 0x55, 0x56, 0x57, 0x58,
+			0x59, 0x5a, 0x63, 0x64, 0x65, 0x66, 0x67, 0x68,
+			0x69, 0x6a, 0x73, 0x74, 0x75, 0x76, 0x77, 0x78,
+			0x79, 0x7a, 0x82, 0x83, 0x84, 0x85, 0x86, 0x87,
+			0x88, 0x89, 0x8a, 0x92, 0x93, 0x94, 0x95, 0x96,
+			0x97, 0x98, 0x99, 0x9a, 0xa2, 0xa3, 0xa4, 0xa5,
+			0xa6, 0xa7, 0xa8, 0xa9, 0xaa, 0xb2, 0xb3, 0xb4,
+			0xb5, 0xb6, 0xb7, 0xb8, 0xb9, 0xba, 0xc2, 0xc3,
+			0xc4, 0xc5, 0xc6, 0xc7, 0xc8, 0xc9, 0xca, 0xd2,
+			0xd3, 0xd4, 0xd5, 0xd6, 0xd7, 0xd8, 0xd9, 0xda,
+			0xe2, 0xe3, 0xe4, 0xe5, 0xe6, 0xe7, 0xe8, 0xe9,
+			0xea, 0xf2, 0xf3, 0xf4, 0xf5, 0xf6, 0xf7, 0xf8,
+			0xf9, 0xfa,
+		}},
+}
+
+// MakeTables returns the luma and chroma quantization tables of Q factor q, as in
+// appendix A of RFC 2435.
+func MakeTables(q int) []byte {
+	factor := q
+	if factor < 1 {
+		factor = 1
+	}
+	if factor > 99 {
+		factor = 99
+	}
+	if factor < 50 {
+		q = 5000 / factor
+	} else {
+		q = 200 - factor*2
+	}
+	tables := make([]byte, 128)
+	for i := 0; i < 64; i++ {
+		tables[i] = scaleQuantizer(lumaQuantizer[i], q)
+		tables[64+i] = scaleQuantizer(chromaQuantizer[i], q)
+	}
+	return tables
+}
+
+func scaleQuantizer(value byte, q int) byte {
+	scaled := (int(value)*q + 50) / 100
+	if scaled < 1 {
+		return 1
+	}
+	if scaled > 255 {
+		return 255
+	}
+	return byte(scaled)
+}
+
+// jpegFrame is the frame a depacketizer is putting together.
+type jpegFrame struct {
+	timestamp uint32
+	kind      byte
+	q         byte
+	width     int
+	height    int
+	restart   uint16
+	tables    []byte
+	precision byte
+	scan      []byte
+}
+
+// Depacketizer rebuilds JPEG frames from RTP/JPEG packets.  A frame with a lost
+// packet is dropped.
+type Depacketizer struct {
+	frame *jpegFrame
+	// in band tables of Q 128-254, which a sender may leave out once sent
+	tables map[byte][]byte
+}
+
+func NewDepacketizer() *Depacketizer {
+	return &Depacketizer{tables: make(map[byte][]byte)}
+}
+
+// Push adds the payload of one RTP packet and returns the JPEG once its last packet,
+// the one with the marker bit, arrived.
+func (x *Depacketizer) Push(payload []byte, timestamp uint32, marker bool) ([]byte, error) {
+	if len(payload) < JPEG_HEADER_SIZE {
+		return nil, ErrJpegPayload
+	}
+	offset := int(payload[1])<<16 | int(payload[2])<<8 | int(payload[3])
+	kind := payload[4]
+	q := payload[5]
+	width := int(payload[6]) * 8
+	height := int(payload[7]) * 8
+	data := payload[JPEG_HEADER_SIZE:]
+
+	var restart uint16
+	if kind >= 64 && kind <= 127 {
+		if len(data) < RESTART_HEADER_SIZE {
+			return nil, ErrJpegPayload
+		}
+		restart = binary.BigEndian.Uint16(data)
+		data = data[RESTART_HEADER_SIZE:]
+	}
+
+	if offset == 0 {
+		x.frame = &jpegFrame{timestamp: timestamp, kind: kind, q: q, width: width, height: height, restart: restart}
+		if q >= 128 {
+			if len(data) < QTABLE_HEADER_SIZE {
+				x.frame = nil
+				return nil, ErrJpegPayload
+			}
+			precision := data[1]
+			length := int(binary.BigEndian.Uint16(data[2:]))
+			data = data[QTABLE_HEADER_SIZE:]
+			if len(data) < length {
+				x.frame = nil
+				return nil, ErrJpegPayload
+			}
+			if length > 0 {
+				x.frame.tables = append([]byte{}, data[:length]...)
+				x.frame.precision = precision
+				if q != 255 {
+					x.tables[q] = x.frame.tables
+				}
+			} else {
+				x.frame.tables = x.tables[q]
+			}
+			data = data[length:]
+		} else {
+			x.frame.tables = MakeTables(int(q))
+		}
+	}
+
+	frame := x.frame
+	if frame == nil || frame.timestamp != timestamp || offset != len(frame.scan) {
+		// a packet went missing, wait for the start of the next frame
+		x.frame = nil
+		return nil, nil
+	}
+	if len(frame.scan)+len(data) > MAX_FRAME_SIZE {
+		x.frame = nil
+		return nil, ErrJpegPayload
+	}
+	frame.scan = append(frame.scan, data...)
+	if !marker {
+		return nil, nil
+	}
+	x.frame = nil
+	if frame.tables == nil {
+		// Q 128-254 without tables, and none seen before
+		return nil, ErrJpegPayload
+	}
+	return frame.jpeg(), nil
+}
+
+// jpeg wraps the scan data in the headers RTP/JPEG leaves out.
+func (x *jpegFrame) jpeg() []byte {
+	out := make([]byte, 0, len(x.scan)+1024)
+	out = append(out, 0xFF, 0xD8)
+
+	// DQT, luma then chroma, a single table serves both
+	tableSize := 64
+	if x.precision&1 != 0 {
+		tableSize = 128
+	}
+	luma := x.tables
+	if len(luma) > tableSize {
+		luma = luma[:tableSize]
+	}
+	chroma := luma
+	if len(x.tables) >= tableSize*2 {
+		chromaSize := 64
+		if x.precision&2 != 0 {
+			chromaSize = 128
+		}
+		chroma = x.tables[tableSize:]
+		if len(chroma) > chromaSize {
+			chroma = chroma[:chromaSize]
+		}
+	}
+	out = appendQuantTable(out, 0, luma)
+	out = appendQuantTable(out, 1, chroma)
+
+	if x.restart != 0 {
+		out = append(out, 0xFF, 0xDD, 0, 4, byte(x.restart>>8), byte(x.restart))
+	}
+
+	// SOF0, type 0 is 4:2:2 and type 1 is 4:2:0
+	sampling := byte(0x21)
+	if x.kind&0x3F == 1 {
+		sampling = 0x22
+	}
+	out = append(out, 0xFF, 0xC0, 0, 17, 8,
+		byte(x.height>>8), byte(x.height), byte(x.width>>8), byte(x.width), 3,
+		1, sampling, 0,
+		2, 0x11, 1,
+		3, 0x11, 1)
+
+	for _, table := range huffmanTables {
+		length := 2 + 1 + 16 + len(table.values)
+		out = append(out, 0xFF, 0xC4, byte(length>>8), byte(length), table.class<<4|table.id)
+		out = append(out, table.counts[:]...)
+		out = append(out, table.values...)
+	}
+
+	// SOS
+	out = append(out, 0xFF, 0xDA, 0, 12, 3, 1, 0x00, 2, 0x11, 3, 0x11, 0, 63, 0)
+	out = append(out, x.scan...)
+	if len(x.scan) < 2 || x.scan[len(x.scan)-2] != 0xFF || x.scan[len(x.scan)-1] != 0xD9 {
+		out = append(out, 0xFF, 0xD9)
+	}
+	return out
+}
+
+func appendQuantTable(out []byte, id byte, table []byte) []byte {
+	precision := byte(0)
+	if len(table) == 128 {
+		precision = 1
+	}
+	length := 2 + 1 + len(table)
+	out = append(out, 0xFF, 0xDB, byte(length>>8), byte(length), precision<<4|id)
+	return append(out, table...)
+}
@@ -0,0 +1,19 @@
+// Copyright © 2023 Sloan Childers
+package rtsp
+
+import "github.com/osintami/camz/base"
+
+func init() {
+	base.Register(base.Plugin{
+		Name:        "rtsp",
+		Description: "network camera with an RTSP stream of RTP/JPEG",
+		Config: []base.PluginField{
+			{Name: "Uri", Type: "string", Description: "rtsp:// URL, or its path on Addr"},
+			{Name: "Addr", Type: "string", Description: "host name or IP address, unless Uri is a URL"},
+			{Name: "Port", Type: "int", Description: "RTSP port, 554 when missing"},
+			{Name: "User", Type: "string", Description: "user for digest or basic authentication"},
+			{Name: "Pass", Type: "string", Description: "password of User"},
+			{Name: "Transport", Type: "string", Description: "tcp (interleaved, the default) or udp"},
+		},
+		New: func(config *base.CameraConfig) base.IDriver { return NewDriver(config) }})
+}
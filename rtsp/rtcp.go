@@ -0,0 +1,71 @@
+// Copyright © 2023 Sloan Childers
+package rtsp
+
+import (
+	"encoding/binary"
+	"time"
+)
+
+// RTCP receiver reports over UDP, cameras drop a session they hear nothing from.
+// Sender reports are read for the time of the latest one, nothing is lost or
+// jittered as far as the reports go.
+
+const (
+	RTCP_SR       = 200
+	RTCP_RR       = 201
+	RTCP_INTERVAL = 5 * time.Second
+)
+
+// reception is what the receiver reports say about the RTP stream.
+type reception struct {
+	ssrc    uint32
+	started bool
+	// the highest sequence number, extended with its wraparounds
+	highest uint32
+	// the middle of the NTP time of the latest sender report, and when it came in
+	lsr     uint32
+	lsrTime time.Time
+}
+
+// packet counts in an RTP packet, a new source starts over.
+func (x *reception) packet(ssrc uint32, seq uint16) {
+	if !x.started || ssrc != x.ssrc {
+		x.ssrc, x.started, x.highest = ssrc, true, uint32(seq)
+		return
+	}
+	// late packets are behind, wrapped ones a little ahead
+	if diff := int16(seq - uint16(x.highest)); diff > 0 {
+		x.highest += uint32(diff)
+	}
+}
+
+// senderReport takes the time of the sender report leading an RTCP packet.
+func (x *reception) senderReport(data []byte, now time.Time) {
+	if len(data) < 20 || data[0]>>6 != 2 || data[1] != RTCP_SR {
+		return
+	}
+	x.lsr = binary.BigEndian.Uint32(data[10:])
+	x.lsrTime = now
+}
+
+// report is a receiver report from ssrc, without a report block until a packet came in.
+func (x *reception) report(ssrc uint32, now time.Time) []byte {
+	if !x.started {
+		packet := []byte{0x80, RTCP_RR, 0, 1, 0, 0, 0, 0}
+		binary.BigEndian.PutUint32(packet[4:], ssrc)
+		return packet
+	}
+	packet := make([]byte, 32)
+	packet[0] = 0x81
+	packet[1] = RTCP_RR
+	binary.BigEndian.PutUint16(packet[2:], 7)
+	binary.BigEndian.PutUint32(packet[4:], ssrc)
+	binary.BigEndian.PutUint32(packet[8:], x.ssrc)
+	binary.BigEndian.PutUint32(packet[16:], x.highest)
+	if !x.lsrTime.IsZero() {
+		binary.BigEndian.PutUint32(packet[24:], x.lsr)
+		// in 1/65536 of a second
+		binary.BigEndian.PutUint32(packet[28:], uint32(now.Sub(x.lsrTime)*65536/time.Second))
+	}
+	return packet
+}
@@ -0,0 +1,51 @@
+// Copyright © 2023 Sloan Childers
+package rtsp
+
+import (
+	"encoding/binary"
+	"errors"
+)
+
+const RTP_HEADER = 12
+
+var ErrRtpPacket = errors.New("bad RTP packet")
+
+// Packet is the part of an RTP packet the depacketizer needs.
+type Packet struct {
+	PayloadType byte
+	Marker      bool
+	Sequence    uint16
+	Timestamp   uint32
+	SSRC        uint32
+	Payload     []byte
+}
+
+// ParsePacket reads the fixed header, skips the CSRC list and header extension
+// and drops the padding.
+func ParsePacket(data []byte) (*Packet, error) {
+	if len(data) < RTP_HEADER || data[0]>>6 != 2 {
+		return nil, ErrRtpPacket
+	}
+	offset := RTP_HEADER + 4*int(data[0]&0x0F)
+	if data[0]&0x10 != 0 {
+		if len(data) < offset+4 {
+			return nil, ErrRtpPacket
+		}
+		offset += 4 + 4*int(binary.BigEndian.Uint16(data[offset+2:]))
+	}
+	end := len(data)
+	if data[0]&0x20 != 0 {
+		// the last byte counts the padding
+		end -= int(data[end-1])
+	}
+	if offset > end {
+		return nil, ErrRtpPacket
+	}
+	return &Packet{
+		PayloadType: data[1] & 0x7F,
+		Marker:      data[1]&0x80 != 0,
+		Sequence:    binary.BigEndian.Uint16(data[2:]),
+		Timestamp:   binary.BigEndian.Uint32(data[4:]),
+		SSRC:        binary.BigEndian.Uint32(data[8:]),
+		Payload:     data[offset:end]}, nil
+}
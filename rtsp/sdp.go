@@ -0,0 +1,80 @@
+// Copyright © 2023 Sloan Childers
+package rtsp
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"strconv"
+	"strings"
+)
+
+var ErrNoJpegTrack = errors.New("no RTP/JPEG video track in SDP")
+
+// track is the media of an SDP session description the driver plays.
+type track struct {
+	control     string
+	payloadType byte
+}
+
+// parseSDP finds the first JPEG video track of a session description.
+func parseSDP(body []byte) (*track, error) {
+	var current *track
+	found := []*track{}
+	formats := map[*track][]int{}
+	rtpmaps := map[*track]map[int]string{}
+
+	scanner := bufio.NewScanner(bytes.NewReader(body))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		switch {
+		case strings.HasPrefix(line, "m="):
+			fields := strings.Fields(line[2:])
+			current = nil
+			if len(fields) >= 4 && fields[0] == "video" {
+				current = &track{}
+				rtpmaps[current] = map[int]string{}
+				for _, field := range fields[3:] {
+					pt, err := strconv.Atoi(field)
+					if err == nil {
+						formats[current] = append(formats[current], pt)
+					}
+				}
+				found = append(found, current)
+			}
+		case current != nil && strings.HasPrefix(line, "a=control:"):
+			current.control = strings.TrimPrefix(line, "a=control:")
+		case current != nil && strings.HasPrefix(line, "a=rtpmap:"):
+			pt, encoding, _ := strings.Cut(strings.TrimPrefix(line, "a=rtpmap:"), " ")
+			number, err := strconv.Atoi(pt)
+			if err == nil {
+				rtpmaps[current][number] = strings.ToUpper(encoding)
+			}
+		}
+	}
+	for _, track := range found {
+		for _, pt := range formats[track] {
+			encoding, mapped := rtpmaps[track][pt]
+			if (!mapped && pt == JPEG_PAYLOAD_TYPE) || strings.HasPrefix(encoding, "JPEG/") {
+				track.payloadType = byte(pt)
+				return track, nil
+			}
+		}
+	}
+	return nil, ErrNoJpegTrack
+}
+
+// controlURL resolves the control attribute of a track against the base URL.
+func controlURL(base, control string) string {
+	if control == "" || control == "*" {
+		return base
+	}
+	if strings.HasPrefix(control, "rtsp://") {
+		return control
+	}
+	// cameras expect the control appended to the base, not resolved as a relative URL
+	if !strings.HasSuffix(base, "/") {
+		base += "/"
+	}
+	return base + strings.TrimPrefix(control, "/")
+}
@@ -2,85 +2,118 @@
 package main
 
 import (
+	"bytes"
+	"context"
 	"encoding/json"
 	"errors"
-	"image"
-	"image/color"
-	"io/fs"
+	"io"
 	"net/http"
 	"os"
+	"strconv"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/osintami/camz/base"
+	"github.com/osintami/camz/recorder"
 	"github.com/osintami/camz/sink"
 	"github.com/rs/zerolog/log"
-	"gocv.io/x/gocv"
 )
 
 type Config struct {
 	PathPrefix string `env:"PATH_PREFIX" envDefault:"/"`
 	ListenAddr string `env:"LISTEN_ADDR,required" envDefault:"0.0.0.0:80"`
 	LogLevel   string `env:"LOG_LEVEL" envDefault:"TRACE"`
+	ClipDir    string `env:"CLIP_DIR" envDefault:"./clips"`
+	// continuous recording and its retention, zero limits are not enforced
+	RecordDir      string        `env:"RECORD_DIR" envDefault:"./recordings"`
+	RecordMaxAge   time.Duration `env:"RECORD_MAX_AGE" envDefault:"168h"`
+	RecordQuotaMB  int64         `env:"RECORD_QUOTA_MB" envDefault:"0"`
+	RecordMaxUsage float64       `env:"RECORD_MAX_USAGE" envDefault:"90"`
 }
 
 type CamzServer struct {
-	webcam base.IDriver
-	motion base.IMotion
-	gps    *base.GPS
-	config *base.CameraConfig
+	camz     *Camz
+	webcam   base.IDriver
+	pipeline *Pipeline
+	detector *Detector
+	clips    *recorder.ClipRecorder
+	segments *recorder.SegmentRecorder
+	clients  *streamClients
+	dir      string
+	config   atomic.Pointer[base.CameraConfig]
+	mutex    sync.Mutex
 }
 
 var ErrSizeUnsupported = errors.New("invalid size")
 var ErrSaveConfig = errors.New("save configuration failed")
 var ErrApiKey = errors.New("api key invalid")
-
-func NewCamzServer(webcam base.IDriver, motion base.IMotion, gps *base.GPS, config *base.CameraConfig) *CamzServer {
-	return &CamzServer{
-		webcam: webcam,
-		motion: motion,
-		gps:    gps,
-		config: config}
+var ErrNoRecording = errors.New("no recording in range")
+var ErrUuidChange = errors.New("camera uuid can't be changed")
+var ErrPTZCommand = errors.New("unknown ptz command")
+var ErrPTZMethod = errors.New("ptz commands other than presets need a POST")
+var ErrControlsUnsupported = errors.New("camera has no controls")
+
+// largest accepted configuration update
+const MAX_CONFIG_SIZE = 1 << 20
+
+func NewCamzServer(webcam base.IDriver, motion base.IMotion, gps *base.GPS, serverCfg *Config, config *base.CameraConfig) *CamzServer {
+	detector := NewDetector(motion, config)
+	clips := recorder.NewClipRecorder(serverCfg.ClipDir, config)
+	segments := recorder.NewSegmentRecorder(serverCfg.RecordDir, config)
+	detector.AddListener(clips.Event)
+	server := &CamzServer{
+		webcam:   webcam,
+		pipeline: NewPipeline(webcam, detector, gps, config, clips, segments),
+		detector: detector,
+		clips:    clips,
+		segments: segments,
+		clients:  newStreamClients(),
+		dir:      serverCfg.RecordDir}
+	server.config.Store(config)
+	return server
 }
 
-func (x *CamzServer) checkAPIKey(r *http.Request) bool {
-
-	if true {
-		return true
-	}
-
-	key := r.URL.Query().Get("key")
-	if key == "" {
-		key = r.Header.Get("X-Api-Key")
-	}
-
-	if key == x.config.ApiKey {
-		return true
-	}
-
-	return false
+func (x *CamzServer) checkAPIKey(w http.ResponseWriter, r *http.Request, role base.Role) bool {
+	return x.camz.checkAPIKey(w, r, x.Config().Uuid, role)
 }
 
+// CommandHandler stops, starts or resets the camera.  Start and reset restart
+// the driver on a paused camera and answer with the error of the driver, which
+// the supervisor keeps retrying.
 func (x *CamzServer) CommandHandler(w http.ResponseWriter, r *http.Request) {
-	if !x.checkAPIKey(r) {
-		sink.SendError(w, ErrApiKey, http.StatusForbidden)
+	if !x.checkAPIKey(w, r, base.ROLE_OPERATOR) {
 		return
 	}
 
+	x.mutex.Lock()
+	defer x.mutex.Unlock()
+
+	var err error
 	format := r.URL.Query().Get("command")
 	switch format {
 	case "stop":
+		x.pause()
 		x.webcam.Stop()
 	case "start":
-		x.webcam.Open()
+		x.pause()
+		x.webcam.Stop()
+		err = x.webcam.Open()
 		x.webcam.Stream()
+		x.resume()
 	case "reset":
-		x.webcam.Reset()
+		x.pause()
+		err = x.webcam.Reset()
+		x.resume()
+	}
+	if err != nil {
+		log.Error().Err(err).Str("component", "server").Str("name", x.Config().Name).Str("command", format).Msg("webcam")
+		sink.SendError(w, err, http.StatusBadGateway)
 	}
 }
 
 func (x *CamzServer) StreamHandler(w http.ResponseWriter, r *http.Request) {
-	if !x.checkAPIKey(r) {
-		sink.SendError(w, ErrApiKey, http.StatusForbidden)
+	if !x.checkAPIKey(w, r, base.ROLE_VIEWER) {
 		return
 	}
 
@@ -91,165 +124,534 @@ func (x *CamzServer) StreamHandler(w http.ResponseWriter, r *http.Request) {
 	case "wav":
 		//x.StreamWAV(w)
 	default:
-		x.StreamMJPEG(w)
+		x.StreamMJPEG(r.Context(), w, r.RemoteAddr)
 	}
 }
 
-var orange = color.RGBA{255, 127, 0, 0}
-
-func (x *CamzServer) StreamMJPEG(w http.ResponseWriter) {
+func (x *CamzServer) StreamMJPEG(ctx context.Context, w http.ResponseWriter, remote string) {
 
 	w.Header().Set("Content-Type", "multipart/x-mixed-replace; boundary=--myboundary")
 	w.Header().Set("Server", "Camd")
 	w.Header().Set("Connection", "Close")
+
+	frames, cancel := x.pipeline.Subscribe()
+	defer cancel()
+	client := x.clients.add(remote)
+	defer x.clients.remove(client)
 	for {
-		startTime := time.Now().UnixMilli()
-		frame := x.webcam.Grab()
-		intruder := false
-		if x.config.Motion.Enabled {
-			intruder = x.motion.Detect(frame)
-			if intruder {
-				if x.config.Motion.Decorate {
-					currFrame := frame.OpenCV(false)
-					gocv.Rectangle(&currFrame, image.Rect(0, 0, x.config.Width, x.config.Height), orange, 2)
-				}
+		select {
+		case <-ctx.Done():
+			return
+		case frame := <-frames:
+			err := base.WriteMjpeg(w, frame.Jpeg)
+			if err != nil {
+				log.Warn().Str("component", "mjpeg-server").Str("name", x.Config().Name).Msg("stream is dead")
+				return
 			}
-		}
-		jpeg := frame.ToColorJpeg(nil)
-		if x.config.Motion.Enabled && intruder {
-			exifInfo, err := x.gps.ToExif()
-			if err == nil {
-				// TODO:  these values needs to live in camera.json
-				out, err := base.WriteExif(exifInfo, "OSINTAMI", "CarCamz", "0.1", "camz-dev", frame.Time(), jpeg)
-				if err == nil {
-					jpeg = out
-					//os.WriteFile("gps.jpeg", jpeg, 0644)
-				}
+			if flusher, ok := w.(http.Flusher); ok {
+				flusher.Flush()
 			}
+			x.clients.sent(client, frame.Time)
 		}
-		frame.Close()
-
-		if !base.ValidateJPEG(jpeg) {
-			log.Warn().Str("component", "mjpeg-server").Str("name", x.config.Name).Msg("invalid JPEG, skipping")
-			jpeg = base.EmptyFrame(x.config.Width, x.config.Height)
-		}
-		err := base.WriteMjpeg(w, jpeg)
-		if err != nil {
-			log.Warn().Str("component", "mjpeg-server").Str("name", x.config.Name).Msg("stream is dead")
-			return
-		}
-		base.Sleep(int64(x.config.Rate), time.Now().UnixMilli()-startTime)
 	}
 }
 
 func (x *CamzServer) FormatsHandler(w http.ResponseWriter, r *http.Request) {
-	if !x.checkAPIKey(r) {
-		sink.SendError(w, ErrApiKey, http.StatusForbidden)
+	if !x.checkAPIKey(w, r, base.ROLE_OPERATOR) {
 		return
 	}
-	x.webcam.Stop()
-	out, _ := json.Marshal(x.webcam.ListFormatsAndFrameSizes())
-	x.webcam.Open()
-	x.webcam.Stream()
-	w.Write(out)
 
+	x.mutex.Lock()
+	defer x.mutex.Unlock()
+
+	// drivers that need the device to themselves pause the stream on their own
+	sink.SendPrettyJSON(r.Context(), w, x.webcam.ListFormatsAndFrameSizes())
 }
 
+// ConfigUpdateHandler applies an RFC 7396 merge patch to the camera configuration.
+// The new configuration is validated, swapped in while the camera is paused and
+// rolled back as a whole when the driver can't start with it or it can't be saved.
 func (x *CamzServer) ConfigUpdateHandler(w http.ResponseWriter, r *http.Request) {
+	if !x.checkAPIKey(w, r, base.ROLE_ADMIN) {
+		return
+	}
 
-	if !x.checkAPIKey(r) {
-		sink.SendError(w, ErrApiKey, http.StatusForbidden)
+	defer r.Body.Close()
+	patch, err := io.ReadAll(io.LimitReader(r.Body, MAX_CONFIG_SIZE))
+	if err != nil {
+		sink.SendError(w, err, http.StatusBadRequest)
 		return
 	}
 
-	config := &base.CameraConfig{Motion: &base.MotionConfig{}}
+	x.mutex.Lock()
+	defer x.mutex.Unlock()
 
-	// establish default values for missing fields
-	config.ApiKey = x.config.ApiKey
-	config.Name = x.config.Name
-	config.Device = x.config.Device
-	config.Height = x.config.Height
-	config.Width = x.config.Width
-	config.Rate = x.config.Rate
-	config.Motion.Enabled = x.config.Motion.Enabled
-	config.Motion.Area = x.config.Motion.Area
-	config.Motion.Detections = x.config.Motion.Detections
-	config.Motion.Overlap = x.config.Motion.Overlap
-	config.Motion.Decorate = x.config.Motion.Decorate
+	previous := x.Config()
+	current, err := json.Marshal(previous)
+	if err != nil {
+		sink.SendError(w, err, http.StatusInternalServerError)
+		return
+	}
+	merged, err := base.MergePatch(current, patch)
+	if err != nil {
+		sink.SendError(w, err, http.StatusBadRequest)
+		return
+	}
+	config := &base.CameraConfig{}
+	decoder := json.NewDecoder(bytes.NewReader(merged))
+	decoder.DisallowUnknownFields()
+	err = decoder.Decode(config)
+	if err != nil {
+		sink.SendError(w, err, http.StatusBadRequest)
+		return
+	}
+	if config.Uuid != previous.Uuid {
+		sink.SendError(w, ErrUuidChange, http.StatusBadRequest)
+		return
+	}
+	if config.Motion == nil {
+		config.Motion = &base.MotionConfig{}
+	}
+	// keys live in Cameras.ApiKeys, they can't be set per camera anymore
+	config.ApiKey = ""
+	err = config.Validate()
+	if err != nil {
+		sink.SendError(w, err, http.StatusUnprocessableEntity)
+		return
+	}
 
-	err := json.NewDecoder(r.Body).Decode(config)
+	// the running configuration isn't written to, everything that reads it is
+	// stopped and handed the new one, so a rollback just restarts the old driver
+	x.pause()
+	defer x.resume()
+	webcam, err := NewDriver(config)
 	if err != nil {
+		sink.SendError(w, err, http.StatusUnprocessableEntity)
+		return
+	}
+	x.webcam.Stop()
+	err = webcam.Open()
+	if err != nil {
+		log.Error().Err(err).Str("component", "server").Str("name", previous.Name).Msg("config rejected by driver, rolling back")
+	} else {
+		// saved for the next restart before it goes live, so the answer is what runs
+		err = x.camz.saveCamera(config)
+		if err != nil {
+			log.Error().Err(err).Str("component", "server").Str("name", config.Name).Msg("save camera.json, rolling back")
+			err = ErrSaveConfig
+		}
+	}
+	if err != nil {
+		webcam.Stop()
+		rollbackErr := x.webcam.Open()
+		if rollbackErr != nil {
+			log.Error().Err(rollbackErr).Str("component", "server").Str("name", previous.Name).Msg("restart with previous config")
+		}
+		// the supervisor keeps trying the previous driver either way
+		x.webcam.Stream()
 		sink.SendError(w, err, http.StatusInternalServerError)
 		return
 	}
+	webcam.Stream()
+	x.setConfig(webcam, config)
+	sink.SendPrettyJSON(r.Context(), w, config)
+}
+
+// pause stops everything that runs on the configuration, each waits for its goroutine.
+func (x *CamzServer) pause() {
+	x.pipeline.Stop()
+	x.detector.Stop()
+	x.clips.Stop()
+	x.segments.Stop()
+}
+
+func (x *CamzServer) resume() {
+	x.pipeline.Start()
+	x.detector.Start()
+	x.clips.Start()
+	x.segments.Start()
+}
+
+// setConfig hands config and its driver to the paused camera.
+func (x *CamzServer) setConfig(webcam base.IDriver, config *base.CameraConfig) {
+	x.webcam = webcam
+	x.pipeline.SetDriver(webcam)
+	x.pipeline.SetConfig(config)
+	x.detector.SetConfig(config)
+	x.clips.SetConfig(config)
+	x.segments.SetConfig(config)
+	x.camz.replace(config)
+	x.config.Store(config)
+}
+
+// Config is the camera configuration, replaced as a whole by an update.
+func (x *CamzServer) Config() *base.CameraConfig {
+	return x.config.Load()
+}
+
+// PTZHandler lists the presets of cameras with pan, tilt and zoom.  Moves are
+// POSTs, so a prefetched or embedded link can't move the camera.
+func (x *CamzServer) PTZHandler(w http.ResponseWriter, r *http.Request) {
+	if !x.checkAPIKey(w, r, base.ROLE_VIEWER) {
+		return
+	}
+
+	if command := r.URL.Query().Get("command"); command != "" && command != "presets" {
+		w.Header().Set("Allow", "POST")
+		sink.SendError(w, ErrPTZMethod, http.StatusMethodNotAllowed)
+		return
+	}
+	ptz, ok := base.Unwrap(x.pipeline.driver()).(base.IPTZ)
+	if !ok {
+		sink.SendError(w, base.ErrPTZUnsupported, http.StatusNotImplemented)
+		return
+	}
+	presets, err := ptz.Presets()
+	if err != nil {
+		log.Error().Err(err).Str("component", "server").Str("name", x.Config().Name).Msg("ptz presets")
+		sink.SendError(w, err, http.StatusBadGateway)
+		return
+	}
+	sink.SendPrettyJSON(r.Context(), w, presets)
+}
+
+// PTZUpdateHandler moves cameras with pan, tilt and zoom, the parameters are in
+// the query or a form body:
+//
+//	command=move&pan=10&tilt=-5&zoom=2000&relative=true, any of pan, tilt, zoom
+//	command=zoom&zoom=2000
+//	command=continuous&pan=50&tilt=0&zoom=0, speeds of -100 to 100
+//	command=stop
+//	command=goto&preset=door
+//	command=save&preset=door
+func (x *CamzServer) PTZUpdateHandler(w http.ResponseWriter, r *http.Request) {
+	if !x.checkAPIKey(w, r, base.ROLE_OPERATOR) {
+		return
+	}
+
+	ptz, ok := base.Unwrap(x.pipeline.driver()).(base.IPTZ)
+	if !ok {
+		sink.SendError(w, base.ErrPTZUnsupported, http.StatusNotImplemented)
+		return
+	}
+
+	err := r.ParseForm()
+	if err != nil {
+		sink.SendError(w, err, http.StatusBadRequest)
+		return
+	}
+	query := r.Form
+	switch query.Get("command") {
+	case "move", "zoom":
+		move := base.PTZMove{Relative: query.Get("relative") == "true"}
+		if query.Get("command") == "move" {
+			move.Pan, err = floatParam(query.Get("pan"), err)
+			move.Tilt, err = floatParam(query.Get("tilt"), err)
+		}
+		move.Zoom, err = intParam(query.Get("zoom"), err)
+		if err == nil {
+			err = ptz.Move(move)
+		}
+	case "continuous":
+		var pan, tilt, zoom *int
+		pan, err = intParam(query.Get("pan"), err)
+		tilt, err = intParam(query.Get("tilt"), err)
+		zoom, err = intParam(query.Get("zoom"), err)
+		if err == nil {
+			err = ptz.Continuous(valueOf(pan), valueOf(tilt), valueOf(zoom))
+		}
+	case "stop":
+		err = ptz.Continuous(0, 0, 0)
+	case "goto", "save":
+		preset := query.Get("preset")
+		if preset == "" {
+			sink.SendError(w, base.ErrPTZInvalid, http.StatusBadRequest)
+			return
+		}
+		if query.Get("command") == "goto" {
+			err = ptz.GotoPreset(preset)
+		} else {
+			err = ptz.SavePreset(preset)
+		}
+	default:
+		sink.SendError(w, ErrPTZCommand, http.StatusBadRequest)
+		return
+	}
+
+	var numErr *strconv.NumError
+	if errors.Is(err, base.ErrPTZInvalid) || errors.As(err, &numErr) {
+		sink.SendError(w, err, http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		log.Error().Err(err).Str("component", "server").Str("name", x.Config().Name).Msg("ptz")
+		sink.SendError(w, err, http.StatusBadGateway)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// floatParam parses an optional number, keeping the first error.
+func floatParam(value string, err error) (*float64, error) {
+	if value == "" || err != nil {
+		return nil, err
+	}
+	number, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return nil, err
+	}
+	return &number, nil
+}
+
+func intParam(value string, err error) (*int, error) {
+	if value == "" || err != nil {
+		return nil, err
+	}
+	number, err := strconv.Atoi(value)
+	if err != nil {
+		return nil, err
+	}
+	return &number, nil
+}
+
+func valueOf(number *int) int {
+	if number == nil {
+		return 0
+	}
+	return *number
+}
+
+// ControlsHandler lists the image controls of the camera, none for drivers without.
+func (x *CamzServer) ControlsHandler(w http.ResponseWriter, r *http.Request) {
+	if !x.checkAPIKey(w, r, base.ROLE_VIEWER) {
+		return
+	}
+
+	controls := []base.Control{}
+	if driver, ok := base.Unwrap(x.pipeline.driver()).(base.IControls); ok {
+		var err error
+		controls, err = driver.Controls()
+		if err != nil {
+			log.Error().Err(err).Str("component", "server").Str("name", x.Config().Name).Msg("controls")
+			sink.SendError(w, err, http.StatusInternalServerError)
+			return
+		}
+	}
+	sink.SendPrettyJSON(r.Context(), w, controls)
+}
+
+// ControlsUpdateHandler sets controls live from {"key": value, ...} and saves them
+// in camera.json, the driver applies them again whenever it opens the camera.  When
+// camera.json can't be written the controls are set back to what they were.
+func (x *CamzServer) ControlsUpdateHandler(w http.ResponseWriter, r *http.Request) {
+	if !x.checkAPIKey(w, r, base.ROLE_OPERATOR) {
+		return
+	}
+
+	driver, ok := base.Unwrap(x.pipeline.driver()).(base.IControls)
+	if !ok {
+		sink.SendError(w, ErrControlsUnsupported, http.StatusNotImplemented)
+		return
+	}
 	defer r.Body.Close()
+	values := map[string]int32{}
+	err := json.NewDecoder(io.LimitReader(r.Body, MAX_CONFIG_SIZE)).Decode(&values)
+	if err != nil {
+		sink.SendError(w, err, http.StatusBadRequest)
+		return
+	}
 
-	// validate width/height against supported sizes
-	// if !x.webcam.CheckSize(uint32(config.Width), uint32(config.Height)) {
-	// 	sink.SendError(w, ErrSizeUnsupported, http.StatusInternalServerError)
-	// 	return
-	// }
-
-	// backup current settings
-	backup := &base.CameraConfig{Motion: &base.MotionConfig{}}
-	backup.ApiKey = x.config.ApiKey
-	backup.Name = x.config.Name
-	backup.Device = x.config.Device
-	backup.Height = x.config.Height
-	backup.Width = x.config.Width
-	backup.Rate = x.config.Rate
-	backup.Motion.Enabled = x.config.Motion.Enabled
-	backup.Motion.Area = x.config.Motion.Area
-	backup.Motion.Detections = x.config.Motion.Detections
-	backup.Motion.Overlap = x.config.Motion.Overlap
-	backup.Motion.Decorate = x.config.Motion.Decorate
-
-	// merge with live settings
-	x.config.ApiKey = config.ApiKey
-	x.config.Name = config.Name
-	x.config.Device = config.Device
-	x.config.Height = config.Height
-	x.config.Width = config.Width
-	x.config.Rate = config.Rate
-	x.config.Motion.Enabled = config.Motion.Enabled
-	x.config.Motion.Area = config.Motion.Area
-	x.config.Motion.Detections = config.Motion.Detections
-	x.config.Motion.Overlap = config.Motion.Overlap
-	x.config.Motion.Decorate = config.Motion.Decorate
-
-	err = x.webcam.Reset()
-	if err != nil {
-		// revert settings
-		x.config.ApiKey = backup.ApiKey
-		x.config.Name = backup.Name
-		x.config.Device = backup.Device
-		x.config.Height = backup.Height
-		x.config.Width = backup.Width
-		x.config.Rate = backup.Rate
-		x.config.Motion.Enabled = backup.Motion.Enabled
-		x.config.Motion.Area = backup.Motion.Area
-		x.config.Motion.Detections = backup.Motion.Detections
-		x.config.Motion.Overlap = backup.Motion.Overlap
-		x.config.Motion.Decorate = backup.Motion.Decorate
-		x.webcam.Reset()
+	x.mutex.Lock()
+	defer x.mutex.Unlock()
+
+	before, err := driver.Controls()
+	if err != nil {
+		log.Error().Err(err).Str("component", "server").Str("name", x.Config().Name).Msg("controls")
 		sink.SendError(w, err, http.StatusInternalServerError)
+		return
+	}
+	err = driver.SetControls(values)
+	if errors.Is(err, base.ErrControl) {
+		sink.SendError(w, err, http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		log.Error().Err(err).Str("component", "server").Str("name", x.Config().Name).Msg("set controls")
+		sink.SendError(w, err, http.StatusInternalServerError)
+		return
 	}
 
-	// save new settings for next restart
-	data, err := json.MarshalIndent(x.config, "", "   ")
+	// the running configuration is shared and never written to, a copy with the
+	// new controls takes its place
+	config := *x.Config()
+	config.Controls = map[string]int32{}
+	for key, value := range x.Config().Controls {
+		config.Controls[key] = value
+	}
+	for key, value := range values {
+		config.Controls[key] = value
+	}
+	err = x.camz.saveCamera(&config)
 	if err != nil {
+		log.Error().Err(err).Str("component", "server").Str("name", config.Name).Msg("save camera.json, rolling back")
+		err = driver.SetControls(previousControls(before, values))
+		if err != nil {
+			log.Error().Err(err).Str("component", "server").Str("name", config.Name).Msg("restore controls")
+		}
 		sink.SendError(w, ErrSaveConfig, http.StatusInternalServerError)
+		return
+	}
+	x.config.Store(&config)
+
+	list, err := driver.Controls()
+	if err != nil {
+		sink.SendError(w, err, http.StatusInternalServerError)
+		return
 	}
-	os.WriteFile("./camera.json", data, fs.ModeAppend)
+	sink.SendPrettyJSON(r.Context(), w, list)
+}
+
+// previousControls are the values in before of the controls set by values,
+// buttons have none to go back to.
+func previousControls(before []base.Control, values map[string]int32) map[string]int32 {
+	previous := map[string]int32{}
+	for _, control := range before {
+		if _, ok := values[control.Key]; ok && control.Type != base.CONTROL_BUTTON {
+			previous[control.Key] = control.Value
+		}
+	}
+	return previous
+}
+
+// driverStatus is the state of the supervised driver, nil for any other.
+func (x *CamzServer) driverStatus() *base.DriverStatus {
+	supervisor, ok := x.pipeline.driver().(*base.Supervisor)
+	if !ok {
+		return nil
+	}
+	status := supervisor.Status()
+	return &status
+}
+
+// DriverHandler reports whether the camera is connected or being reconnected.
+func (x *CamzServer) DriverHandler(w http.ResponseWriter, r *http.Request) {
+	if !x.checkAPIKey(w, r, base.ROLE_VIEWER) {
+		return
+	}
+
+	sink.SendPrettyJSON(r.Context(), w, x.driverStatus())
+}
 
-	sink.SendPrettyJSON(r.Context(), w, x.config)
+func (x *CamzServer) MotionHandler(w http.ResponseWriter, r *http.Request) {
+	if !x.checkAPIKey(w, r, base.ROLE_VIEWER) {
+		return
+	}
+
+	sink.SendPrettyJSON(r.Context(), w, x.detector.State())
+}
+
+type RecordingStatus struct {
+	recorder.Status
+	Volume   recorder.Volume
+	Segments []recorder.Segment
+}
+
+func (x *CamzServer) RecordingsHandler(w http.ResponseWriter, r *http.Request) {
+	if !x.checkAPIKey(w, r, base.ROLE_VIEWER) {
+		return
+	}
+
+	var from, to time.Time
+	var err error
+	if value := r.URL.Query().Get("from"); value != "" {
+		from, err = time.Parse(time.RFC3339, value)
+		if err != nil {
+			sink.SendError(w, err, http.StatusBadRequest)
+			return
+		}
+	}
+	if value := r.URL.Query().Get("to"); value != "" {
+		to, err = time.Parse(time.RFC3339, value)
+		if err != nil {
+			sink.SendError(w, err, http.StatusBadRequest)
+			return
+		}
+	}
+
+	status := RecordingStatus{Status: x.segments.Status()}
+	status.Volume, err = recorder.VolumeStatus(x.dir)
+	if err != nil && !os.IsNotExist(err) {
+		log.Error().Err(err).Str("component", "server").Str("dir", x.dir).Msg("volume status")
+	}
+	status.Segments, err = recorder.Segments(x.dir, x.Config().Uuid, from, to)
+	if err != nil {
+		sink.SendError(w, err, http.StatusInternalServerError)
+		return
+	}
+	sink.SendPrettyJSON(r.Context(), w, status)
+}
+
+// PlaybackHandler streams the recording of from..to as MJPEG, to defaults to now
+// and speed to 1.
+func (x *CamzServer) PlaybackHandler(w http.ResponseWriter, r *http.Request) {
+	if !x.checkAPIKey(w, r, base.ROLE_VIEWER) {
+		return
+	}
+
+	query := r.URL.Query()
+	from, err := time.Parse(time.RFC3339, query.Get("from"))
+	if err != nil {
+		sink.SendError(w, err, http.StatusBadRequest)
+		return
+	}
+	to := time.Now()
+	if value := query.Get("to"); value != "" {
+		to, err = time.Parse(time.RFC3339, value)
+		if err != nil {
+			sink.SendError(w, err, http.StatusBadRequest)
+			return
+		}
+	}
+	speed := 1.0
+	if value := query.Get("speed"); value != "" {
+		speed, err = strconv.ParseFloat(value, 64)
+		if err != nil || speed <= 0 {
+			sink.SendError(w, recorder.ErrBadSpeed, http.StatusBadRequest)
+			return
+		}
+	}
+
+	segments, err := recorder.Segments(x.dir, x.Config().Uuid, from, to)
+	if err != nil {
+		sink.SendError(w, err, http.StatusInternalServerError)
+		return
+	}
+	if len(segments) == 0 {
+		sink.SendError(w, ErrNoRecording, http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "multipart/x-mixed-replace; boundary=--myboundary")
+	w.Header().Set("Server", "Camd")
+	w.Header().Set("Connection", "Close")
+
+	frames, err := recorder.Playback(r.Context(), segments, from, to, speed, func(jpeg []byte, at time.Time) error {
+		err := base.WriteMjpeg(w, jpeg)
+		if flusher, ok := w.(http.Flusher); ok {
+			flusher.Flush()
+		}
+		return err
+	})
+	if err != nil && r.Context().Err() == nil {
+		log.Warn().Err(err).Str("component", "playback").Str("name", x.Config().Name).Msg("playback stopped")
+	}
+	log.Debug().Str("component", "playback").Str("name", x.Config().Name).Int("frames", frames).Msg("playback done")
 }
 
 func (x *CamzServer) ConfigReadHandler(w http.ResponseWriter, r *http.Request) {
-	if !x.checkAPIKey(r) {
-		sink.SendError(w, ErrApiKey, http.StatusForbidden)
+	if !x.checkAPIKey(w, r, base.ROLE_ADMIN) {
 		return
 	}
 
-	sink.SendPrettyJSON(r.Context(), w, x.config)
+	sink.SendPrettyJSON(r.Context(), w, x.Config())
 }
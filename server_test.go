@@ -0,0 +1,318 @@
+// Copyright © 2023 Sloan Childers
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/osintami/camz/base"
+	"github.com/osintami/camz/sink"
+	"github.com/stretchr/testify/assert"
+)
+
+// the drivers of the fake plugin, which refuse to open at Addr "refuse"
+var fakes = struct {
+	drivers []*fakeDriver
+	mutex   sync.Mutex
+}{}
+
+func init() {
+	base.Register(base.Plugin{
+		Name:        "fake",
+		Description: "test driver",
+		New: func(config *base.CameraConfig) base.IDriver {
+			driver := newFakeDriver(config, false)
+			driver.down = config.Addr == "refuse"
+			fakes.mutex.Lock()
+			defer fakes.mutex.Unlock()
+			fakes.drivers = append(fakes.drivers, driver)
+			return driver
+		}})
+}
+
+func lastFake() *fakeDriver {
+	fakes.mutex.Lock()
+	defer fakes.mutex.Unlock()
+	return fakes.drivers[len(fakes.drivers)-1]
+}
+
+func (x *fakeDriver) counts() (int, int) {
+	x.mutex.Lock()
+	defer x.mutex.Unlock()
+	return x.opens, x.stops
+}
+
+func TestConfigUpdate(t *testing.T) {
+	config := testConfig()
+	config.Plugin = "fake"
+	webcam, err := NewDriver(config)
+	assert.NoError(t, err)
+	original := lastFake()
+	camz, router, keys := newTestCamz(t, webcam, config)
+	server := camz.Camera(config.Uuid)
+	admin := keys[base.ROLE_ADMIN]
+	path := "/v1/cameras/" + config.Uuid + "/config"
+	assert.NoError(t, webcam.Open())
+	webcam.Stream()
+	server.resume()
+	defer server.pause()
+
+	// readers keep going while the configuration changes
+	stop := make(chan struct{})
+	var readers sync.WaitGroup
+	readers.Add(1)
+	go func() {
+		defer readers.Done()
+		for {
+			select {
+			case <-stop:
+				return
+			default:
+			}
+			request(router, "GET", path, admin, "")
+			request(router, "GET", "/v1/cameras/"+config.Uuid+"/motion", admin, "")
+			request(router, "GET", "/v1/cameras/"+config.Uuid+"/stats", admin, "")
+			request(router, "GET", "/v1/cameras", admin, "")
+		}
+	}()
+	defer func() {
+		close(stop)
+		readers.Wait()
+	}()
+
+	w := request(router, "POST", path, admin, `{"Rate": 10, "Motion": {"Enabled": true}}`)
+	assert.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	updated := server.Config()
+	assert.Equal(t, float32(10), updated.Rate)
+	assert.True(t, updated.Motion.Enabled)
+	assert.True(t, server.detector.State().Armed)
+	// a new driver on a new configuration, the old ones are left as they were
+	assert.Equal(t, float32(50), config.Rate)
+	assert.Equal(t, updated, camz.configs.Cameras[0])
+	replacement := lastFake()
+	assert.NotEqual(t, original, replacement)
+	_, stops := original.counts()
+	assert.Equal(t, 1, stops)
+
+	// the driver refuses, the new driver is stopped and the previous one reopened
+	w = request(router, "POST", path, admin, `{"Addr": "refuse", "Rate": 25}`)
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+	rejected := lastFake()
+	assert.NotEqual(t, replacement, rejected)
+	opens, stops := rejected.counts()
+	assert.Equal(t, 1, opens)
+	assert.Equal(t, 1, stops)
+	opens, stops = replacement.counts()
+	assert.Equal(t, 2, opens)
+	assert.Equal(t, 1, stops)
+	assert.Equal(t, updated, server.Config())
+	assert.Equal(t, replacement, base.Unwrap(server.pipeline.driver()))
+	assert.Equal(t, "", updated.Addr)
+	assert.Equal(t, float32(10), updated.Rate)
+
+	// invalid patches don't touch the driver
+	assert.Equal(t, http.StatusUnprocessableEntity, request(router, "POST", path, admin, `{"Rate": -1}`).Code)
+	assert.Equal(t, http.StatusUnprocessableEntity, request(router, "POST", path, admin, `{"Plugin": "nope"}`).Code)
+	assert.Equal(t, http.StatusBadRequest, request(router, "POST", path, admin, `{"Uuid": "other"}`).Code)
+	assert.Equal(t, rejected, lastFake())
+	assert.Equal(t, updated, server.Config())
+
+	// camera.json can't be written, the previous configuration keeps running
+	file := camz.file
+	camz.file = filepath.Join(t.TempDir(), "missing", "camera.json")
+	w = request(router, "POST", path, admin, `{"Rate": 20}`)
+	camz.file = file
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+	assert.Contains(t, w.Body.String(), ErrSaveConfig.Error())
+	unsaved := lastFake()
+	assert.NotEqual(t, rejected, unsaved)
+	_, stops = unsaved.counts()
+	assert.Equal(t, 1, stops)
+	assert.Equal(t, updated, server.Config())
+	assert.Equal(t, updated, camz.configs.Cameras[0])
+	assert.Equal(t, replacement, base.Unwrap(server.pipeline.driver()))
+
+	// camera.json has the accepted configuration only
+	saved := &base.Cameras{}
+	assert.NoError(t, sink.LoadJson(camz.file, saved))
+	assert.Equal(t, float32(10), saved.Cameras[0].Rate)
+	assert.Equal(t, "", saved.Cameras[0].Addr)
+
+	// and the camera streams again
+	frames, release := server.pipeline.Subscribe()
+	defer release()
+	select {
+	case frame := <-frames:
+		assert.NotEmpty(t, frame.Jpeg)
+	case <-time.After(time.Second):
+		t.Fatal("no frame after the update")
+	}
+	body := map[string]interface{}{}
+	assert.NoError(t, json.Unmarshal(request(router, "GET", path, admin, "").Body.Bytes(), &body))
+	assert.Equal(t, 10.0, body["Rate"])
+}
+
+// ptzDriver is a fake driver with pan, tilt and zoom that records its moves.
+type ptzDriver struct {
+	*fakeDriver
+	moves []string
+}
+
+func (x *ptzDriver) Move(move base.PTZMove) error {
+	x.moves = append(x.moves, fmt.Sprintf("move %v", *move.Pan))
+	return nil
+}
+
+func (x *ptzDriver) Continuous(pan, tilt, zoom int) error {
+	x.moves = append(x.moves, fmt.Sprintf("continuous %d %d %d", pan, tilt, zoom))
+	return nil
+}
+
+func (x *ptzDriver) GotoPreset(name string) error {
+	x.moves = append(x.moves, "goto "+name)
+	return nil
+}
+
+func (x *ptzDriver) SavePreset(name string) error {
+	x.moves = append(x.moves, "save "+name)
+	return nil
+}
+
+func (x *ptzDriver) Presets() ([]string, error) {
+	return []string{"door", "gate"}, nil
+}
+
+func TestPTZ(t *testing.T) {
+	config := testConfig()
+	driver := &ptzDriver{fakeDriver: newFakeDriver(config, false)}
+	_, router, keys := newTestCamz(t, driver, config)
+	path := "/v1/cameras/" + config.Uuid + "/ptz"
+
+	// GETs only read, a move link does nothing
+	w := request(router, "GET", path+"?command=move&pan=10", keys[base.ROLE_OPERATOR], "")
+	assert.Equal(t, http.StatusMethodNotAllowed, w.Code)
+	assert.Equal(t, "POST", w.Header().Get("Allow"))
+	assert.Equal(t, http.StatusMethodNotAllowed, request(router, "GET", path+"?command=save&preset=door", keys[base.ROLE_OPERATOR], "").Code)
+	assert.Empty(t, driver.moves)
+	for _, query := range []string{"", "?command=presets"} {
+		w = request(router, "GET", path+query, keys[base.ROLE_VIEWER], "")
+		assert.Equal(t, http.StatusOK, w.Code)
+		presets := []string{}
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &presets))
+		assert.Equal(t, []string{"door", "gate"}, presets)
+	}
+
+	// POSTs move, from the query or a form body, for operators
+	assert.Equal(t, http.StatusForbidden, request(router, "POST", path+"?command=stop", keys[base.ROLE_VIEWER], "").Code)
+	assert.Equal(t, http.StatusNoContent, request(router, "POST", path+"?command=move&pan=10", keys[base.ROLE_OPERATOR], "").Code)
+	r := httptest.NewRequest("POST", path, strings.NewReader("command=goto&preset=door"))
+	r.Header.Set("X-Api-Key", keys[base.ROLE_OPERATOR])
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, r)
+	assert.Equal(t, http.StatusNoContent, w.Code)
+	assert.Equal(t, http.StatusNoContent, request(router, "POST", "/v1/ptz?command=save&preset=gate", keys[base.ROLE_OPERATOR], "").Code)
+	assert.Equal(t, http.StatusBadRequest, request(router, "POST", path+"?command=presets", keys[base.ROLE_OPERATOR], "").Code)
+	assert.Equal(t, []string{"move 10", "goto door", "save gate"}, driver.moves)
+}
+
+// controlsDriver is a fake driver with a brightness control from 0 to 100.
+type controlsDriver struct {
+	*fakeDriver
+	brightness int32
+}
+
+func (x *controlsDriver) Controls() ([]base.Control, error) {
+	return []base.Control{{Key: "brightness", Type: base.CONTROL_INTEGER, Max: 100, Value: x.brightness}}, nil
+}
+
+func (x *controlsDriver) SetControls(values map[string]int32) error {
+	for key, value := range values {
+		if key != "brightness" || value < 0 || value > 100 {
+			return fmt.Errorf("%w: %s", base.ErrControl, key)
+		}
+		x.brightness = value
+	}
+	return nil
+}
+
+func TestControlsUpdate(t *testing.T) {
+	config := testConfig()
+	driver := &controlsDriver{fakeDriver: newFakeDriver(config, false), brightness: 50}
+	camz, router, keys := newTestCamz(t, driver, config)
+	server := camz.Camera(config.Uuid)
+	operator := keys[base.ROLE_OPERATOR]
+	path := "/v1/cameras/" + config.Uuid + "/controls"
+
+	// the running configuration is replaced, not written to
+	w := request(router, "POST", path, operator, `{"brightness": 80}`)
+	assert.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.Equal(t, int32(80), driver.brightness)
+	updated := server.Config()
+	assert.NotEqual(t, config, updated)
+	assert.Nil(t, config.Controls)
+	assert.Equal(t, map[string]int32{"brightness": 80}, updated.Controls)
+	assert.Equal(t, updated, camz.configs.Cameras[0])
+	saved := &base.Cameras{}
+	assert.NoError(t, sink.LoadJson(camz.file, saved))
+	assert.Equal(t, map[string]int32{"brightness": 80}, saved.Cameras[0].Controls)
+
+	assert.Equal(t, http.StatusBadRequest, request(router, "POST", path, operator, `{"brightness": 101}`).Code)
+	assert.Equal(t, updated, server.Config())
+
+	// camera.json can't be written, the control is set back
+	file := camz.file
+	camz.file = filepath.Join(t.TempDir(), "missing", "camera.json")
+	w = request(router, "POST", path, operator, `{"brightness": 20}`)
+	camz.file = file
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+	assert.Equal(t, int32(80), driver.brightness)
+	assert.Equal(t, updated, server.Config())
+	assert.Equal(t, updated, camz.configs.Cameras[0])
+}
+
+func TestCommand(t *testing.T) {
+	config := testConfig()
+	driver := newFakeDriver(config, false)
+	camz, router, keys := newTestCamz(t, driver, config)
+	server := camz.Camera(config.Uuid)
+	operator := keys[base.ROLE_OPERATOR]
+	path := "/v1/cameras/" + config.Uuid + "/command?command="
+	server.resume()
+	defer server.pause()
+	_, release := server.pipeline.Subscribe()
+	defer release()
+	assert.Eventually(t, func() bool { return driver.grabbed() > 0 }, time.Second, time.Millisecond)
+
+	// stop takes the pipeline down with the driver
+	assert.Equal(t, http.StatusOK, request(router, "GET", path+"stop", operator, "").Code)
+	assert.False(t, server.detector.State().Running)
+	_, stops := driver.counts()
+	assert.Equal(t, 1, stops)
+	grabs := driver.grabbed()
+	time.Sleep(50 * time.Millisecond)
+	assert.Equal(t, grabs, driver.grabbed())
+
+	// and start brings it back
+	assert.Equal(t, http.StatusOK, request(router, "GET", path+"start", operator, "").Code)
+	assert.True(t, server.detector.State().Running)
+	opens, _ := driver.counts()
+	assert.Equal(t, 1, opens)
+	assert.Eventually(t, func() bool { return driver.grabbed() > grabs }, time.Second, time.Millisecond)
+
+	// the driver's error is the answer, the camera runs on
+	driver.mutex.Lock()
+	driver.down = true
+	driver.mutex.Unlock()
+	w := request(router, "GET", path+"reset", operator, "")
+	assert.Equal(t, http.StatusBadGateway, w.Code)
+	assert.Contains(t, w.Body.String(), "camera refused")
+	assert.True(t, server.detector.State().Running)
+}
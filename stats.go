@@ -0,0 +1,160 @@
+// Copyright © 2023 Sloan Childers
+package main
+
+import (
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/osintami/camz/base"
+	"github.com/osintami/camz/sink"
+)
+
+// CameraStats are the figures of a camera from capture to its viewers.  Rates are
+// per second over the last base.STATS_WINDOW seconds.
+type CameraStats struct {
+	Uuid   string
+	Name   string
+	Plugin string
+	// frames the driver captured and the pipeline took in
+	Captured   uint64
+	CaptureFps float64
+	// frames encoded for viewers and recorders
+	Encoded   uint64
+	EncodeFps float64
+	Dropped   DroppedStats
+	// grabbing and decoding a frame, encoding it, and motion analysis
+	Decode base.TimingStats
+	Encode base.TimingStats
+	Motion base.TimingStats
+	// from capture to the frame written to a viewer
+	Latency    base.TimingStats
+	Reconnects int
+	Clients    []ClientStats
+}
+
+type DroppedStats struct {
+	// frames the driver lost, for the drivers that know
+	Driver uint64
+	// captures the pipeline never saw, it was busy
+	Capture uint64
+	// frames viewers were too slow for
+	Stream uint64
+	// frames offered while motion analysis was busy
+	Motion uint64
+	// frames the clip and segment recorders couldn't write in time
+	Recording uint64
+}
+
+type ClientStats struct {
+	Remote  string
+	Since   time.Time
+	Frames  uint64
+	Fps     float64
+	Latency base.TimingStats
+}
+
+// streamClient is a viewer of the MJPEG stream.
+type streamClient struct {
+	remote  string
+	since   time.Time
+	frames  base.Meter
+	latency base.Timing
+}
+
+// streamClients are the viewers of a camera, latency is over all of them.
+type streamClients struct {
+	clients map[*streamClient]struct{}
+	latency base.Timing
+	mutex   sync.Mutex
+}
+
+func newStreamClients() *streamClients {
+	return &streamClients{clients: map[*streamClient]struct{}{}}
+}
+
+func (x *streamClients) add(remote string) *streamClient {
+	client := &streamClient{remote: remote, since: time.Now()}
+	x.mutex.Lock()
+	defer x.mutex.Unlock()
+	x.clients[client] = struct{}{}
+	return client
+}
+
+func (x *streamClients) remove(client *streamClient) {
+	x.mutex.Lock()
+	defer x.mutex.Unlock()
+	delete(x.clients, client)
+}
+
+// sent counts a frame written to client, captured at captured.
+func (x *streamClients) sent(client *streamClient, captured time.Time) {
+	latency := time.Since(captured)
+	client.frames.Mark(1)
+	client.latency.Add(latency)
+	x.latency.Add(latency)
+}
+
+// stats lists the viewers, the longest watching first.
+func (x *streamClients) stats() []ClientStats {
+	x.mutex.Lock()
+	clients := []*streamClient{}
+	for client := range x.clients {
+		clients = append(clients, client)
+	}
+	x.mutex.Unlock()
+	sort.Slice(clients, func(i, j int) bool { return clients[i].since.Before(clients[j].since) })
+	stats := []ClientStats{}
+	for _, client := range clients {
+		stats = append(stats, ClientStats{
+			Remote:  client.remote,
+			Since:   client.since,
+			Frames:  client.frames.Total(),
+			Fps:     client.frames.Rate(),
+			Latency: client.latency.Stats()})
+	}
+	return stats
+}
+
+func (x *CamzServer) Stats() CameraStats {
+	stats := CameraStats{Uuid: x.Config().Uuid, Name: x.Config().Name, Plugin: x.Config().Plugin}
+	x.pipeline.stats(&stats)
+	x.detector.stats(&stats)
+	stats.Dropped.Recording = x.clips.Dropped() + x.segments.Status().Dropped
+	if driver, ok := base.Unwrap(x.pipeline.driver()).(base.IDropped); ok {
+		stats.Dropped.Driver = driver.Dropped()
+	}
+	stats.Latency = x.clients.latency.Stats()
+	stats.Clients = x.clients.stats()
+	if status := x.driverStatus(); status != nil {
+		stats.Reconnects = status.Reconnects
+	}
+	return stats
+}
+
+// StatsHandler reports the figures of the camera.
+func (x *CamzServer) StatsHandler(w http.ResponseWriter, r *http.Request) {
+	if !x.checkAPIKey(w, r, base.ROLE_VIEWER) {
+		return
+	}
+
+	sink.SendPrettyJSON(r.Context(), w, x.Stats())
+}
+
+// StatsHandler reports the figures of every running camera the key can view.
+func (x *Camz) StatsHandler(w http.ResponseWriter, r *http.Request) {
+	apiKey := x.apiKey(r)
+	if apiKey == nil {
+		sink.SendError(w, ErrApiKey, http.StatusUnauthorized)
+		return
+	}
+
+	stats := []CameraStats{}
+	for _, server := range x.servers {
+		if apiKey.Allows(server.Config().Uuid, base.ROLE_VIEWER) {
+			stats = append(stats, server.Stats())
+		}
+	}
+	sink.SendPrettyJSON(r.Context(), w, stats)
+}
@@ -0,0 +1,138 @@
+// Copyright © 2023 Sloan Childers
+package testsrc
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"image/jpeg"
+	"sync"
+	"time"
+
+	"github.com/osintami/camz/base"
+	"github.com/rs/zerolog/log"
+)
+
+// "plugin": "testsrc",
+// "width": 640,
+// "height": 480,
+// "rate": 10,
+// "pattern": "bars,box,clock,noise",
+
+// sizes offered by ListFormatsAndFrameSizes, any other size works as well
+var frameSizes = []string{"160x120", "320x240", "640x480", "800x600", "1280x720", "1920x1080"}
+
+// Driver is a camera without hardware, it draws a test pattern at Width x Height
+// and Rate frames per second.
+type Driver struct {
+	config  *base.CameraConfig
+	pattern Pattern
+	frames  *base.Publisher
+	count   uint64
+	stop    chan struct{}
+	mutex   sync.Mutex
+}
+
+func NewDriver(config *base.CameraConfig) *Driver {
+	return &Driver{
+		config: config,
+		frames: base.NewPublisher("testsrc")}
+}
+
+func (x *Driver) ListFormatsAndFrameSizes() base.Formats {
+	sizes := []base.Size{}
+	for _, size := range frameSizes {
+		sizes = append(sizes, base.Size{Size: size})
+	}
+	return base.Formats{Formats: []base.Format{{Name: "Motion-JPEG", Sizes: sizes}}}
+}
+
+func (x *Driver) Grab() base.IFrame {
+	return x.frames.Frame(x.config)
+}
+
+// Subscribe returns a channel of the frames as they are drawn.
+func (x *Driver) Subscribe() (<-chan *base.Capture, func()) {
+	return x.frames.Subscribe()
+}
+
+func (x *Driver) Open() error {
+	if x.config.Width <= 0 || x.config.Height <= 0 || x.config.Rate <= 0 {
+		err := fmt.Errorf("testsrc needs a size and rate, got %dx%d at %v", x.config.Width, x.config.Height, x.config.Rate)
+		log.Error().Err(err).Str("component", "driver").Str("name", x.config.Name).Msg("Open")
+		return err
+	}
+	x.mutex.Lock()
+	defer x.mutex.Unlock()
+	x.pattern = ParsePattern(x.config.Pattern)
+	x.count = 0
+	return nil
+}
+
+func (x *Driver) Stream() {
+	x.mutex.Lock()
+	defer x.mutex.Unlock()
+	if x.stop != nil {
+		return
+	}
+	x.stop = make(chan struct{})
+	go x.stream(x.stop)
+}
+
+func (x *Driver) Stop() {
+	x.mutex.Lock()
+	defer x.mutex.Unlock()
+	if x.stop != nil {
+		close(x.stop)
+		x.stop = nil
+	}
+	x.frames.Clear()
+}
+
+func (x *Driver) Reset() error {
+	x.Stop()
+	err := x.Open()
+	if err != nil {
+		json, _ := json.Marshal(x.config)
+		log.Error().Err(err).Str("component", "driver").Str("name", x.config.Name).RawJSON("config", json).Msg("Open")
+		return err
+	}
+	x.Stream()
+	return nil
+}
+
+func (x *Driver) stream(stop chan struct{}) {
+	for {
+		startTime := time.Now().UnixMilli()
+		select {
+		case <-stop:
+			return
+		default:
+		}
+		drawn := time.Now()
+		data, err := x.render(drawn)
+		if err != nil {
+			log.Error().Err(err).Str("component", "driver").Str("name", x.config.Name).Msg("JPEG encode")
+		} else {
+			x.mutex.Lock()
+			if x.stop == stop {
+				x.frames.Publish(&base.Capture{Image: data, Type: base.JPEG, Time: drawn})
+			}
+			x.mutex.Unlock()
+		}
+		base.Sleep(int64(x.config.Rate), time.Now().UnixMilli()-startTime)
+	}
+}
+
+// render draws and encodes the next frame, its clock showing at.
+func (x *Driver) render(at time.Time) ([]byte, error) {
+	x.mutex.Lock()
+	count := x.count
+	x.count++
+	x.mutex.Unlock()
+
+	img := x.pattern.Draw(x.config.Width, x.config.Height, count, at)
+	out := bytes.Buffer{}
+	err := jpeg.Encode(&out, img, &jpeg.Options{Quality: 75})
+	return out.Bytes(), err
+}
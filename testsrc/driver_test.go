@@ -0,0 +1,57 @@
+// Copyright © 2023 Sloan Childers
+package testsrc
+
+import (
+	"bytes"
+	"image/jpeg"
+	"testing"
+	"time"
+
+	"github.com/osintami/camz/base"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPattern(t *testing.T) {
+	pattern := ParsePattern("")
+	assert.True(t, pattern.Bars && pattern.Box && pattern.Clock)
+	assert.False(t, pattern.Noise)
+
+	at := time.Date(2023, 10, 17, 10, 15, 30, 0, time.UTC)
+	first := pattern.Draw(320, 240, 0, at)
+	assert.Equal(t, 320, first.Bounds().Dx())
+	assert.Equal(t, 240, first.Bounds().Dy())
+	// the box starts at the left edge and moves right
+	assert.Equal(t, white, first.RGBAAt(10, 120))
+	second := pattern.Draw(320, 240, 10, at)
+	assert.NotEqual(t, white, second.RGBAAt(10, 120))
+	assert.Equal(t, white, second.RGBAAt(50, 120))
+	// the last bar is blue
+	assert.Equal(t, bars[6], first.RGBAAt(315, 200))
+
+	noisy := ParsePattern("bars, noise")
+	assert.False(t, noisy.Box)
+	assert.NotEqual(t, first.Pix, noisy.Draw(320, 240, 0, at).Pix)
+}
+
+func TestDriver(t *testing.T) {
+	config := &base.CameraConfig{Name: "testsrc", Width: 160, Height: 120, Rate: 100}
+	x := NewDriver(config)
+	assert.NotEmpty(t, x.ListFormatsAndFrameSizes().Formats[0].Sizes)
+	assert.NoError(t, x.Open())
+	x.Stream()
+	assert.Eventually(t, func() bool {
+		last := x.frames.Last()
+		return last != nil && last.Seq > 3
+	}, time.Second, 5*time.Millisecond)
+
+	last := x.frames.Last()
+	img, err := jpeg.Decode(bytes.NewReader(last.Image))
+	assert.NoError(t, err)
+	assert.Equal(t, 160, img.Bounds().Dx())
+	assert.Equal(t, "testsrc", last.Source)
+	x.Stop()
+	assert.Nil(t, x.frames.Last())
+
+	config.Rate = 0
+	assert.Error(t, x.Reset())
+}
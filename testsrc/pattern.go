@@ -0,0 +1,141 @@
+// Copyright © 2023 Sloan Childers
+package testsrc
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"math/rand"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/osintami/camz/base"
+)
+
+const (
+	PATTERN_BARS  = "bars"
+	PATTERN_BOX   = "box"
+	PATTERN_CLOCK = "clock"
+	PATTERN_NOISE = "noise"
+	// used when the config has no Pattern
+	DEFAULT_PATTERN = PATTERN_BARS + "," + PATTERN_BOX + "," + PATTERN_CLOCK
+	// pixels the box moves per frame, at 640 pixels wide
+	BOX_SPEED = 8
+	// largest change noise makes to a colour channel
+	NOISE_LEVEL = 24
+	TIME_FORMAT = "2006-01-02 15:04:05.000"
+)
+
+// 75% colour bars, left to right
+var bars = []color.RGBA{
+	{191, 191, 191, 255},
+	{191, 191, 0, 255},
+	{0, 191, 191, 255},
+	{0, 191, 0, 255},
+	{191, 0, 191, 255},
+	{191, 0, 0, 255},
+	{0, 0, 191, 255},
+}
+
+var (
+	white = color.RGBA{255, 255, 255, 255}
+	grey  = color.RGBA{64, 64, 64, 255}
+)
+
+// Pattern draws the frames of the test source.
+type Pattern struct {
+	Bars  bool
+	Box   bool
+	Clock bool
+	Noise bool
+	rand  *rand.Rand
+}
+
+// ParsePattern reads a comma separated list of bars, box, clock and noise.
+func ParsePattern(spec string) Pattern {
+	if strings.TrimSpace(spec) == "" {
+		spec = DEFAULT_PATTERN
+	}
+	pattern := Pattern{rand: rand.New(rand.NewSource(1))}
+	for _, name := range strings.Split(spec, ",") {
+		switch strings.ToLower(strings.TrimSpace(name)) {
+		case PATTERN_BARS:
+			pattern.Bars = true
+		case PATTERN_BOX:
+			pattern.Box = true
+		case PATTERN_CLOCK:
+			pattern.Clock = true
+		case PATTERN_NOISE:
+			pattern.Noise = true
+		}
+	}
+	return pattern
+}
+
+// Draw renders frame number count, captured at, into a new image.
+func (x *Pattern) Draw(width, height int, count uint64, at time.Time) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	if x.Bars {
+		for i, bar := range bars {
+			rect := image.Rect(i*width/len(bars), 0, (i+1)*width/len(bars), height)
+			draw.Draw(img, rect, image.NewUniform(bar), image.Point{}, draw.Src)
+		}
+	} else {
+		draw.Draw(img, img.Bounds(), image.NewUniform(grey), image.Point{}, draw.Src)
+	}
+	if x.Box {
+		x.drawBox(img, count)
+	}
+	if x.Clock {
+		scale := height / 160
+		if scale < 1 {
+			scale = 1
+		}
+		base.DrawText(img, at.Format(TIME_FORMAT), scale, scale*2, scale*2)
+		counter := "#" + strconv.FormatUint(count, 10)
+		base.DrawText(img, counter, scale, scale*2, height-scale*(base.GLYPH_HEIGHT+3))
+	}
+	if x.Noise {
+		x.drawNoise(img)
+	}
+	return img
+}
+
+// drawBox bounces a white box across the frame, enough to trigger motion detection.
+func (x *Pattern) drawBox(img *image.RGBA, count uint64) {
+	width, height := img.Bounds().Dx(), img.Bounds().Dy()
+	size := height / 4
+	if size < 2 {
+		size = 2
+	}
+	speed := BOX_SPEED * width / 640
+	if speed < 1 {
+		speed = 1
+	}
+	span := width - size
+	if span <= 0 {
+		span = 1
+	}
+	// back and forth, one span per direction
+	pos := int(count*uint64(speed)) % (2 * span)
+	if pos > span {
+		pos = 2*span - pos
+	}
+	top := (height - size) / 2
+	draw.Draw(img, image.Rect(pos, top, pos+size, top+size), image.NewUniform(white), image.Point{}, draw.Src)
+}
+
+func (x *Pattern) drawNoise(img *image.RGBA) {
+	for i := 0; i < len(img.Pix); i += 4 {
+		for c := 0; c < 3; c++ {
+			value := int(img.Pix[i+c]) + x.rand.Intn(2*NOISE_LEVEL+1) - NOISE_LEVEL
+			if value < 0 {
+				value = 0
+			} else if value > 255 {
+				value = 255
+			}
+			img.Pix[i+c] = uint8(value)
+		}
+	}
+}
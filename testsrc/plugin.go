@@ -0,0 +1,14 @@
+// Copyright © 2023 Sloan Childers
+package testsrc
+
+import "github.com/osintami/camz/base"
+
+func init() {
+	base.Register(base.Plugin{
+		Name:        "testsrc",
+		Description: "test pattern drawn without a camera",
+		Config: []base.PluginField{
+			{Name: "Pattern", Type: "string", Description: "any of bars,box,clock,noise"},
+		},
+		New: func(config *base.CameraConfig) base.IDriver { return NewDriver(config) }})
+}